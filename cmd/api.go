@@ -0,0 +1,479 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * The HTTP API serves games as JSON for dashboards and web frontends.
+ * Games live in memory and are played with the same movePiece rules as the
+ * terminal UI.
+ *
+ *   POST /games                  create a game
+ *   GET  /games                  list games
+ *   GET  /games/{id}             position, legal moves and clocks
+ *   POST /games/{id}/moves       submit a move
+ *   GET  /games/{id}/moves       the move record
+ *   POST /games/{id}/resign      resign for one side
+ *   GET  /games/{id}/events      server-sent events for spectators
+ */
+
+const apiUsage = "usage: small-chess api [-addr :8080]"
+const apiListeningMsg = "Serving the small-chess API on %s\n"
+const lostOnTimeMsg = "%s lost on time\n"
+
+var errGameNotFound = errors.New("game not found")
+var errGameFinished = errors.New("the game is over")
+
+// storedGame is a game kept by the API. Its mutex guards the model and the
+// clock.
+type storedGame struct {
+	mu      sync.Mutex
+	id      string
+	variant string
+	created time.Time
+	m       Model
+	clock   *gameClock
+	streams map[chan streamEvent]bool // spectators following the game
+}
+
+// gameStore keeps the API's games in memory.
+type gameStore struct {
+	mu     sync.RWMutex
+	nextID int
+	games  map[string]*storedGame
+}
+
+func newGameStore() *gameStore {
+	return &gameStore{nextID: 1, games: make(map[string]*storedGame)}
+}
+
+func (s *gameStore) add(g *storedGame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g.id = strconv.Itoa(s.nextID)
+	s.nextID++
+	s.games[g.id] = g
+}
+
+func (s *gameStore) get(id string) (*storedGame, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	g, ok := s.games[id]
+	return g, ok
+}
+
+// list returns the games in the order they were created.
+func (s *gameStore) list() []*storedGame {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	games := make([]*storedGame, len(s.games))
+	for _, g := range s.games {
+		n, _ := strconv.Atoi(g.id)
+		games[n-1] = g
+	}
+
+	return games
+}
+
+// checkClock ends the game when the side to move has run out of time.
+func (g *storedGame) checkClock(now time.Time) {
+	if g.clock == nil || g.m.result != resultNone || !g.clock.flagged(now) {
+		return
+	}
+
+	g.clock.stop(now)
+	side := "White"
+	g.m = finishGame(g.m, resultBlackWins)
+	if !g.m.isWhiteTurn {
+		side = "Black"
+		g.m.result = resultWhiteWins
+	}
+	writeToHistory(fmt.Sprintf(lostOnTimeMsg, side), g.m.logFile)
+	recordGame(g.m)
+	g.publish(now)
+}
+
+/*
+ * JSON documents
+ */
+
+type apiCreateRequest struct {
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Variant string `json:"variant"`
+	Clock   *int   `json:"clock"` // minutes per side; the config default when absent
+}
+
+type apiMoveRequest struct {
+	Move string `json:"move"` // such as "b1c3", instead of from and to
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type apiResignRequest struct {
+	Side string `json:"side"`
+}
+
+type apiClock struct {
+	WhiteMS int64  `json:"white_ms"`
+	BlackMS int64  `json:"black_ms"`
+	Running string `json:"running,omitempty"`
+}
+
+type apiGameState struct {
+	ID         string    `json:"id"`
+	Variant    string    `json:"variant"`
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	FEN        string    `json:"fen"`
+	Board      []string  `json:"board"`
+	Turn       string    `json:"turn"`
+	Result     string    `json:"result,omitempty"`
+	LegalMoves []string  `json:"legal_moves"`
+	Clock      *apiClock `json:"clock,omitempty"`
+	Moves      int       `json:"moves"`
+	Spectators int       `json:"spectators"`
+}
+
+type apiGameSummary struct {
+	ID      string    `json:"id"`
+	Variant string    `json:"variant"`
+	Width   int       `json:"width"`
+	Height  int       `json:"height"`
+	Turn    string    `json:"turn"`
+	Result  string    `json:"result,omitempty"`
+	Moves   int       `json:"moves"`
+	Created time.Time `json:"created"`
+}
+
+type apiMove struct {
+	Ply      int    `json:"ply"`
+	Move     string `json:"move"`
+	Piece    string `json:"piece"`
+	Captured string `json:"captured,omitempty"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func turnName(white bool) string {
+	if white {
+		return "white"
+	}
+
+	return "black"
+}
+
+func pieceLetter(piece rune) string {
+	if letter, ok := glyphSets["letters"][piece]; ok {
+		return string(letter)
+	}
+
+	return ""
+}
+
+// state describes the game; the caller holds g.mu.
+func (g *storedGame) state(now time.Time) apiGameState {
+	m := g.m
+	st := apiGameState{
+		ID:         g.id,
+		Variant:    g.variant,
+		Width:      m.Board.Width,
+		Height:     m.Board.Height,
+		FEN:        m.fen(),
+		Board:      boardRows(m),
+		Turn:       turnName(m.isWhiteTurn),
+		Result:     m.result.String(),
+		LegalMoves: []string{},
+		Moves:      len(m.moves),
+		Spectators: len(g.streams),
+	}
+
+	if m.result == resultNone {
+		for _, mv := range m.rules().legalMoves(m.Table, m.Board, m.isWhiteTurn, m.moves) {
+			st.LegalMoves = append(st.LegalMoves, moveText(mv, m.Board.Height))
+		}
+	}
+
+	if g.clock != nil {
+		st.Clock = g.clockState(now)
+	}
+
+	return st
+}
+
+func (g *storedGame) clockState(now time.Time) *apiClock {
+	c := &apiClock{
+		WhiteMS: g.clock.left(0, now).Milliseconds(),
+		BlackMS: g.clock.left(1, now).Milliseconds(),
+	}
+	if !g.clock.stopped {
+		c.Running = turnName(g.clock.running == 0)
+	}
+
+	return c
+}
+
+func (g *storedGame) summary() apiGameSummary {
+	return apiGameSummary{
+		ID:      g.id,
+		Variant: g.variant,
+		Width:   g.m.Board.Width,
+		Height:  g.m.Board.Height,
+		Turn:    turnName(g.m.isWhiteTurn),
+		Result:  g.m.result.String(),
+		Moves:   len(g.m.moves),
+		Created: g.created,
+	}
+}
+
+func (g *storedGame) record() []apiMove {
+	record := make([]apiMove, len(g.m.moves))
+	for i, r := range g.m.moves {
+		record[i] = apiMove{
+			Ply:      i + 1,
+			Move:     moveText(r.mv, g.m.Board.Height),
+			Piece:    pieceLetter(r.piece),
+			Captured: pieceLetter(r.captured),
+		}
+	}
+
+	return record
+}
+
+/*
+ * handlers
+ */
+
+type apiServer struct {
+	config Config
+	store  *gameStore
+	mux    *http.ServeMux
+	now    func() time.Time
+}
+
+func newAPIServer(cfg Config) *apiServer {
+	s := &apiServer{config: cfg, store: newGameStore(), mux: http.NewServeMux(), now: time.Now}
+
+	s.mux.HandleFunc("POST /games", s.createGame)
+	s.mux.HandleFunc("GET /games", s.listGames)
+	s.mux.HandleFunc("GET /games/{id}", s.withGame(s.getGame))
+	s.mux.HandleFunc("POST /games/{id}/moves", s.withGame(s.submitMove))
+	s.mux.HandleFunc("GET /games/{id}/moves", s.withGame(s.getRecord))
+	s.mux.HandleFunc("POST /games/{id}/resign", s.withGame(s.resign))
+	s.mux.HandleFunc("GET /games/{id}/events", s.streamGame)
+
+	return s
+}
+
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, apiError{Error: err.Error()})
+}
+
+// readJSON decodes a request body, treating an empty body as {}.
+func readJSON(r *http.Request, v any) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	return err
+}
+
+// withGame looks up the game named in the path and locks it for the
+// handler, after settling its clock.
+func (s *apiServer) withGame(h func(http.ResponseWriter, *http.Request, *storedGame, time.Time)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		g, ok := s.store.get(r.PathValue("id"))
+		if !ok {
+			writeError(w, http.StatusNotFound, errGameNotFound)
+			return
+		}
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+
+		now := s.now()
+		g.checkClock(now)
+		h(w, r, g, now)
+	}
+}
+
+func (s *apiServer) createGame(w http.ResponseWriter, r *http.Request) {
+	req := apiCreateRequest{Width: s.config.Width, Height: s.config.Height}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Variant == "" {
+		req.Variant = newModel(s.config).rules().Name
+	}
+	v, ok := knownVariant(req.Variant)
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown variant %q", req.Variant))
+		return
+	}
+	if v.Players == fourPlayers {
+		writeError(w, http.StatusBadRequest, errFourPlayersLocal)
+		return
+	}
+	if v.Fog {
+		writeError(w, http.StatusBadRequest, errFogHidden)
+		return
+	}
+	if !v.validSize(req.Width) || !v.validSize(req.Height) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("width and height must be between %d and %d", v.MinSize, v.MaxSize))
+		return
+	}
+
+	minutes := s.config.Clock
+	if req.Clock != nil {
+		minutes = *req.Clock
+	}
+	if minutes < 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("clock must be a number of minutes per side (0 for no clock)"))
+		return
+	}
+
+	now := s.now()
+	m := newModel(s.config)
+	m.Board, m.variant = Board{Width: req.Width, Height: req.Height}, v
+	g := &storedGame{variant: req.Variant, created: now, clock: newGameClock(minutes, now)}
+
+	// the game is started once it has an ID to name its history file
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s.store.add(g)
+	m.logTag = "api" + g.id
+	g.m = startGame(m)
+
+	writeJSON(w, http.StatusCreated, g.state(now))
+}
+
+func (s *apiServer) listGames(w http.ResponseWriter, r *http.Request) {
+	games := s.store.list()
+	summaries := make([]apiGameSummary, 0, len(games))
+
+	for _, g := range games {
+		g.mu.Lock()
+		g.checkClock(s.now())
+		summaries = append(summaries, g.summary())
+		g.mu.Unlock()
+	}
+
+	writeJSON(w, http.StatusOK, summaries)
+}
+
+func (s *apiServer) getGame(w http.ResponseWriter, r *http.Request, g *storedGame, now time.Time) {
+	writeJSON(w, http.StatusOK, g.state(now))
+}
+
+func (s *apiServer) getRecord(w http.ResponseWriter, r *http.Request, g *storedGame, now time.Time) {
+	writeJSON(w, http.StatusOK, g.record())
+}
+
+func (s *apiServer) submitMove(w http.ResponseWriter, r *http.Request, g *storedGame, now time.Time) {
+	var req apiMoveRequest
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Move != "" {
+		mv, ok := parseMoveText(req.Move, g.m.Board)
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid move %q", req.Move))
+			return
+		}
+		req.From, req.To = moveArgs(mv, g.m.Board.Height)
+	}
+
+	if g.m.result != resultNone {
+		writeError(w, http.StatusConflict, errGameFinished)
+		return
+	}
+
+	m, msg := movePiece(strings.ToLower(req.From), strings.ToLower(req.To), g.m)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, errors.New(strings.TrimSpace(msg)))
+		return
+	}
+
+	g.m = m
+	if g.clock != nil {
+		if m.result != resultNone {
+			g.clock.stop(now)
+		} else {
+			g.clock.press(now)
+		}
+	}
+	g.publish(now)
+
+	writeJSON(w, http.StatusOK, g.state(now))
+}
+
+func (s *apiServer) resign(w http.ResponseWriter, r *http.Request, g *storedGame, now time.Time) {
+	var req apiResignRequest
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Side != "white" && req.Side != "black" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("side must be white or black"))
+		return
+	}
+	if g.m.result != resultNone {
+		writeError(w, http.StatusConflict, errGameFinished)
+		return
+	}
+
+	g.m = resignGame(g.m, req.Side == "white")
+	if g.clock != nil {
+		g.clock.stop(now)
+	}
+	g.publish(now)
+
+	writeJSON(w, http.StatusOK, g.state(now))
+}
+
+// runAPICommand implements `small-chess api`.
+func runAPICommand(args []string, cfg Config, out io.Writer) error {
+	fs := flag.NewFlagSet("api", flag.ContinueOnError)
+	fs.SetOutput(out)
+	addr := fs.String("addr", ":8080", "address to listen on")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New(apiUsage)
+	}
+
+	fmt.Fprintf(out, apiListeningMsg, *addr)
+	return http.ListenAndServe(*addr, newAPIServer(cfg))
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// apiCall sends a request to the API and decodes the JSON answer into out.
+func apiCall(t *testing.T, s http.Handler, method, path, body string, out any) int {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: invalid JSON %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+
+	return rec.Code
+}
+
+func TestAPIGame(t *testing.T) {
+	s := newAPIServer(headlessTestConfig(t))
+
+	var st apiGameState
+	if code := apiCall(t, s, "POST", "/games", `{"width": 6, "height": 6}`, &st); code != http.StatusCreated {
+		t.Fatalf("create = %d", code)
+	}
+	if st.ID != "1" || st.Turn != "white" || st.Clock != nil || st.FEN != "3htk/6/6/6/6/KTH3 w" {
+		t.Errorf("new game = %+v", st)
+	}
+	if !slices.Contains(st.LegalMoves, "b1e4") || slices.Contains(st.LegalMoves, "d6b5") {
+		t.Errorf("legal moves = %v", st.LegalMoves)
+	}
+
+	var apiErr apiError
+	if code := apiCall(t, s, "POST", "/games/1/moves", `{"from": "b1", "to": "c3"}`, &apiErr); code != http.StatusBadRequest || !strings.Contains(apiErr.Error, "Invalid move") {
+		t.Errorf("illegal move = %d %+v", code, apiErr)
+	}
+
+	for _, body := range []string{`{"from": "b1", "to": "e4"}`, `{"move": "d6b5"}`, `{"move": "e4e6"}`} {
+		if code := apiCall(t, s, "POST", "/games/1/moves", body, &st); code != http.StatusOK {
+			t.Fatalf("move %s = %d", body, code)
+		}
+	}
+	if st.Turn != "black" || st.Moves != 3 {
+		t.Errorf("after three moves = %+v", st)
+	}
+
+	if code := apiCall(t, s, "GET", "/games/1", "", &st); code != http.StatusOK || st.Board[0] != "....Tk" {
+		t.Errorf("get = %d %+v", code, st)
+	}
+
+	var record []apiMove
+	apiCall(t, s, "GET", "/games/1/moves", "", &record)
+	if len(record) != 3 || record[2] != (apiMove{Ply: 3, Move: "e4e6", Piece: "T", Captured: "t"}) {
+		t.Errorf("record = %+v", record)
+	}
+
+	if code := apiCall(t, s, "POST", "/games/1/resign", `{"side": "black"}`, &st); code != http.StatusOK || st.Result != "white" || len(st.LegalMoves) != 0 {
+		t.Errorf("resign = %d %+v", code, st)
+	}
+	if code := apiCall(t, s, "POST", "/games/1/moves", `{"move": "b5a3"}`, &apiErr); code != http.StatusConflict {
+		t.Errorf("move after the end = %d %+v", code, apiErr)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	s := newAPIServer(headlessTestConfig(t))
+
+	tests := []struct {
+		method, path, body string
+		expected           int
+	}{
+		{"POST", "/games", `{"width": 5, "height": 6}`, http.StatusBadRequest},
+		{"POST", "/games", `{"variant": "hexagonal"}`, http.StatusBadRequest},
+		{"POST", "/games", `{"variant": "fog"}`, http.StatusBadRequest},
+		{"POST", "/games", `{"variant": "mate", "width": 13}`, http.StatusBadRequest},
+		{"POST", "/games", `{"clock": -1}`, http.StatusBadRequest},
+		{"POST", "/games", `not json`, http.StatusBadRequest},
+		{"GET", "/games/7", "", http.StatusNotFound},
+		{"POST", "/games", "", http.StatusCreated},
+		{"POST", "/games/1/resign", `{"side": "red"}`, http.StatusBadRequest},
+		{"POST", "/games/1/moves", `{"move": "z9"}`, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		var out map[string]any
+		if code := apiCall(t, s, test.method, test.path, test.body, &out); code != test.expected {
+			t.Errorf("%s %s %s = %d %v; want %d", test.method, test.path, test.body, code, out, test.expected)
+		}
+	}
+}
+
+func TestAPIClock(t *testing.T) {
+	cfg := headlessTestConfig(t)
+	cfg.Clock = 1
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := newAPIServer(cfg)
+	s.now = func() time.Time { return now }
+
+	var st apiGameState
+	apiCall(t, s, "POST", "/games", "", &st)
+	if st.Clock == nil || st.Clock.WhiteMS != 60000 || st.Clock.Running != "white" {
+		t.Fatalf("clock = %+v", st.Clock)
+	}
+
+	now = now.Add(20 * time.Second)
+	apiCall(t, s, "POST", "/games/1/moves", `{"move": "b1e4"}`, &st)
+	if st.Clock.WhiteMS != 40000 || st.Clock.BlackMS != 60000 || st.Clock.Running != "black" {
+		t.Errorf("clock after White's move = %+v", st.Clock)
+	}
+
+	// Black runs out of time
+	now = now.Add(61 * time.Second)
+	st = apiGameState{}
+	apiCall(t, s, "GET", "/games/1", "", &st)
+	if st.Result != "white" || st.Clock.BlackMS != 0 || st.Clock.Running != "" {
+		t.Errorf("after the flag fell: result %q, clock %+v", st.Result, st.Clock)
+	}
+
+	var untimed apiGameState
+	apiCall(t, s, "POST", "/games", `{"clock": 0}`, &untimed)
+	if untimed.Clock != nil {
+		t.Errorf("clock 0 should create an untimed game, got %+v", untimed.Clock)
+	}
+}
+
+func TestAPIConcurrentGames(t *testing.T) {
+	s := newAPIServer(headlessTestConfig(t))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var st apiGameState
+			apiCall(t, s, "POST", "/games", "", &st)
+			for _, mv := range []string{"b1e4", "d6b5"} {
+				apiCall(t, s, "POST", "/games/"+st.ID+"/moves", `{"move": "`+mv+`"}`, nil)
+			}
+			apiCall(t, s, "GET", "/games", "", nil)
+		}()
+	}
+	wg.Wait()
+
+	var games []apiGameSummary
+	apiCall(t, s, "GET", "/games", "", &games)
+	if len(games) != 8 {
+		t.Fatalf("listed %d games; want 8", len(games))
+	}
+	for i, g := range games {
+		if g.Moves != 2 || g.ID != strconv.Itoa(i+1) {
+			t.Errorf("game %d = %+v", i, g)
+		}
+	}
+
+	// games created in the same second keep their own history
+	for _, g := range games {
+		stored, _ := s.store.get(g.ID)
+		data, err := os.ReadFile(stored.m.logFile)
+		if !strings.Contains(stored.m.logFile, "game_api"+g.ID+"_") || err != nil || strings.Count(string(data), "Game started") != 1 {
+			t.Errorf("game %s history %s: %q, %v", g.ID, stored.m.logFile, data, err)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+/*
+ * Capture effects. By default a capture simply replaces the captured piece,
+ * but a variant can choose what else a capture does:
+ *
+ *   - atomic: the capture explodes, removing the capturing piece and every
+ *     piece next to the square except pieces that only move forwards. A
+ *     move may not blow up its own King, and blowing up the other King
+ *     wins, so atomic is played with king_capture.
+ *   - convert: the captured piece changes sides and stays where it stood,
+ *     while the capturing piece goes back to the square it came from.
+ *   - drops: captured pieces go to the capturer's hand, and instead of
+ *     moving a player may drop a piece from their hand on any empty square
+ *     with "drop H@e4". Pieces that only move forwards cannot be dropped
+ *     where they would promote or never move again. Machine players
+ *     never drop.
+ *
+ * The effect is worked out when a move is recorded and kept in the record
+ * as the squares it changed, so play and unplay replay and revert it
+ * exactly, for undo and in the search alike.
+ */
+
+const captureReplace = "replace"
+const captureAtomic = "atomic"
+const captureConvert = "convert"
+const captureDrops = "drops"
+
+const ownKingCaptureMsg = "\n\nThat capture would take your own King with it.\n"
+const noDropMsg = "\n\nYou have no such piece to drop there.\n"
+const dropUsageMsg = "\n\nUsage: drop <piece>@<square> (e.g. drop H@e4)\n"
+const handsMsg = "Hands: White %s, Black %s\n"
+
+// squareChange is a square a capture effect changed after the move itself,
+// from before to after; 0 stands for an empty square.
+type squareChange struct {
+	sq            [2]int
+	before, after rune
+}
+
+// set puts piece on a square, or empties it when piece is 0.
+func (t table) set(sq [2]int, piece rune) {
+	if piece == 0 {
+		delete(t, sq)
+		return
+	}
+
+	t[sq] = piece
+}
+
+// captureEffect adds to r, a capture about to be played on t, the squares
+// its effect changes.
+type captureEffect func(t table, b Board, r *moveRecord)
+
+// captureEffectsByName holds the effect of each capture mode; a plain
+// replace and drops, which only fill the hands, change no other square.
+var captureEffectsByName = map[string]captureEffect{
+	captureReplace: nil,
+	captureAtomic:  explode,
+	captureConvert: convert,
+	captureDrops:   nil,
+}
+
+// captureEffects records the effect of the variant's capture mode when r
+// captures.
+func (v *variant) captureEffects(t table, b Board, r *moveRecord) {
+	if effect := captureEffectsByName[v.Capture]; effect != nil && isCapture(r.captured) {
+		effect(t, b, r)
+	}
+}
+
+// explode removes the capturing piece and its neighbours, pawn-like pieces
+// and holes excepted.
+func explode(t table, b Board, r *moveRecord) {
+	after := t.clone()
+	after.play(*r)
+
+	centre := [2]int{r.mv.toCol, r.mv.toRow}
+	r.effects = append(r.effects, squareChange{centre, after[centre], 0})
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			col, row, ok := b.wrap(centre[0]+dx, centre[1]+dy)
+			sq := [2]int{col, row}
+			if !ok || sq == centre {
+				continue
+			}
+			if info, isPiece := pieces[after[sq]]; isPiece && !info.irreversible {
+				r.effects = append(r.effects, squareChange{sq, after[sq], 0})
+			}
+		}
+	}
+}
+
+// convert sends the capturing piece back and turns the captured piece over
+// to its side, on the square it was captured on.
+func convert(t table, b Board, r *moveRecord) {
+	arrived := r.piece
+	if r.promoted != 0 {
+		arrived = r.promoted
+	}
+	from, to, at := [2]int{r.mv.fromCol, r.mv.fromRow}, [2]int{r.mv.toCol, r.mv.toRow}, r.capturedAt()
+	switched := sidePiece(string(pieces[r.captured].def.letter), isWhitePiece(r.piece))
+
+	r.effects = append(r.effects, squareChange{from, 0, r.piece})
+	if at != to {
+		r.effects = append(r.effects, squareChange{to, arrived, 0}, squareChange{at, 0, switched})
+	} else {
+		r.effects = append(r.effects, squareChange{to, arrived, switched})
+	}
+}
+
+// removesKing reports whether playing r leaves white's side without its
+// King, by capture or by the capture's effect.
+func (r moveRecord) removesKing(white bool) bool {
+	king := WhiteKing
+	if !white {
+		king = BlackKing
+	}
+
+	lost := 0
+	if r.captured == king {
+		lost++
+	}
+	for _, c := range r.effects {
+		if c.before == king {
+			lost++
+		}
+		if c.after == king {
+			lost--
+		}
+	}
+
+	return lost > 0
+}
+
+/*
+ * drops
+ */
+
+// hand lists the pieces white's side holds after history: one of its own
+// for each piece it captured, less those it dropped since.
+func hand(history []moveRecord, white bool) []rune {
+	var held []rune
+	for _, r := range history {
+		if isWhitePiece(r.piece) != white {
+			continue
+		}
+		switch {
+		case r.mv.isDrop():
+			if i := slices.Index(held, r.piece); i >= 0 {
+				held = slices.Delete(held, i, i+1)
+			}
+		case isCapture(r.captured):
+			held = append(held, sidePiece(string(pieces[r.captured].def.letter), white))
+		}
+	}
+
+	return held
+}
+
+// holdsPieces reports whether either side has a piece in hand to drop,
+// which is always a chance to capture the other King.
+func (m Model) holdsPieces() bool {
+	return m.rules().Capture == captureDrops && len(hand(m.moves, true))+len(hand(m.moves, false)) > 0
+}
+
+// dropMoves lists the drops open to white: each piece in hand on each empty
+// square where it neither promotes nor, moving only forwards, is stuck on
+// the last rank.
+func (v *variant) dropMoves(t table, b Board, white bool, history []moveRecord) []moveRecord {
+	held := hand(history, white)
+	slices.Sort(held)
+
+	lastRank := 0
+	if !white {
+		lastRank = b.Height - 1
+	}
+
+	var moves []moveRecord
+	for _, piece := range slices.Compact(held) {
+		info := pieces[piece]
+		for row := 0; row < b.Height; row++ {
+			if len(v.promotions(piece, row, b)) > 0 || (info.irreversible && row == lastRank) {
+				continue
+			}
+			for col := 0; col < b.Width; col++ {
+				if isEmptySquare(getCellValue(col, row, t)) {
+					moves = append(moves, moveRecord{mv: dropMove(info.def.letter, col, row), piece: piece})
+				}
+			}
+		}
+	}
+
+	return moves
+}
+
+// dropPiece plays a drop of the piece with the given letter from the hand
+// of the side to move, validated like movePiece validates moves.
+func dropPiece(letter, to string, m Model) (Model, string) {
+	if len(letter) != 1 || !unicode.IsLetter(rune(letter[0])) || !validateCoordinate(to, m) {
+		return m, dropUsageMsg
+	}
+	col, row := coordinateToPosition(to, m.Board.Height)
+
+	rules := m.rules()
+	mv := dropMove(unicode.ToUpper(rune(letter[0])), col, row)
+	i := slices.IndexFunc(rules.specialMoves(m.Table, m.Board, m.isWhiteTurn, m.moves), func(r moveRecord) bool {
+		return r.mv == mv
+	})
+	if i < 0 {
+		return m, noDropMsg
+	}
+	record := rules.record(m.Table, m.Board, m.isWhiteTurn, mv, m.moves)
+
+	if rules.wins(winCheckmate) && leavesKingAttacked(m.Table, m.Board, record, m.isWhiteTurn) {
+		return m, kingLeftInCheckMsg
+	}
+
+	return playRecord(m, record, formatDrop(m.config.Notation, record.piece, to))
+}
+
+// formatDrop describes a drop in the given notation style.
+func formatDrop(notation string, piece rune, to string) string {
+	to = strings.ToLower(to)
+
+	switch notation {
+	case "algebraic":
+		return fmt.Sprintf("%c@%s", glyph(piece), to)
+	case "coordinate":
+		return fmt.Sprintf("%c@%s", pieces[piece].def.letter, to)
+	}
+
+	return fmt.Sprintf("Dropped %c on %s.", glyph(piece), to)
+}
+
+// handsIndicator lists the pieces each side holds in games with drops. A
+// network guest has no moves to count and shows what the host sent.
+func handsIndicator(m Model) string {
+	if m.rules().Capture != captureDrops {
+		return ""
+	}
+	if m.net != nil && !m.net.host {
+		return m.net.hands
+	}
+
+	show := func(white bool) string {
+		held := hand(m.moves, white)
+		if len(held) == 0 {
+			return "-"
+		}
+		slices.Sort(held)
+		var s strings.Builder
+		for _, piece := range held {
+			s.WriteRune(glyph(piece))
+		}
+		return s.String()
+	}
+
+	return fmt.Sprintf(handsMsg, show(true), show(false))
+}
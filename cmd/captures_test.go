@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCaptureEffects(t *testing.T) {
+	tests := []struct {
+		variant string
+		fen     string
+		move    string
+		want    string
+	}{
+		{"chess", "4k3/8/8/2hbp3/8/8/8/3RK3 w", "d1d5", "4k3/8/8/2hRp3/8/8/8/4K3 b"},
+		// the Rook and the Horse go up with the Bishop; the pawn stays
+		{"atomic", "4k3/8/8/2hbp3/8/8/8/3RK3 w", "d1d5", "4k3/8/8/4p3/8/8/8/4K3 b"},
+		{"atomic", "4k3/8/8/8/8/8/8/4K3 w", "e1e2", "4k3/8/8/8/8/8/4K3/8 b"},
+		{"turncoat", "5k/6/6/2h3/6/KH4 w", "b1c3", "5k/6/6/2H3/6/KH4 b"},
+		{"turncoat", "5k/6/6/6/6/KH4 w", "b1c3", "5k/6/6/2H3/6/K5 b"},
+		// drops change no square beyond the move
+		{"crazyhouse", "4k3/8/8/3Pp3/8/8/8/4K3 w", "d5e6", "4k3/8/4P3/8/8/8/8/4K3 b"},
+	}
+
+	for _, test := range tests {
+		v, _ := knownVariant(test.variant)
+		tb, b, white, err := decodeFEN(test.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Topology = v.Topology
+		mv, _ := parseMoveText(test.move, b)
+		var history []moveRecord
+		if v.EnPassant {
+			// Black's pawn just stepped twice
+			history = []moveRecord{{mv: move{4, 1, 4, 3, 0}, piece: BlackPawn}}
+		}
+
+		r := v.record(tb, b, white, mv, history)
+		tb.play(r)
+		if got := encodeFEN(tb, b, !white); got != test.want {
+			t.Errorf("%s %s: %s; want %s", test.variant, test.move, got, test.want)
+		}
+		tb.unplay(r)
+		if got := encodeFEN(tb, b, white); got != test.fen {
+			t.Errorf("%s %s undone: %s", test.variant, test.move, got)
+		}
+	}
+}
+
+func TestConvertEnPassant(t *testing.T) {
+	v := &variant{Capture: captureConvert}
+	tb, b, _, _ := decodeFEN("4k3/8/8/3Pp3/8/8/8/4K3 w")
+	r := moveRecord{mv: move{3, 3, 4, 2, 0}, piece: WhitePawn, captured: BlackPawn, enPassant: true}
+	v.captureEffects(tb, b, &r)
+
+	tb.play(r)
+	if got := encodeFEN(tb, b, false); got != "4k3/8/8/3PP3/8/8/8/4K3 b" {
+		t.Errorf("after = %s", got)
+	}
+	tb.unplay(r)
+	if got := encodeFEN(tb, b, true); got != "4k3/8/8/3Pp3/8/8/8/4K3 w" {
+		t.Errorf("undone = %s", got)
+	}
+}
+
+func TestAtomicKings(t *testing.T) {
+	tests := []struct {
+		fen    string
+		move   string
+		msg    string
+		result gameResult
+	}{
+		{"4k3/8/8/8/8/8/3p4/3RK3 w", "d1d2", ownKingCaptureMsg, resultNone},
+		{"4k3/8/8/8/8/8/4p3/4K3 w", "e1e2", ownKingCaptureMsg, resultNone},
+		{"4k3/4p3/8/8/8/8/8/4RK2 w", "e1e7", "", resultWhiteWins},
+	}
+
+	for _, test := range tests {
+		m := variantGame(t, "atomic", Board{Width: 8, Height: 8}, test.fen)
+		m, msg := movePiece(test.move[:2], test.move[2:], m)
+		if msg != test.msg || m.result != test.result {
+			t.Errorf("%s %s: message %q, result %v; want %q, %v", test.fen, test.move, msg, m.result, test.msg, test.result)
+		}
+	}
+
+	// the search never blows up its own King
+	v, _ := knownVariant("atomic")
+	tb, b, _, _ := decodeFEN("4k3/8/8/8/8/8/3p4/3RK3 w")
+	for _, mv := range v.generateMoves(tb, b, true) {
+		if mv.toCol == 3 && mv.toRow == 6 {
+			t.Errorf("%s blows up White's King", moveText(mv, b.Height))
+		}
+	}
+	if _, ok := search(context.Background(), v, tb, b, true, searchLimits{depth: 3}, nil); !ok {
+		t.Error("no move found")
+	}
+}
+
+func TestConvertSearch(t *testing.T) {
+	// captured pieces stay on the board, so the capture search must stop
+	v, _ := knownVariant("turncoat")
+	b := Board{Width: 6, Height: 6}
+	if _, ok := search(context.Background(), v, v.initialTable(b.Width, b.Height), b, true, searchLimits{depth: 3}, nil); !ok {
+		t.Error("no move found")
+	}
+}
+
+func TestDrops(t *testing.T) {
+	m := variantGame(t, "crazyhouse", Board{Width: 8, Height: 8}, "4k3/8/8/8/8/8/3p4/4K3 w", "e1d2", "e8e7")
+	if got := hand(m.moves, true); !slices.Equal(got, []rune{WhitePawn}) {
+		t.Fatalf("White's hand = %q", got)
+	}
+	if got := turnIndicator(m); !strings.Contains(got, "Hands: White ♙, Black -") {
+		t.Errorf("turn indicator = %q", got)
+	}
+
+	tests := []struct {
+		command string
+		msg     string
+	}{
+		{"drop h@d4", noDropMsg},
+		{"drop p@d8", noDropMsg}, // a pawn would promote there
+		{"drop p@d2", noDropMsg}, // where the King stands
+		{"drop p", dropUsageMsg},
+	}
+	for _, test := range tests {
+		_, outcome := runCommand(m, test.command)
+		if outcome.message != test.msg {
+			t.Errorf("%s: message %q; want %q", test.command, outcome.message, test.msg)
+		}
+	}
+
+	m, _ = runCommand(m, "drop p@d4")
+	if got := m.fen(); got != "8/4k3/8/8/3P4/8/3K4/8 b" {
+		t.Errorf("after the drop: %s", got)
+	}
+	if got := hand(m.moves, true); len(got) != 0 {
+		t.Errorf("White still holds %q", got)
+	}
+	if got := moveText(m.moves[len(m.moves)-1].mv, m.Board.Height); got != "P@d4" {
+		t.Errorf("move text = %s", got)
+	}
+	if mv, ok := parseMoveText("P@d4", m.Board); !ok || mv != dropMove('P', 3, 4) {
+		t.Errorf("parsed %v, %v", mv, ok)
+	}
+
+	m, _ = undoMove(m)
+	if got := m.fen(); got != "8/4k3/8/8/8/8/3K4/8 w" || len(hand(m.moves, true)) != 1 {
+		t.Errorf("after undo: %s, hand %q", got, hand(m.moves, true))
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import "slices"
+
+/*
+ * Special moves. Variants can let the King castle with a partner piece and
+ * let pawn-like pieces take en passant, as in standard chess. Both depend
+ * on the game's history, so they are found here rather than from the
+ * pieces' Betza rules, and the search does not play them.
+ *
+ * Castling needs the King and the partner on their layout squares without
+ * either having moved, nothing between them, and the King neither in check
+ * nor passing over an attacked square. The King moves two squares towards
+ * the partner, which lands on the square the King crossed.
+ *
+ * En passant is open right after a piece that only moves forwards made a
+ * two square step straight ahead: a piece beside it that captures onto the
+ * square it skipped may take it there, on the next move only.
+ */
+
+// play makes the recorded move on the table, with its promotion, en
+// passant capture or castling partner and the effects of a capture. A drop
+// puts the piece on its square.
+func (t table) play(r moveRecord) {
+	if r.mv.isDrop() {
+		t[[2]int{r.mv.toCol, r.mv.toRow}] = r.piece
+		return
+	}
+
+	t.apply(r.mv)
+	if r.promoted != 0 {
+		t[[2]int{r.mv.toCol, r.mv.toRow}] = r.promoted
+	}
+	if r.enPassant {
+		delete(t, [2]int{r.mv.toCol, r.mv.fromRow})
+	}
+	if r.castle != nil {
+		t.apply(*r.castle)
+	}
+	for _, c := range r.effects {
+		t.set(c.sq, c.after)
+	}
+}
+
+// unplay reverts play.
+func (t table) unplay(r moveRecord) {
+	if r.mv.isDrop() {
+		delete(t, [2]int{r.mv.toCol, r.mv.toRow})
+		return
+	}
+
+	for i := len(r.effects) - 1; i >= 0; i-- {
+		t.set(r.effects[i].sq, r.effects[i].before)
+	}
+	if r.castle != nil {
+		t.undo(*r.castle, 0)
+	}
+	if r.enPassant {
+		t.undo(r.mv, 0)
+		t[[2]int{r.mv.toCol, r.mv.fromRow}] = r.captured
+	} else {
+		t.undo(r.mv, r.captured)
+	}
+	if r.promoted != 0 {
+		t[[2]int{r.mv.fromCol, r.mv.fromRow}] = r.piece
+	}
+}
+
+// capturedAt returns the square of the piece r captured.
+func (r moveRecord) capturedAt() [2]int {
+	if r.enPassant {
+		return [2]int{r.mv.toCol, r.mv.fromRow}
+	}
+
+	return [2]int{r.mv.toCol, r.mv.toRow}
+}
+
+// record describes mv played by white's side on t: a special move when it
+// is one, else an ordinary move with its capture and promotion, and the
+// effects of a capture. The recorded move names the piece a promotion
+// chose.
+func (v *variant) record(t table, b Board, white bool, mv move, history []moveRecord) moveRecord {
+	for _, r := range v.specialMoves(t, b, white, history) {
+		if r.mv == mv {
+			v.captureEffects(t, b, &r)
+			return r
+		}
+	}
+
+	return v.plainRecord(t, b, mv)
+}
+
+// plainRecord is record for moves that are not special, which is all the
+// search plays.
+func (v *variant) plainRecord(t table, b Board, mv move) moveRecord {
+	piece := getCellValue(mv.fromCol, mv.fromRow, t)
+	r := moveRecord{
+		mv:       mv,
+		piece:    piece,
+		captured: t[[2]int{mv.toCol, mv.toRow}],
+		promoted: v.promotion(piece, mv.toRow, b, mv.promotion),
+	}
+	if r.promoted != 0 {
+		r.mv.promotion = pieces[r.promoted].def.letter
+	}
+	v.captureEffects(t, b, &r)
+
+	return r
+}
+
+// specialMoves lists the castling moves, en passant captures and drops
+// open to white, whether or not they leave the King attacked.
+func (v *variant) specialMoves(t table, b Board, white bool, history []moveRecord) []moveRecord {
+	var moves []moveRecord
+	if v.EnPassant {
+		moves = append(moves, v.enPassantMoves(t, b, white, history)...)
+	}
+	if v.Castling != "" {
+		moves = append(moves, v.castlingMoves(t, b, white, history)...)
+	}
+	if v.Capture == captureDrops {
+		moves = append(moves, v.dropMoves(t, b, white, history)...)
+	}
+
+	return moves
+}
+
+func (v *variant) enPassantMoves(t table, b Board, white bool, history []moveRecord) []moveRecord {
+	if len(history) == 0 {
+		return nil
+	}
+	last := history[len(history)-1]
+	info, ok := pieces[last.piece]
+	if !ok || !info.irreversible || info.white == white || last.promoted != 0 {
+		return nil
+	}
+	if last.mv.fromCol != last.mv.toCol || abs(last.mv.toRow-last.mv.fromRow) != 2 {
+		return nil
+	}
+
+	col, row := last.mv.toCol, last.mv.toRow
+	skipped := (last.mv.fromRow + row) / 2
+
+	var moves []moveRecord
+	for _, side := range []int{-1, 1} {
+		fromCol, _, _ := b.wrap(col+side, row)
+		piece := getCellValue(fromCol, row, t)
+		if !isOwnPiece(piece, white) {
+			continue
+		}
+		takes := slices.ContainsFunc(pieces[piece].rules, func(r moveRule) bool {
+			return r.captureOnly && !r.initial && r.reaches(t, b, fromCol, row, col, skipped)
+		})
+		if takes {
+			moves = append(moves, moveRecord{
+				mv:        move{fromCol, row, col, skipped, 0},
+				piece:     piece,
+				captured:  last.piece,
+				promoted:  v.promotion(piece, skipped, b, 0),
+				enPassant: true,
+			})
+		}
+	}
+
+	return moves
+}
+
+func (v *variant) castlingMoves(t table, b Board, white bool, history []moveRecord) []moveRecord {
+	king := BlackKing
+	if white {
+		king = WhiteKing
+	}
+	partner, _ := pieceByLetter(v.Castling)
+	if !white {
+		partner = pieces[partner].def.black
+	}
+
+	// the King and its partners must stand where the layout put them and
+	// never have left
+	start := v.initialTable(b.Width, b.Height)
+	moved := func(sq [2]int) bool {
+		return slices.ContainsFunc(history, func(r moveRecord) bool {
+			return sq == [2]int{r.mv.fromCol, r.mv.fromRow} || sq == [2]int{r.mv.toCol, r.mv.toRow}
+		})
+	}
+	var kingSq [2]int
+	var partners [][2]int
+	for sq, piece := range start {
+		switch {
+		case piece == king:
+			kingSq = sq
+		case piece == partner:
+			partners = append(partners, sq)
+		}
+	}
+	if t[kingSq] != king || moved(kingSq) || kingAttacked(t, b, white) {
+		return nil
+	}
+
+	var moves []moveRecord
+	for _, sq := range partners {
+		if t[sq] != partner || sq[1] != kingSq[1] || abs(sq[0]-kingSq[0]) < 3 || moved(sq) {
+			continue
+		}
+		dir := 1
+		if sq[0] < kingSq[0] {
+			dir = -1
+		}
+		if !v.castlingPathClear(t, b, white, kingSq, sq, dir) {
+			continue
+		}
+
+		row := kingSq[1]
+		moves = append(moves, moveRecord{
+			mv:     move{kingSq[0], row, kingSq[0] + 2*dir, row, 0},
+			piece:  king,
+			castle: &move{sq[0], row, kingSq[0] + dir, row, 0},
+		})
+	}
+
+	return moves
+}
+
+// castlingPathClear checks that nothing stands between the King and the
+// partner and that no square the King crosses or lands on is attacked.
+func (v *variant) castlingPathClear(t table, b Board, white bool, kingSq, partnerSq [2]int, dir int) bool {
+	for col := kingSq[0] + dir; col != partnerSq[0]; col += dir {
+		if !isEmptySquare(getCellValue(col, kingSq[1], t)) {
+			return false
+		}
+	}
+
+	for step := 1; step <= 2; step++ {
+		probe := t.clone()
+		probe.apply(move{kingSq[0], kingSq[1], kingSq[0] + step*dir, kingSq[1], 0})
+		if kingAttacked(probe, b, white) {
+			return false
+		}
+	}
+
+	return true
+}
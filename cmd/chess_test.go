@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChessStart(t *testing.T) {
+	m := variantGame(t, "chess", Board{Width: 8, Height: 8}, "")
+	if got := m.fen(); got != "rhbqkbhr/pppppppp/8/8/8/8/PPPPPPPP/RHBQKBHR w" {
+		t.Errorf("start = %s", got)
+	}
+	if got := glyph(WhiteRook); got != '♖' {
+		t.Errorf("Rook drawn as %c", got)
+	}
+}
+
+func TestChessPawns(t *testing.T) {
+	tests := []struct {
+		name     string
+		fen      string
+		from, to string
+		msg      string
+	}{
+		{"double step", "", "e2", "e4", ""},
+		{"single step", "", "e2", "e3", ""},
+		{"triple step", "", "e2", "e5", invalidMoveMsg},
+		{"double step off the second rank", "4k3/8/8/8/8/4P3/8/4K3 w", "e3", "e5", invalidMoveMsg},
+		{"blocked double step", "4k3/8/8/8/8/4h3/4P3/4K3 w", "e2", "e4", invalidMoveMsg},
+		{"straight capture", "4k3/8/8/8/8/4h3/4P3/4K3 w", "e2", "e3", invalidMoveMsg},
+		{"diagonal capture", "4k3/8/8/8/8/3h4/4P3/4K3 w", "e2", "d3", ""},
+	}
+
+	for _, test := range tests {
+		m := variantGame(t, "chess", Board{Width: 8, Height: 8}, test.fen)
+		if _, msg := movePiece(test.from, test.to, m); msg != test.msg {
+			t.Errorf("%s: message %q; want %q", test.name, msg, test.msg)
+		}
+	}
+}
+
+func TestEnPassant(t *testing.T) {
+	m := variantGame(t, "chess", Board{Width: 8, Height: 8}, "", "e2e4", "a7a6", "e4e5", "d7d5", "e5d6")
+	if got := m.fen(); got != "rhbqkbhr/1pp1pppp/p2P4/8/8/8/PPPP1PPP/RHBQKBHR b" {
+		t.Errorf("after en passant: %s", got)
+	}
+	m, _ = undoMove(m)
+	if got := m.fen(); got != "rhbqkbhr/1pp1pppp/p7/3pP3/8/8/PPPP1PPP/RHBQKBHR w" {
+		t.Errorf("after undo: %s", got)
+	}
+
+	// the chance is gone after another move
+	m = variantGame(t, "chess", Board{Width: 8, Height: 8}, "", "e2e4", "a7a6", "e4e5", "d7d5", "a2a3", "a6a5")
+	if _, msg := movePiece("e5", "d6", m); msg != invalidMoveMsg {
+		t.Errorf("late en passant: message %q", msg)
+	}
+}
+
+func TestCastling(t *testing.T) {
+	tests := []struct {
+		name     string
+		fen      string
+		from, to string
+		want     string // position after the move, "" when it is refused
+	}{
+		{"king side", "r3k2r/8/8/8/8/8/8/R3K2R w", "e1", "g1", "r3k2r/8/8/8/8/8/8/R4RK1 b"},
+		{"queen side", "r3k2r/8/8/8/8/8/8/R3K2R w", "e1", "c1", "r3k2r/8/8/8/8/8/8/2KR3R b"},
+		{"black", "r3k2r/8/8/8/8/8/8/R3K2R b", "e8", "g8", "r4rk1/8/8/8/8/8/8/R3K2R w"},
+		{"blocked", "r3k2r/8/8/8/8/8/8/RH2K2R w", "e1", "c1", ""},
+		{"through check", "r3kr2/8/8/8/8/8/8/R3K2R w", "e1", "g1", ""},
+		{"out of check", "r3k2r/8/8/8/8/8/8/R3K1rR w", "e1", "c1", ""},
+		{"rook away", "r3k2r/8/8/8/8/8/8/1R2K2R w", "e1", "c1", ""},
+	}
+
+	for _, test := range tests {
+		m := variantGame(t, "chess", Board{Width: 8, Height: 8}, test.fen)
+		m, msg := movePiece(test.from, test.to, m)
+		if test.want == "" {
+			if msg == "" {
+				t.Errorf("%s: castled to %s", test.name, m.fen())
+			}
+			continue
+		}
+		if msg != "" || m.fen() != test.want {
+			t.Errorf("%s: message %q, position %s; want %s", test.name, msg, m.fen(), test.want)
+		}
+		if m, _ = undoMove(m); m.fen() != test.fen {
+			t.Errorf("%s: after undo %s", test.name, m.fen())
+		}
+	}
+
+	// a King that has moved and come back has lost the right
+	m := variantGame(t, "chess", Board{Width: 8, Height: 8}, "r3k2r/8/8/8/8/8/8/R3K2R w", "e1f1", "a8b8", "f1e1", "b8a8")
+	if _, msg := movePiece("e1", "g1", m); msg == "" {
+		t.Errorf("castled after the King moved")
+	}
+}
+
+func TestChessPromotionAndMate(t *testing.T) {
+	m := variantGame(t, "chess", Board{Width: 8, Height: 8}, "4k3/P7/8/8/8/8/8/4K3 w", "a7a8")
+	if got := m.fen(); got != "Q3k3/8/8/8/8/8/8/4K3 b" {
+		t.Errorf("after promotion: %s", got)
+	}
+	if !strings.Contains(m.Body.String(), checkIndicator) {
+		t.Errorf("the check is not shown:\n%s", m.Body.String())
+	}
+
+	m = variantGame(t, "chess", Board{Width: 8, Height: 8}, "", "f2f3", "e7e5", "g2g4", "d8h4")
+	if m.result != resultBlackWins || m.endReason != "Checkmate. Black wins!" {
+		t.Errorf("fool's mate: result %v, reason %q", m.result, m.endReason)
+	}
+	if rec := m.gameRecord(); rec.Variant != "chess" || len(rec.Moves) != 4 {
+		t.Errorf("record = %+v", rec)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"time"
+)
+
+// gameClock counts down the thinking time of both sides. Index 0 is White
+// and 1 is Black, as in Model.players.
+type gameClock struct {
+	remaining [2]time.Duration
+	running   int
+	since     time.Time
+	stopped   bool
+}
+
+// newGameClock starts White's clock with the given minutes per side, or
+// returns nil for untimed games.
+func newGameClock(minutes int, now time.Time) *gameClock {
+	if minutes <= 0 {
+		return nil
+	}
+
+	total := time.Duration(minutes) * time.Minute
+	return &gameClock{remaining: [2]time.Duration{total, total}, since: now}
+}
+
+func sideIndex(white bool) int {
+	if white {
+		return 0
+	}
+
+	return 1
+}
+
+// left returns the time a side has left at now, never below zero.
+func (c *gameClock) left(side int, now time.Time) time.Duration {
+	left := c.remaining[side]
+	if side == c.running && !c.stopped {
+		left -= now.Sub(c.since)
+	}
+
+	return max(left, 0)
+}
+
+// press ends the running side's turn and starts the other side's clock.
+func (c *gameClock) press(now time.Time) {
+	if c.stopped {
+		return
+	}
+
+	c.remaining[c.running] = c.left(c.running, now)
+	c.running = 1 - c.running
+	c.since = now
+}
+
+// flagged reports whether the running side has run out of time.
+func (c *gameClock) flagged(now time.Time) bool {
+	return !c.stopped && c.left(c.running, now) == 0
+}
+
+func (c *gameClock) stop(now time.Time) {
+	if c.stopped {
+		return
+	}
+
+	c.remaining[c.running] = c.left(c.running, now)
+	c.stopped = true
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+)
+
+// commandOutcome reports what running a typed command did, so the same
+// parsing can drive both the Bubble Tea UI and headless mode.
+type commandOutcome struct {
+	message string // text to show the player, if any
+	failed  bool   // the command was rejected and the game did not change
+	quit    bool   // the player asked to leave the game
+}
+
+// runCommand parses one line of input and applies it to the game.
+func runCommand(m Model, input string) (Model, commandOutcome) {
+	fields := strings.Fields(strings.ToLower(input))
+	if len(fields) == 0 {
+		return m, commandOutcome{message: invalidCommandMsg, failed: true}
+	}
+
+	if m.phase == phaseEditing {
+		if m, outcome, handled := runEditorCommand(m, fields); handled {
+			return m, outcome
+		}
+	}
+	if m.phase == phaseFinished || m.phase == phaseReviewing {
+		if m, outcome, handled := runGameOverCommand(m, fields, input); handled {
+			return m, outcome
+		}
+	}
+	if m.phase == phasePlaying && m.fourPlayer() {
+		if m, outcome, handled := runFourPlayerCommand(m, fields); handled {
+			return m, outcome
+		}
+	}
+
+	switch fields[0] {
+	case "restart":
+		if m.net != nil {
+			return m, commandOutcome{message: networkRestartMsg, failed: true}
+		}
+		return resetGame(m), commandOutcome{}
+
+	case "exit":
+		if m.logFile != "" {
+			writeToHistory(gameEndedMsg, m.logFile)
+		}
+		return m, commandOutcome{quit: true}
+
+	case "help", "h":
+		return m, commandOutcome{message: helpMessage}
+
+	case "edit":
+		if m.net != nil || len(m.moves) > 0 {
+			return m, commandOutcome{message: editNotAllowedMsg, failed: true}
+		}
+		return enterEditor(m), commandOutcome{}
+
+	case "move", "mv", "drop":
+		if fields[0] == "drop" {
+			// a drop comes from the hand, written as the piece's letter and @
+			if len(fields) != 2 || !strings.Contains(fields[1], "@") {
+				return m, commandOutcome{message: dropUsageMsg, failed: true}
+			}
+			letter, square, _ := strings.Cut(fields[1], "@")
+			fields = []string{fields[0], letter + "@", square}
+		}
+		if len(fields) < 3 {
+			return m, commandOutcome{message: moveUsageMsg, failed: true}
+		}
+		if m.net != nil {
+			return runNetMove(m, fields[1], fields[2])
+		}
+		if m.sidePlayer() != nil {
+			return m, commandOutcome{message: waitForEngineMsg, failed: true}
+		}
+		m, msg := movePiece(fields[1], fields[2], m)
+		return m, commandOutcome{message: msg, failed: msg != ""}
+
+	case "resign", "offer", "draw", "accept", "decline":
+		if m.net != nil {
+			return runNetCommand(m, fields, input)
+		}
+		return runOfferCommand(m, fields)
+
+	case "chat", "undo":
+		return runNetCommand(m, fields, input)
+
+	default:
+		return m, commandOutcome{message: invalidCommandMsg, failed: true}
+	}
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Config holds the user defaults read from the config file at startup.
+// Flags given on the command line override the values loaded from disk.
+// Clock is the default for games created over the API; games in the
+// terminal are untimed.
+type Config struct {
+	Width       int               `toml:"width"`
+	Height      int               `toml:"height"`
+	Theme       string            `toml:"theme"`
+	Glyphs      string            `toml:"glyphs"`
+	HistoryDir  string            `toml:"history_dir"`
+	AILevel     int               `toml:"ai_level"`
+	Clock       int               `toml:"clock"`
+	Notation    string            `toml:"notation"`
+	MoveLimit   int               `toml:"move_limit"`
+	Start       string            `toml:"start"`
+	Variant     string            `toml:"variant"`
+	Keybindings map[string]string `toml:"keybindings"`
+}
+
+const appName = "small-chess"
+const configFileName = "config.toml"
+
+const minAILevel = 1
+const maxAILevel = 6
+
+const actionQuit = "quit"
+const actionSubmit = "submit"
+
+// configKeys lists every key accepted by `config set`, in display order.
+var configKeys = []string{"width", "height", "theme", "glyphs", "history_dir", "ai_level", "clock", "notation", "move_limit", "start", "variant"}
+
+var defaultKeybindings = map[string]string{
+	actionQuit:   "ctrl+c,esc",
+	actionSubmit: "enter",
+}
+
+var notationStyles = []string{"verbose", "algebraic", "coordinate"}
+
+func defaultConfig() Config {
+	return Config{
+		Theme:       "unicode",
+		Glyphs:      "unicode",
+		HistoryDir:  "history",
+		AILevel:     2,
+		Notation:    "verbose",
+		MoveLimit:   defaultMoveLimit,
+		Keybindings: map[string]string{},
+	}
+}
+
+/*
+ * loading and saving
+ */
+
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return configFileName
+	}
+
+	return filepath.Join(dir, appName, configFileName)
+}
+
+func loadConfig(path string) (Config, error) {
+	cfg, err := readConfig(path)
+	if err != nil {
+		return cfg, err
+	}
+
+	return cfg, cfg.validate()
+}
+
+// readConfig decodes the config file without validating it, so that
+// `config set` can repair a bad setting.
+func readConfig(path string) (Config, error) {
+	cfg := defaultConfig()
+
+	if _, err := toml.DecodeFile(path, &cfg); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return cfg, nil
+		}
+		return cfg, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	if cfg.Keybindings == nil {
+		cfg.Keybindings = map[string]string{}
+	}
+
+	return cfg, nil
+}
+
+func saveConfig(path string, cfg Config) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	return toml.NewEncoder(f).Encode(cfg)
+}
+
+/*
+ * validation and updates
+ */
+
+func (c Config) validate() error {
+	for _, key := range configKeys {
+		if err := c.set(key, c.get(key)); err != nil {
+			return err
+		}
+	}
+
+	for action, keys := range c.Keybindings {
+		if err := c.set("keybindings."+action, keys); err != nil {
+			return err
+		}
+	}
+	if err := c.checkKeys(); err != nil {
+		return err
+	}
+
+	return c.checkStart()
+}
+
+// checkKeys rejects a key bound to more than one action.
+func (c Config) checkKeys() error {
+	bound := map[string]string{}
+	for _, action := range sortedKeys(defaultKeybindings) {
+		for _, k := range strings.Split(c.keysFor(action), ",") {
+			k = strings.TrimSpace(k)
+			if other, ok := bound[k]; ok && other != action {
+				return fmt.Errorf("key %q is bound to both %s and %s", k, other, action)
+			}
+			bound[k] = action
+		}
+	}
+
+	return nil
+}
+
+func (c Config) get(key string) string {
+	switch key {
+	case "width":
+		return strconv.Itoa(c.Width)
+	case "height":
+		return strconv.Itoa(c.Height)
+	case "theme":
+		return c.Theme
+	case "glyphs":
+		return c.Glyphs
+	case "history_dir":
+		return c.HistoryDir
+	case "ai_level":
+		return strconv.Itoa(c.AILevel)
+	case "clock":
+		return strconv.Itoa(c.Clock)
+	case "notation":
+		return c.Notation
+	case "move_limit":
+		return strconv.Itoa(c.MoveLimit)
+	case "start":
+		return c.Start
+	case "variant":
+		return c.Variant
+	}
+
+	if action, ok := strings.CutPrefix(key, "keybindings."); ok {
+		return c.keysFor(action)
+	}
+
+	return ""
+}
+
+// set parses and validates value before storing it under key. A width or
+// height of 0 means the size is asked for at startup.
+func (c *Config) set(key, value string) error {
+	value = strings.TrimSpace(value)
+
+	switch key {
+	case "width", "height":
+		n, err := strconv.Atoi(value)
+		if err != nil || (n != 0 && (n < minBoardSize || n > maxBoardSize)) {
+			return fmt.Errorf("%s must be 0 or between %d and %d", key, minBoardSize, maxBoardSize)
+		}
+		if key == "width" {
+			c.Width = n
+		} else {
+			c.Height = n
+		}
+	case "theme":
+		if _, ok := themes[value]; !ok {
+			return fmt.Errorf("unknown theme %q (available: %s)", value, strings.Join(sortedKeys(themes), ", "))
+		}
+		c.Theme = value
+	case "glyphs":
+		if _, ok := glyphSets[value]; !ok {
+			return fmt.Errorf("unknown glyph set %q (available: %s)", value, strings.Join(sortedKeys(glyphSets), ", "))
+		}
+		c.Glyphs = value
+	case "history_dir":
+		if value == "" {
+			return fmt.Errorf("history_dir cannot be empty")
+		}
+		c.HistoryDir = value
+	case "ai_level":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < minAILevel || n > maxAILevel {
+			return fmt.Errorf("ai_level must be between %d and %d", minAILevel, maxAILevel)
+		}
+		c.AILevel = n
+	case "clock":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("clock must be a number of minutes per side for API games (0 for no clock)")
+		}
+		c.Clock = n
+	case "notation":
+		if !slices.Contains(notationStyles, value) {
+			return fmt.Errorf("unknown notation %q (available: %s)", value, strings.Join(notationStyles, ", "))
+		}
+		c.Notation = value
+	case "move_limit":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("move_limit must be a number of moves without a capture (0 for no limit)")
+		}
+		c.MoveLimit = n
+	case "start":
+		if _, err := parseStartSpec(value); err != nil {
+			return err
+		}
+		c.Start = value
+	case "variant":
+		if _, err := loadVariant(value); err != nil {
+			return err
+		}
+		c.Variant = value
+	default:
+		action, ok := strings.CutPrefix(key, "keybindings.")
+		if !ok {
+			return fmt.Errorf("unknown config key %q", key)
+		}
+		if _, known := defaultKeybindings[action]; !known {
+			return fmt.Errorf("unknown key action %q", action)
+		}
+		if value == "" {
+			return fmt.Errorf("%s needs at least one key", key)
+		}
+		if action == actionQuit {
+			// a key that types a character would quit in the middle of a move
+			for _, k := range strings.Split(value, ",") {
+				k = strings.TrimSpace(k)
+				if r, size := utf8.DecodeRuneInString(k); size > 0 && size == len(k) && unicode.IsPrint(r) {
+					return fmt.Errorf("%s cannot be %q, a key used for typing", key, k)
+				}
+			}
+		}
+		if c.Keybindings == nil {
+			c.Keybindings = map[string]string{}
+		}
+		c.Keybindings[action] = value
+	}
+
+	return nil
+}
+
+// keysFor returns the comma separated key names bound to action.
+func (c Config) keysFor(action string) string {
+	if keys, ok := c.Keybindings[action]; ok {
+		return keys
+	}
+
+	return defaultKeybindings[action]
+}
+
+// keyAction maps a key name as reported by tea.KeyMsg.String() to its action.
+func (c Config) keyAction(key string) string {
+	for action := range defaultKeybindings {
+		for _, k := range strings.Split(c.keysFor(action), ",") {
+			if strings.TrimSpace(k) == key {
+				return action
+			}
+		}
+	}
+
+	return ""
+}
+
+func (c Config) historyDir() string {
+	if c.HistoryDir == "" {
+		return "history"
+	}
+
+	return c.HistoryDir
+}
+
+/*
+ * command line
+ */
+
+// bindConfigFlags registers one flag per config key. Flag names use dashes
+// where the config keys use underscores.
+func bindConfigFlags(fs *flag.FlagSet) *string {
+	for _, key := range configKeys {
+		fs.String(strings.ReplaceAll(key, "_", "-"), "", fmt.Sprintf("override the %q config setting", key))
+	}
+
+	return fs.String("config", defaultConfigPath(), "path to the config file")
+}
+
+// applyConfigFlags copies every flag explicitly given on the command line
+// into cfg.
+func applyConfigFlags(fs *flag.FlagSet, cfg *Config) error {
+	var err error
+
+	fs.Visit(func(f *flag.Flag) {
+		key := strings.ReplaceAll(f.Name, "-", "_")
+		if err != nil || !slices.Contains(configKeys, key) {
+			return
+		}
+		err = cfg.set(key, f.Value.String())
+	})
+	if err != nil {
+		return err
+	}
+
+	return cfg.checkStart()
+}
+
+// runConfigCommand implements `config` (show the effective settings) and
+// `config set <key> <value>` (persist a setting to the config file).
+func runConfigCommand(args []string, path string, effective Config, out io.Writer) error {
+	if len(args) == 0 {
+		printConfig(effective, path, out)
+		return nil
+	}
+
+	if args[0] != "set" || len(args) != 3 {
+		return fmt.Errorf("usage: config [set <key> <value>]")
+	}
+
+	cfg, err := readConfig(path)
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.set(args[1], args[2]); err != nil {
+		return err
+	}
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	if err := saveConfig(path, cfg); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "%s = %s\n", args[1], cfg.get(args[1]))
+
+	return nil
+}
+
+func printConfig(cfg Config, path string, out io.Writer) {
+	fmt.Fprintf(out, "# %s\n", path)
+
+	for _, key := range configKeys {
+		fmt.Fprintf(out, "%s = %s\n", key, cfg.get(key))
+	}
+
+	for _, action := range sortedKeys(defaultKeybindings) {
+		fmt.Fprintf(out, "keybindings.%s = %s\n", action, cfg.keysFor(action))
+	}
+}
+
+func sortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	return slices.Sorted(maps.Keys(m))
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigSet(t *testing.T) {
+	tests := []struct {
+		key, value string
+		valid      bool
+	}{
+		{"width", "8", true},
+		{"width", "0", true},
+		{"width", "26", true},
+		{"width", "27", false},
+		{"height", "x", false},
+		{"theme", "ascii", true},
+		{"theme", "neon", false},
+		{"glyphs", "letters", true},
+		{"history_dir", "", false},
+		{"ai_level", "3", true},
+		{"ai_level", "0", false},
+		{"clock", "5", true},
+		{"clock", "-1", false},
+		{"notation", "algebraic", true},
+		{"notation", "pgn", false},
+		{"keybindings.quit", "ctrl+q", true},
+		{"keybindings.quit", "q", false},
+		{"keybindings.quit", "esc,é", false},
+		{"keybindings.fly", "f", false},
+		{"colour", "red", false},
+		{"start", "shuffle 42 +2", true},
+		{"start", "shuffle +4", false},
+		{"variant", "mate", true},
+		{"variant", "no-such-variant", false},
+	}
+
+	for _, test := range tests {
+		cfg := defaultConfig()
+		err := cfg.set(test.key, test.value)
+		if (err == nil) != test.valid {
+			t.Errorf("set(%q, %q) error = %v; want valid %v", test.key, test.value, err, test.valid)
+		}
+		if err == nil && cfg.get(test.key) != test.value {
+			t.Errorf("get(%q) = %q after set; want %q", test.key, cfg.get(test.key), test.value)
+		}
+	}
+}
+
+func TestConfigSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), appName, configFileName)
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig on missing file: %v", err)
+	}
+	if cfg.Theme != "unicode" || cfg.HistoryDir != "history" {
+		t.Errorf("missing file should load defaults, got %+v", cfg)
+	}
+
+	var out strings.Builder
+	if err := runConfigCommand([]string{"set", "width", "10"}, path, cfg, &out); err != nil {
+		t.Fatalf("config set: %v", err)
+	}
+	if err := runConfigCommand([]string{"set", "keybindings.submit", "enter,ctrl+j"}, path, cfg, &out); err != nil {
+		t.Fatalf("config set: %v", err)
+	}
+
+	cfg, err = loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.Width != 10 {
+		t.Errorf("Width = %d; want 10", cfg.Width)
+	}
+	if got := cfg.keyAction("ctrl+j"); got != actionSubmit {
+		t.Errorf("keyAction(ctrl+j) = %q; want %q", got, actionSubmit)
+	}
+	if got := cfg.keyAction("esc"); got != actionQuit {
+		t.Errorf("keyAction(esc) = %q; want default %q", got, actionQuit)
+	}
+}
+
+func TestConfigSetChecksWholeFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), configFileName)
+	if err := os.WriteFile(path, []byte("theme = \"neon\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path); err == nil {
+		t.Fatal("loadConfig accepted an unknown theme")
+	}
+
+	var out strings.Builder
+	if err := runConfigCommand([]string{"set", "width", "8"}, path, defaultConfig(), &out); err == nil {
+		t.Error("config set saved a file that is still invalid")
+	}
+	if err := runConfigCommand([]string{"set", "theme", "ascii"}, path, defaultConfig(), &out); err != nil {
+		t.Fatalf("config set could not repair the theme: %v", err)
+	}
+	if cfg, err := loadConfig(path); err != nil || cfg.Theme != "ascii" {
+		t.Errorf("after the repair: theme %q, error %v", cfg.Theme, err)
+	}
+
+	for _, keys := range []string{"enter,esc", "ctrl+c"} {
+		if err := runConfigCommand([]string{"set", "keybindings.submit", keys}, path, defaultConfig(), &out); err == nil {
+			t.Errorf("config set bound %q to both quit and submit", keys)
+		}
+	}
+	if err := runConfigCommand([]string{"set", "keybindings.quit", "ctrl+q"}, path, defaultConfig(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := runConfigCommand([]string{"set", "keybindings.submit", "enter,esc"}, path, defaultConfig(), &out); err != nil {
+		t.Errorf("esc is free once quit moves to ctrl+q: %v", err)
+	}
+}
+
+func TestApplyConfigFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	bindConfigFlags(fs)
+
+	if err := fs.Parse([]string{"-height", "7", "-history-dir", "games", "config"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := defaultConfig()
+	cfg.Width = 9
+	if err := applyConfigFlags(fs, &cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Width != 9 || cfg.Height != 7 || cfg.HistoryDir != "games" {
+		t.Errorf("flags not applied correctly: %+v", cfg)
+	}
+	if fs.Arg(0) != "config" {
+		t.Errorf("subcommand = %q; want config", fs.Arg(0))
+	}
+}
+
+func TestFormatMove(t *testing.T) {
+	tests := []struct {
+		notation string
+		captured rune
+		expected string
+	}{
+		{"verbose", 0, "Moved ♘ from b1 to c3."},
+		{"algebraic", 0, "♘b1-c3"},
+		{"algebraic", BlackTower, "♘b1xc3\n"},
+		{"coordinate", 0, "b1c3"},
+	}
+
+	for _, test := range tests {
+		if got := formatMove(test.notation, WhiteHorse, "B1", "c3", test.captured, 0); got != test.expected {
+			t.Errorf("formatMove(%s) = %q; want %q", test.notation, got, test.expected)
+		}
+	}
+}
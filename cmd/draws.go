@@ -0,0 +1,146 @@
+package main
+
+import "fmt"
+
+/*
+ * Draw rules. A game is drawn when the same position comes up for the
+ * third time with the same side to move, when no capture or move of a piece
+ * that only goes forwards has been made in the configured number of moves,
+ * or when neither side has the material to capture the other King.
+ */
+
+const repetitionDrawMsg = "Draw by threefold repetition"
+const moveLimitDrawMsg = "Draw by the %d-move rule"
+const insufficientMaterialMsg = "Draw by insufficient material"
+
+const defaultMoveLimit = 50
+const repetitionLimit = 3
+
+// zobristKey returns the random key of piece standing on a square. Keys are
+// derived from the inputs with splitmix64 rather than read from a table, so
+// they exist for any board size and never change between runs.
+func zobristKey(piece rune, col, row int) uint64 {
+	return splitmix64(uint64(piece)<<32 | uint64(col)<<16 | uint64(row))
+}
+
+// zobristBlackToMove is mixed into the hash of positions with Black to move.
+var zobristBlackToMove = splitmix64(1 << 63)
+
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+
+	return x ^ (x >> 31)
+}
+
+// positionHash is the Zobrist hash of a position.
+func positionHash(t table, white bool) uint64 {
+	var h uint64
+	for sq, piece := range t {
+		if piece != EC {
+			h ^= zobristKey(piece, sq[0], sq[1])
+		}
+	}
+	if !white {
+		h ^= zobristBlackToMove
+	}
+
+	return h
+}
+
+// unmakeHash returns the hash of the position before r was played, given
+// the hash of the position after it. Castling moves are not unmade: the
+// walk in repetitions stops at them.
+func unmakeHash(h uint64, r moveRecord) uint64 {
+	arrived := r.piece
+	if r.promoted != 0 {
+		arrived = r.promoted
+	}
+	h ^= zobristKey(arrived, r.mv.toCol, r.mv.toRow) ^ zobristKey(r.piece, r.mv.fromCol, r.mv.fromRow)
+	if isCapture(r.captured) {
+		sq := r.capturedAt()
+		h ^= zobristKey(r.captured, sq[0], sq[1])
+	}
+
+	return h ^ zobristBlackToMove
+}
+
+func isCapture(captured rune) bool {
+	return captured != 0 && captured != EC
+}
+
+// irreversible reports moves whose position cannot come back: captures,
+// drops and moves of pieces that only go forwards.
+func irreversible(r moveRecord) bool {
+	info, ok := pieces[r.piece]
+	return isCapture(r.captured) || r.mv.isDrop() || (ok && info.irreversible)
+}
+
+// repetitions counts how often the current position has occurred, walking
+// the hash back through the played moves. The walk stops at the last
+// irreversible move, and at castling, which gives up the right to castle.
+func repetitions(m Model) int {
+	h := positionHash(m.Table, m.isWhiteTurn)
+	current, count := h, 1
+
+	for i := len(m.moves) - 1; i >= 0; i-- {
+		h = unmakeHash(h, m.moves[i])
+		if irreversible(m.moves[i]) || m.moves[i].castle != nil {
+			break
+		}
+		if h == current {
+			count++
+		}
+	}
+
+	return count
+}
+
+// pliesWithoutCapture counts the moves played since the last irreversible
+// one.
+func pliesWithoutCapture(moves []moveRecord) int {
+	n := 0
+	for i := len(moves) - 1; i >= 0 && !irreversible(moves[i]); i-- {
+		n++
+	}
+
+	return n
+}
+
+// insufficientMaterial reports positions where no King can be captured:
+// only Kings are left, or a single Horse or Bishop against a lone King. Any
+// other piece always has a chance.
+func insufficientMaterial(t table) bool {
+	minors := 0
+	for _, piece := range t {
+		piece = armyBase(piece)
+		switch {
+		case piece == WhiteHorse || piece == BlackHorse || piece == WhiteBishop || piece == BlackBishop:
+			minors++
+		case !isKing(piece) && !isEmptySquare(piece) && piece != HC:
+			return false
+		}
+	}
+
+	return minors <= 1
+}
+
+// drawReason returns the banner text of the draw rule of the model's
+// variant that ends the game in the current position, or "" when none
+// applies. moveLimit is in full moves; 0 disables the rule. Material never
+// runs short when a lone King can win by reaching the last rank.
+func drawReason(m Model, moveLimit int) string {
+	rules := m.rules()
+	draw := rules.Draw
+	switch {
+	case draw.InsufficientMaterial && !rules.wins(winLastRank) && insufficientMaterial(m.Table) && !m.holdsPieces():
+		return insufficientMaterialMsg
+	case draw.Repetition > 0 && !m.fourPlayer() && repetitions(m) >= draw.Repetition:
+		return repetitionDrawMsg
+	case moveLimit > 0 && pliesWithoutCapture(m.moves) >= 2*moveLimit:
+		return fmt.Sprintf(moveLimitDrawMsg, moveLimit)
+	}
+
+	return ""
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestThreefoldRepetition(t *testing.T) {
+	cfg := headlessTestConfig(t)
+	shuffle := "move c1 d3\nmove d6 c4\nmove d3 c1\nmove c4 d6\n"
+
+	// the starting position is back for the second time: play on
+	var out strings.Builder
+	code, err := runHeadless(cfg, [2]movePicker{}, strings.NewReader(shuffle), &out, "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != exitUnfinished {
+		t.Fatalf("exit code after one cycle = %d; want %d", code, exitUnfinished)
+	}
+
+	out.Reset()
+	code, err = runHeadless(cfg, [2]movePicker{}, strings.NewReader(shuffle+shuffle), &out, "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != exitDraw || !strings.HasSuffix(out.String(), repetitionDrawMsg+EOL+EOL) {
+		t.Errorf("exit code %d after two cycles:\n%s", code, out.String())
+	}
+
+	records, _ := loadGameRecords(gameDBPath(cfg))
+	if len(records) != 1 || records[0].Result != "draw" {
+		t.Fatalf("recorded games = %+v", records)
+	}
+	history, err := os.ReadFile(records[0].History)
+	if err != nil || !strings.Contains(string(history), drawBoxMessage(repetitionDrawMsg)) {
+		t.Errorf("history does not give the reason:\n%s", history)
+	}
+}
+
+func TestDrawReason(t *testing.T) {
+	play := func(moves ...string) Model {
+		m := newModel(defaultConfig())
+		m.Board, m.Table, m.isWhiteTurn = Board{Width: 6, Height: 6}, createInitialTableMap(6, 6), true
+		for _, mv := range moves {
+			var msg string
+			if m, msg = movePiece(mv[:2], mv[2:], m); msg != "" {
+				t.Fatalf("move %s: %s", mv, msg)
+			}
+		}
+		return m
+	}
+
+	tests := []struct {
+		name      string
+		m         Model
+		moveLimit int
+		expected  string
+	}{
+		{"opening", play("b1e4"), defaultMoveLimit, ""},
+		{"move limit", play("b1e4", "d6b5", "e4e3", "b5a3"), 2, fmt.Sprintf(moveLimitDrawMsg, 2)},
+		{"no move limit", play("b1e4", "d6b5", "e4e3", "b5a3"), 0, ""},
+		{"capture resets the count", play("b1e4", "e6e4", "c1d3", "e4e3"), 2, ""},
+	}
+
+	for _, test := range tests {
+		if got := drawReason(test.m, test.moveLimit); got != test.expected {
+			t.Errorf("%s: drawReason = %q; want %q", test.name, got, test.expected)
+		}
+	}
+}
+
+func TestInsufficientMaterial(t *testing.T) {
+	tests := []struct {
+		pieces   []rune
+		expected bool
+	}{
+		{[]rune{WhiteKing, BlackKing}, true},
+		{[]rune{WhiteKing, WhiteHorse, BlackKing}, true},
+		{[]rune{WhiteKing, BlackKing, BlackHorse}, true},
+		{[]rune{WhiteKing, WhiteHorse, BlackKing, BlackHorse}, false},
+		{[]rune{WhiteKing, WhiteHorse, WhiteHorse, BlackKing}, false},
+		{[]rune{WhiteKing, BlackKing, BlackTower}, false},
+	}
+
+	for _, test := range tests {
+		tbl := make(table)
+		for i, piece := range test.pieces {
+			tbl[[2]int{i, 0}] = piece
+		}
+		if got := insufficientMaterial(tbl); got != test.expected {
+			t.Errorf("insufficientMaterial(%q) = %v; want %v", string(test.pieces), got, test.expected)
+		}
+	}
+}
+
+func TestDrawByMaterialEndsGame(t *testing.T) {
+	m := newModel(defaultConfig())
+	m.Board, m.isWhiteTurn = Board{Width: 6, Height: 6}, true
+	m.Table = table{{0, 5}: WhiteKing, {2, 5}: WhiteHorse, {3, 3}: BlackTower, {5, 0}: BlackKing}
+
+	m, msg := movePiece("c1", "d3", m)
+	if msg != "" || m.result != resultDraw || m.endReason != insufficientMaterialMsg {
+		t.Fatalf("after the tower was taken: result %v, reason %q, message %q", m.result, m.endReason, msg)
+	}
+	if !strings.Contains(m.Body.String(), drawBoxMessage(insufficientMaterialMsg)) {
+		t.Errorf("no banner:\n%s", m.Body.String())
+	}
+
+	m, _ = undoMove(m)
+	if m.result != resultNone || m.endReason != "" {
+		t.Errorf("undo left the game drawn: %v %q", m.result, m.endReason)
+	}
+
+	// a lone King can still race to the last rank
+	race := *smallVariant()
+	race.Win = []string{winKingCapture, winLastRank}
+	m.variant = &race
+	if m, _ = movePiece("c1", "d3", m); m.result != resultNone {
+		t.Errorf("drawn although the Kings can race: %q", m.endReason)
+	}
+}
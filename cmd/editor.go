@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+ * The setup editor lets the players build their own starting position,
+ * either by typing commands or by moving a cursor over the board with the
+ * arrow keys and leaving out the square in place and clear. A valid
+ * position starts a game or is stored as a named preset next to the game
+ * database.
+ */
+
+const presetsFileName = "presets.json"
+
+const startPositionMsg = "Starting position: %s\n"
+const editingMsg = "\n\nEditing the starting position. %s to move, cursor on %s.\n"
+const editorUsageMsg = `
+
+Setting up a position:
+  place <piece> [square] Place a piece, such as WT or BK (cursor square by default)
+  clear [square|all]     Empty a square (cursor square by default) or the board
+  hole [square]          Block a square so no piece can use it
+  side white|black       Choose the side to move
+  reset                  Go back to the standard layout
+  start                  Start a game from this position
+  save <name>            Save the position as a preset
+  load <name>            Load a preset
+  presets                List the saved presets
+  cancel                 Leave the editor without changes
+  Arrow keys move the cursor while the prompt is empty.`
+const editNotAllowedMsg = "\n\nThe position can only be edited before the first move or after the game.\n"
+const invalidPieceMsg = "\n\nPieces are written as W or B followed by a piece letter, such as WT.\n"
+const invalidPositionMsg = "\n\nInvalid position: %v\n"
+const presetSavedMsg = "\n\nPosition saved as %q.\n"
+const presetLoadedMsg = "\n\nLoaded %q.\n"
+const noPresetsMsg = "\n\nNo presets saved yet.\n"
+const presetsListMsg = "\n\nPresets: %s\n"
+const presetErrorMsg = "\n\nPreset error: %v\n"
+
+// cursorKeys maps key names to the cursor step they make.
+var cursorKeys = map[string][2]int{
+	"up":    {0, -1},
+	"down":  {0, 1},
+	"left":  {-1, 0},
+	"right": {1, 0},
+}
+
+// startingPosition returns the table and side to move a new game starts
+// from: the custom position when one is set, else the standard layout.
+func (m Model) startingPosition() (table, bool) {
+	if m.startFEN != "" {
+		if t, b, white, err := decodeFEN(m.startFEN); err == nil && b.sameSize(m.Board) {
+			return t, white
+		}
+	}
+
+	return m.rules().initialTable(m.Board.Width, m.Board.Height), true
+}
+
+// validatePosition checks that each side has exactly one King and that
+// the side to move cannot capture the other King straight away.
+func validatePosition(t table, b Board, white bool) error {
+	var kings [2]int
+	for _, piece := range t {
+		switch piece {
+		case WhiteKing:
+			kings[0]++
+		case BlackKing:
+			kings[1]++
+		}
+	}
+	for i, n := range kings {
+		if n != 1 {
+			return fmt.Errorf("%s needs exactly one King, not %d", sideName(i == 0), n)
+		}
+	}
+
+	for _, mv := range generateMoves(t, b, white) {
+		if isKing(getCellValue(mv.toCol, mv.toRow, t)) {
+			return fmt.Errorf("%s's King can be captured at once", sideName(!white))
+		}
+	}
+
+	return nil
+}
+
+// parsePiece reads a piece written as its colour and letter, such as wt.
+func parsePiece(text string) (rune, bool) {
+	if len(text) != 2 || (text[0] != 'w' && text[0] != 'b') {
+		return 0, false
+	}
+
+	letter := rune(strings.ToUpper(text[1:])[0])
+	if text[0] == 'b' {
+		letter = rune(text[1])
+	}
+
+	return pieceByLetter(string(letter))
+}
+
+/*
+ * editor commands
+ */
+
+// enterEditor opens the editor on the position the next game would start
+// from.
+func enterEditor(m Model) Model {
+	m.Board.Topology = m.rules().Topology
+	m.Table, m.isWhiteTurn = m.startingPosition()
+	m.phase = phaseEditing
+	m.result = resultNone
+	m.endReason = ""
+	m.moves = nil
+	m.offer = ""
+	m.cursor = [2]int{0, m.Board.Height - 1}
+	m.prompt.SetValue("")
+
+	return redrawGame(m)
+}
+
+// moveCursor steps the editor's cursor for an arrow key, staying on the
+// board.
+func moveCursor(m Model, key string) Model {
+	step, ok := cursorKeys[key]
+	if !ok {
+		return m
+	}
+
+	col, row := m.cursor[0]+step[0], m.cursor[1]+step[1]
+	if col >= 0 && col < m.Board.Width && row >= 0 && row < m.Board.Height {
+		m.cursor = [2]int{col, row}
+	}
+
+	return m
+}
+
+// editorSquare resolves the optional square argument of a command,
+// defaulting to the cursor.
+func editorSquare(m Model, fields []string, i int) ([2]int, bool) {
+	if len(fields) <= i {
+		return m.cursor, true
+	}
+	if !validateCoordinate(fields[i], m) {
+		return [2]int{}, false
+	}
+
+	col, row := coordinateToPosition(fields[i], m.Board.Height)
+	return [2]int{col, row}, true
+}
+
+// runEditorCommand handles the commands of the editing phase. It reports
+// false for commands that work the same in every phase.
+func runEditorCommand(m Model, fields []string) (Model, commandOutcome, bool) {
+	fail := func(msg string) (Model, commandOutcome, bool) {
+		return m, commandOutcome{message: msg, failed: true}, true
+	}
+
+	switch fields[0] {
+	case "exit":
+		return m, commandOutcome{}, false
+
+	case "help", "h":
+		return m, commandOutcome{message: editorUsageMsg}, true
+
+	case "place":
+		if len(fields) < 2 || len(fields) > 3 {
+			return fail(editorUsageMsg)
+		}
+		piece, ok := parsePiece(fields[1])
+		if !ok {
+			return fail(invalidPieceMsg)
+		}
+		sq, ok := editorSquare(m, fields, 2)
+		if !ok {
+			return fail(invalidCoordinatesMsg)
+		}
+		m.Table[sq] = piece
+
+	case "hole":
+		sq, ok := editorSquare(m, fields, 1)
+		if !ok || len(fields) > 2 {
+			return fail(invalidCoordinatesMsg)
+		}
+		m.Table[sq] = HC
+
+	case "clear":
+		if len(fields) == 2 && fields[1] == "all" {
+			m.Table = make(table)
+			break
+		}
+		sq, ok := editorSquare(m, fields, 1)
+		if !ok || len(fields) > 2 {
+			return fail(invalidCoordinatesMsg)
+		}
+		delete(m.Table, sq)
+
+	case "side":
+		if len(fields) != 2 || (fields[1] != "white" && fields[1] != "black") {
+			return fail(editorUsageMsg)
+		}
+		m.isWhiteTurn = fields[1] == "white"
+
+	case "reset":
+		m.Table, m.isWhiteTurn = m.rules().initialTable(m.Board.Width, m.Board.Height), true
+
+	case "start":
+		if err := validatePosition(m.Table, m.Board, m.isWhiteTurn); err != nil {
+			return fail(fmt.Sprintf(invalidPositionMsg, err))
+		}
+		m.startFEN, m.startNote = m.fen(), ""
+		if m.startFEN == encodeFEN(m.rules().initialTable(m.Board.Width, m.Board.Height), m.Board, true) {
+			m.startFEN = ""
+		}
+		m.prompt.SetValue("")
+		return redrawGame(startGame(m)), commandOutcome{}, true
+
+	case "cancel":
+		m.prompt.SetValue("")
+		return redrawGame(startGame(m)), commandOutcome{}, true
+
+	case "save":
+		if len(fields) != 2 {
+			return fail(editorUsageMsg)
+		}
+		if err := validatePosition(m.Table, m.Board, m.isWhiteTurn); err != nil {
+			return fail(fmt.Sprintf(invalidPositionMsg, err))
+		}
+		if err := savePreset(m.config, fields[1], m.fen()); err != nil {
+			return fail(fmt.Sprintf(presetErrorMsg, err))
+		}
+		return m, commandOutcome{message: fmt.Sprintf(presetSavedMsg, fields[1])}, true
+
+	case "load":
+		if len(fields) != 2 {
+			return fail(editorUsageMsg)
+		}
+		t, b, white, err := loadPreset(m.config, fields[1])
+		if err == nil && !b.sameSize(m.Board) {
+			err = fmt.Errorf("%q is for a %dx%d board", fields[1], b.Width, b.Height)
+		}
+		if err != nil {
+			return fail(fmt.Sprintf(presetErrorMsg, err))
+		}
+		m.Table, m.isWhiteTurn = t, white
+		m.prompt.SetValue("")
+		return redrawGame(m), commandOutcome{message: fmt.Sprintf(presetLoadedMsg, fields[1])}, true
+
+	case "presets":
+		presets, err := loadPresets(presetsPath(m.config))
+		if err != nil {
+			return fail(fmt.Sprintf(presetErrorMsg, err))
+		}
+		if len(presets) == 0 {
+			return m, commandOutcome{message: noPresetsMsg}, true
+		}
+		var list []string
+		for _, name := range sortedKeys(presets) {
+			_, b, _, _ := decodeFEN(presets[name])
+			list = append(list, fmt.Sprintf("%s (%dx%d)", name, b.Width, b.Height))
+		}
+		return m, commandOutcome{message: fmt.Sprintf(presetsListMsg, strings.Join(list, ", "))}, true
+
+	default:
+		return fail(editorUsageMsg)
+	}
+
+	m.prompt.SetValue("")
+	return redrawGame(m), commandOutcome{}, true
+}
+
+// renderEditor draws the position being edited with the cursor.
+func renderEditor(m Model) Model {
+	m.Body.Reset()
+	m.Body.WriteString("\n\n")
+	m.Body.WriteString(drawBoard(m.Board, m.Table, &m.cursor))
+	m.Body.WriteString(fmt.Sprintf(editingMsg, sideName(m.isWhiteTurn), squareName(m.cursor[0], m.cursor[1], m.Board.Height)))
+	if err := validatePosition(m.Table, m.Board, m.isWhiteTurn); err != nil {
+		m.Body.WriteString(strings.TrimPrefix(fmt.Sprintf(invalidPositionMsg, err), "\n"))
+	}
+
+	m.prompt.Prompt = promptContinueMsg
+	m.prompt.Placeholder = ""
+	m.Body.WriteString(m.prompt.View())
+	m.prompt.Focus()
+
+	return m
+}
+
+/*
+ * presets
+ */
+
+func presetsPath(cfg Config) string {
+	return filepath.Join(cfg.historyDir(), presetsFileName)
+}
+
+// loadPresets reads the saved positions by name; a missing file has none.
+func loadPresets(path string) (map[string]string, error) {
+	presets := make(map[string]string)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return presets, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &presets); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return presets, nil
+}
+
+func savePreset(cfg Config, name, fen string) error {
+	path := presetsPath(cfg)
+	presets, err := loadPresets(path)
+	if err != nil {
+		return err
+	}
+	presets[name] = fen
+
+	data, err := json.MarshalIndent(presets, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func loadPreset(cfg Config, name string) (table, Board, bool, error) {
+	presets, err := loadPresets(presetsPath(cfg))
+	if err != nil {
+		return nil, Board{}, false, err
+	}
+
+	fen, ok := presets[name]
+	if !ok {
+		return nil, Board{}, false, fmt.Errorf("no preset named %q", name)
+	}
+
+	return decodeFEN(fen)
+}
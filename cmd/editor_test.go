@@ -0,0 +1,152 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestValidatePosition(t *testing.T) {
+	b := Board{Width: 6, Height: 6}
+	tests := []struct {
+		name  string
+		t     table
+		white bool
+		valid bool
+	}{
+		{"standard", createInitialTableMap(6, 6), true, true},
+		{"no White King", table{{5, 0}: BlackKing, {0, 0}: WhiteTower}, true, false},
+		{"two Black Kings", table{{0, 5}: WhiteKing, {5, 0}: BlackKing, {4, 0}: BlackKing}, true, false},
+		{"King en prise to the side to move", table{{0, 5}: WhiteKing, {0, 4}: BlackKing}, false, false},
+		{"King attacked by the side not to move", table{{0, 5}: WhiteKing, {3, 5}: BlackTower, {5, 0}: BlackKing}, true, true},
+	}
+
+	for _, test := range tests {
+		if err := validatePosition(test.t, b, test.white); (err == nil) != test.valid {
+			t.Errorf("%s: validatePosition = %v; want valid %v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestParsePiece(t *testing.T) {
+	tests := []struct {
+		text  string
+		piece rune
+		ok    bool
+	}{
+		{"wt", WhiteTower, true},
+		{"bk", BlackKing, true},
+		{"bh", BlackHorse, true},
+		{"wz", 0, false},
+		{"t", 0, false},
+		{"xt", 0, false},
+	}
+
+	for _, test := range tests {
+		if piece, ok := parsePiece(test.text); piece != test.piece || ok != test.ok {
+			t.Errorf("parsePiece(%q) = %c, %v; want %c, %v", test.text, piece, ok, test.piece, test.ok)
+		}
+	}
+}
+
+func TestEditor(t *testing.T) {
+	cfg := headlessTestConfig(t)
+	var m tea.Model = newModel(cfg)
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 80, Height: 40})
+	for _, line := range []string{"", "", "", "", "", "edit"} {
+		m = typeLine(m, line)
+	}
+
+	for _, key := range []tea.KeyType{tea.KeyRight, tea.KeyUp, tea.KeyLeft, tea.KeyLeft} {
+		m, _ = m.Update(tea.KeyMsg{Type: key})
+	}
+	if !strings.Contains(m.View(), "cursor on a2") || !strings.Contains(m.View(), "[ ]") {
+		t.Fatalf("cursor not on a2:\n%s", m.View())
+	}
+
+	steps := []struct {
+		line string
+		want string
+	}{
+		{"place wt", "cursor on a2"},
+		{"place wz b2", strings.TrimSpace(invalidPieceMsg)},
+		{"clear a1", "White needs exactly one King, not 0"},
+		{"start", "Invalid position: White needs"},
+		{"place wk d1", "White to move"},
+		{"clear e6", "White to move"},
+		{"side black", "Black to move"},
+		{"save corner", `Position saved as "corner"`},
+		{"start", blackTurnIndicator},
+	}
+	for _, step := range steps {
+		if m = typeLine(m, step.line); !strings.Contains(m.View(), step.want) {
+			t.Fatalf("%q: view is missing %q:\n%s", step.line, step.want, m.View())
+		}
+	}
+
+	got := m.(Model)
+	if got.phase != phasePlaying || got.isWhiteTurn || got.startFEN != "3h1k/6/6/6/T5/1THK2 b" || got.fen() != got.startFEN {
+		t.Fatalf("game from the edited position: phase %v, white %v, start %q, fen %q", got.phase, got.isWhiteTurn, got.startFEN, got.fen())
+	}
+
+	// the custom position survives the game and can be reloaded
+	for _, line := range []string{"resign", "rematch", "resign", "edit", "reset", "load corner"} {
+		m = typeLine(m, line)
+	}
+	if got := m.(Model); got.phase != phaseEditing || got.fen() != "3h1k/6/6/6/T5/1THK2 b" {
+		t.Errorf("after loading the preset: phase %v, fen %q", got.phase, got.fen())
+	}
+	m = typeLine(m, "presets")
+	if !strings.Contains(m.View(), "corner (6x6)") {
+		t.Errorf("presets:\n%s", m.View())
+	}
+
+	m = typeLine(m, "cancel")
+	if got := m.(Model); got.phase != phasePlaying || got.fen() != "3h1k/6/6/6/T5/1THK2 b" {
+		t.Errorf("after cancel: phase %v, fen %q", got.phase, got.fen())
+	}
+
+	if _, _, _, err := loadPreset(cfg, "missing"); err == nil {
+		t.Errorf("loading a missing preset should fail")
+	}
+}
+
+func TestPGNFromCustomPosition(t *testing.T) {
+	rec := gameRecord{
+		Started: time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC),
+		Width:   6,
+		Height:  6,
+		Result:  "white",
+		FEN:     "3h1k/6/6/6/T5/1THK2 b",
+		Moves:   []string{"f6e5", "a2a5"},
+	}
+
+	var sb strings.Builder
+	writePGN(&sb, rec)
+
+	for _, want := range []string{`[SetUp "1"]`, `[FEN "3h1k/6/6/6/T5/1THK2 b"]`, "\n1... f6e5 2. a2a5 1-0\n"} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("PGN is missing %q:\n%s", want, sb.String())
+		}
+	}
+}
+
+func TestEditorHoles(t *testing.T) {
+	game := newModel(headlessTestConfig(t))
+	game.Board = Board{Width: 6, Height: 6}
+	var m tea.Model = enterEditor(startGame(game))
+	for _, line := range []string{"hole c3", "hole d4", "clear d4"} {
+		m = typeLine(m, line)
+	}
+	if got := m.(Model).fen(); got != "3htk/6/6/2*3/6/KTH3 w" {
+		t.Errorf("after placing holes: %s", got)
+	}
+	if view := m.View(); !strings.Contains(view, "▒▒▒") {
+		t.Errorf("the hole is not drawn:\n%s", view)
+	}
+	if piece, ok := parsePiece("w*"); ok {
+		t.Errorf("parsePiece(w*) = %c; holes are not pieces", piece)
+	}
+}
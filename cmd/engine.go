@@ -0,0 +1,550 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// move is a single piece move in table coordinates (row 0 is the top rank).
+type move struct {
+	fromCol, fromRow, toCol, toRow int
+	promotion                      rune // letter of the piece a promoting move turns into, 0 for the first choice, or of the piece dropped
+}
+
+// dropMove returns the move putting the piece with letter from the hand on
+// a square. Drops have no square to come from.
+func dropMove(letter rune, col, row int) move {
+	return move{-1, -1, col, row, letter}
+}
+
+func (mv move) isDrop() bool {
+	return mv.fromCol < 0
+}
+
+// searchLimits bounds a search by depth, by time, or by both. A zero field
+// means no limit of that kind.
+type searchLimits struct {
+	depth    int
+	movetime time.Duration
+}
+
+// searchInfo describes one finished iteration of the search.
+type searchInfo struct {
+	depth   int
+	score   int
+	nodes   int
+	elapsed time.Duration
+	pv      []move
+}
+
+const winScore = 100000
+const maxSearchDepth = 32
+
+// maxQuiesceDepth bounds the capture search. Converting captures take no
+// material off the board, so captures could otherwise go on for ever.
+const maxQuiesceDepth = 8
+
+// pieceValues is filled from pieceDefs as the pieces are registered.
+var pieceValues = map[rune]int{}
+
+/*
+ * coordinates and notation
+ */
+
+// squareName returns the coordinate of a table position, e.g. "b1".
+func squareName(col, row, height int) string {
+	return fileName(col) + strconv.Itoa(height-row)
+}
+
+// fileName returns the letters of a file counted from 0: a to z, then aa,
+// ab and so on.
+func fileName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('a'+(col-1)%26)) + name
+	}
+
+	return name
+}
+
+// parseSquare reads a coordinate of one or two file letters and a rank,
+// such as "b1", "L12" or "aa3", as a file counted from 0 and a rank
+// counted from 1. It does not check them against a board.
+func parseSquare(coord string) (col, rank int, ok bool) {
+	coord = strings.ToLower(coord)
+	digit := strings.IndexFunc(coord, unicode.IsDigit)
+	if digit < 1 || digit > 2 || coord[digit] == '0' {
+		return 0, 0, false
+	}
+
+	for _, c := range coord[:digit] {
+		if c < 'a' || c > 'z' {
+			return 0, 0, false
+		}
+		col = col*26 + int(c-'a') + 1
+	}
+	rank, err := strconv.Atoi(coord[digit:])
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return col - 1, rank, true
+}
+
+// moveText writes a move in the coordinate notation used by the engine
+// protocol, e.g. "b1c3", "a5a6h" for a promotion to a Horse or "H@e4" for
+// a drop.
+func moveText(mv move, height int) string {
+	if mv.isDrop() {
+		return string(mv.promotion) + "@" + squareName(mv.toCol, mv.toRow, height)
+	}
+
+	text := squareName(mv.fromCol, mv.fromRow, height) + squareName(mv.toCol, mv.toRow, height)
+	if mv.promotion != 0 {
+		text += string(unicode.ToLower(mv.promotion))
+	}
+
+	return text
+}
+
+// parseMoveText reads a coordinate move such as "b1c3" for the given board,
+// with an optional promotion letter as in "a5a6h" or "a5a6=H", or a drop
+// such as "H@e4".
+func parseMoveText(text string, b Board) (move, bool) {
+	text = strings.ToLower(text)
+
+	if letter, square, ok := strings.Cut(text, "@"); ok {
+		if len(letter) != 1 || letter[0] < 'a' || letter[0] > 'z' || !validateCoordinate(square, Model{Board: b}) {
+			return move{}, false
+		}
+		col, row := coordinateToPosition(square, b.Height)
+		return dropMove(unicode.ToUpper(rune(letter[0])), col, row), true
+	}
+
+	var promotion rune
+	if n := len(text); n > 0 && text[n-1] >= 'a' && text[n-1] <= 'z' {
+		promotion = unicode.ToUpper(rune(text[n-1]))
+		text = strings.TrimSuffix(text[:n-1], "=")
+	}
+
+	// the destination starts at the first letter after the first rank
+	digit := strings.IndexFunc(text, unicode.IsDigit)
+	split := strings.IndexFunc(text[max(digit, 0):], unicode.IsLetter) + max(digit, 0)
+	if digit <= 0 || split <= digit {
+		return move{}, false
+	}
+
+	from, to := text[:split], text[split:]
+	m := Model{Board: b}
+	if !validateCoordinate(from, m) || !validateCoordinate(to, m) {
+		return move{}, false
+	}
+
+	fromCol, fromRow := coordinateToPosition(from, b.Height)
+	toCol, toRow := coordinateToPosition(to, b.Height)
+
+	return move{fromCol, fromRow, toCol, toRow, promotion}, true
+}
+
+// coordinateToPosition converts a validated coordinate into table indexes.
+func coordinateToPosition(coord string, height int) (int, int) {
+	col, rank, _ := parseSquare(coord)
+
+	return col, height - rank
+}
+
+/*
+ * FEN
+ */
+
+// encodeFEN writes the position as ranks from the top separated by '/',
+// using the piece letters of the "letters" glyph set, followed by the side
+// to move. The board size is implied by the number and length of the ranks.
+// The Red and Blue pieces of four-player games are written as White's and
+// Black's after a '+'.
+func encodeFEN(t table, b Board, white bool) string {
+	letters := glyphSets["letters"]
+	ranks := make([]string, b.Height)
+
+	for row := 0; row < b.Height; row++ {
+		var rank strings.Builder
+		empty := 0
+		for col := 0; col < b.Width; col++ {
+			piece := getCellValue(col, row, t)
+			letter, ok := letters[armyBase(piece)]
+			if !ok {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				rank.WriteString(strconv.Itoa(empty))
+				empty = 0
+			}
+			if _, army := armies[piece]; army {
+				rank.WriteByte('+')
+			}
+			rank.WriteRune(letter)
+		}
+		if empty > 0 {
+			rank.WriteString(strconv.Itoa(empty))
+		}
+		ranks[row] = rank.String()
+	}
+
+	side := "w"
+	if !white {
+		side = "b"
+	}
+
+	return strings.Join(ranks, "/") + " " + side
+}
+
+func decodeFEN(fen string) (table, Board, bool, error) {
+	fields := strings.Fields(fen)
+	if len(fields) < 2 {
+		return nil, Board{}, false, fmt.Errorf("fen needs a board and a side to move")
+	}
+
+	pieces := make(map[rune]rune)
+	for piece, letter := range glyphSets["letters"] {
+		pieces[letter] = piece
+	}
+
+	t := make(table)
+	ranks := strings.Split(fields[0], "/")
+	width := -1
+
+	for row, rank := range ranks {
+		col := 0
+		for i := 0; i < len(rank); i++ {
+			c := rank[i]
+			if c >= '0' && c <= '9' {
+				j := i
+				for j < len(rank) && rank[j] >= '0' && rank[j] <= '9' {
+					j++
+				}
+				n, _ := strconv.Atoi(rank[i:j])
+				col += n
+				i = j - 1
+				continue
+			}
+
+			army := c == '+' && i+1 < len(rank)
+			if army {
+				i++
+				c = rank[i]
+			}
+			piece, ok := pieces[rune(c)]
+			if !ok || (army && !isWhitePiece(piece) && !isBlackPiece(piece)) {
+				return nil, Board{}, false, fmt.Errorf("unknown piece %q in fen", c)
+			}
+			if army && isWhitePiece(piece) {
+				piece = inArmy(piece, colorRed)
+			} else if army {
+				piece = inArmy(piece, colorBlue)
+			}
+			t[[2]int{col, row}] = piece
+			col++
+		}
+
+		if width == -1 {
+			width = col
+		} else if col != width {
+			return nil, Board{}, false, fmt.Errorf("rank %d has %d squares, want %d", row+1, col, width)
+		}
+	}
+
+	b := Board{Width: width, Height: len(ranks)}
+	if b.Width < minBoardSize || b.Width > maxBoardSize || b.Height < minBoardSize || b.Height > maxBoardSize {
+		return nil, Board{}, false, fmt.Errorf("board size %dx%d out of range", b.Width, b.Height)
+	}
+
+	switch fields[1] {
+	case "w":
+		return t, b, true, nil
+	case "b":
+		return t, b, false, nil
+	}
+
+	return nil, Board{}, false, fmt.Errorf("side to move must be w or b")
+}
+
+func (m Model) fen() string {
+	return encodeFEN(m.Table, m.Board, m.isWhiteTurn)
+}
+
+/*
+ * move generation
+ */
+
+func isOwnPiece(piece rune, white bool) bool {
+	if white {
+		return isWhitePiece(piece)
+	}
+
+	return isBlackPiece(piece)
+}
+
+// generateMoves lists the moves available to one side, scanning the board
+// from the top left so the order is stable.
+func generateMoves(t table, b Board, white bool) []move {
+	var moves []move
+
+	for row := 0; row < b.Height; row++ {
+		for col := 0; col < b.Width; col++ {
+			piece := getCellValue(col, row, t)
+			if !isOwnPiece(piece, white) {
+				continue
+			}
+
+			moves = pieceMoves(moves, t, b, pieces[piece], col, row)
+		}
+	}
+
+	return moves
+}
+
+// apply plays mv on the table and returns the captured piece, or 0.
+func (t table) apply(mv move) rune {
+	captured := t[[2]int{mv.toCol, mv.toRow}]
+	t[[2]int{mv.toCol, mv.toRow}] = t[[2]int{mv.fromCol, mv.fromRow}]
+	delete(t, [2]int{mv.fromCol, mv.fromRow})
+
+	return captured
+}
+
+// undo reverts apply.
+func (t table) undo(mv move, captured rune) {
+	t[[2]int{mv.fromCol, mv.fromRow}] = t[[2]int{mv.toCol, mv.toRow}]
+	if captured != 0 {
+		t[[2]int{mv.toCol, mv.toRow}] = captured
+	} else {
+		delete(t, [2]int{mv.toCol, mv.toRow})
+	}
+}
+
+func (t table) clone() table {
+	c := make(table, len(t))
+	for k, v := range t {
+		c[k] = v
+	}
+
+	return c
+}
+
+func isKing(piece rune) bool {
+	return piece == WhiteKing || piece == BlackKing
+}
+
+/*
+ * search
+ */
+
+// evaluate scores the position from the point of view of the side to move:
+// material plus a small bonus for pieces close to the enemy King, since
+// capturing it wins the game.
+func evaluate(t table, b Board, white bool) int {
+	var kings [2][2]int
+	for pos, piece := range t {
+		if piece == WhiteKing {
+			kings[0] = pos
+		} else if piece == BlackKing {
+			kings[1] = pos
+		}
+	}
+
+	score := 0
+	for pos, piece := range t {
+		if isKing(piece) || piece == HC {
+			continue
+		}
+
+		enemy := kings[1]
+		if isBlackPiece(piece) {
+			enemy = kings[0]
+		}
+		value := pieceValues[piece] + (b.Width+b.Height-b.distance(pos, enemy))*4
+
+		if isWhitePiece(piece) {
+			score += value
+		} else {
+			score -= value
+		}
+	}
+
+	if !white {
+		return -score
+	}
+
+	return score
+}
+
+type searcher struct {
+	ctx     context.Context
+	rules   *variant
+	t       table
+	b       Board
+	nodes   int
+	stopped bool
+	pv      [][]move
+}
+
+// search looks for the best move for the side to move within limits, under
+// rules or the small game's when rules is nil. Every completed iteration is
+// passed to report, which may be nil. ok is false when the side to move has
+// no moves. The search knows nothing of the moves played before t, so it
+// never castles, captures en passant or drops a piece from hand.
+func search(ctx context.Context, rules *variant, t table, b Board, white bool, limits searchLimits, report func(searchInfo)) (best move, ok bool) {
+	if rules == nil {
+		rules = smallVariant()
+	}
+	depth := limits.depth
+	if depth <= 0 || depth > maxSearchDepth {
+		depth = maxSearchDepth
+	}
+	if limits.movetime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.movetime)
+		defer cancel()
+	}
+
+	root := rules.generateMoves(t, b, white)
+	if len(root) == 0 {
+		return move{}, false
+	}
+
+	s := &searcher{ctx: ctx, rules: rules, t: t.clone(), b: b, pv: make([][]move, depth+2)}
+	start := time.Now()
+	best = root[0]
+
+	for d := 1; d <= depth; d++ {
+		score := s.negamax(white, d, -winScore-1, winScore+1, 0, best)
+		if s.stopped {
+			break
+		}
+
+		best = s.pv[0][0]
+		if report != nil {
+			report(searchInfo{depth: d, score: score, nodes: s.nodes, elapsed: time.Since(start), pv: append([]move(nil), s.pv[0]...)})
+		}
+		if abs(score) >= winScore-maxSearchDepth {
+			break
+		}
+	}
+
+	return best, true
+}
+
+func (s *searcher) negamax(white bool, depth, alpha, beta, ply int, first move) int {
+	s.nodes++
+	if s.nodes&1023 == 0 && s.ctx.Err() != nil {
+		s.stopped = true
+	}
+	if s.stopped {
+		return 0
+	}
+
+	s.pv[ply] = s.pv[ply][:0]
+	if depth == 0 {
+		return s.quiesce(white, alpha, beta, maxQuiesceDepth)
+	}
+
+	moves := s.rules.generateMoves(s.t, s.b, white)
+	if len(moves) == 0 {
+		return 0
+	}
+	s.orderMoves(moves, first)
+
+	for _, mv := range moves {
+		r := s.makeMove(mv)
+		var score int
+		if r.removesKing(!white) {
+			score = winScore - ply
+			s.pv[ply+1] = s.pv[ply+1][:0]
+		} else {
+			score = -s.negamax(!white, depth-1, -beta, -alpha, ply+1, move{})
+		}
+		s.unmakeMove(r)
+
+		if s.stopped {
+			return 0
+		}
+		if score > alpha {
+			alpha = score
+			s.pv[ply] = append(append(s.pv[ply][:0], mv), s.pv[ply+1]...)
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+
+	return alpha
+}
+
+// quiesce only looks at captures so the static evaluation is never taken in
+// the middle of an exchange, down to depth more plies.
+func (s *searcher) quiesce(white bool, alpha, beta, depth int) int {
+	standPat := evaluate(s.t, s.b, white)
+	if standPat >= beta || depth == 0 {
+		return max(alpha, standPat)
+	}
+	alpha = max(alpha, standPat)
+
+	for _, mv := range s.rules.generateMoves(s.t, s.b, white) {
+		if getCellValue(mv.toCol, mv.toRow, s.t) == EC && mv.promotion == 0 {
+			continue
+		}
+
+		r := s.makeMove(mv)
+		var score int
+		if r.removesKing(!white) {
+			score = winScore - maxSearchDepth
+		} else {
+			score = -s.quiesce(!white, -beta, -alpha, depth-1)
+		}
+		s.unmakeMove(r)
+
+		if score >= beta {
+			return score
+		}
+		alpha = max(alpha, score)
+	}
+
+	return alpha
+}
+
+// makeMove plays mv with its promotion and the effects of a capture,
+// returning its record.
+func (s *searcher) makeMove(mv move) moveRecord {
+	r := s.rules.plainRecord(s.t, s.b, mv)
+	s.t.play(r)
+
+	return r
+}
+
+// unmakeMove reverts makeMove.
+func (s *searcher) unmakeMove(r moveRecord) {
+	s.t.unplay(r)
+}
+
+// orderMoves tries the previous best move first, then captures of the most
+// valuable pieces.
+func (s *searcher) orderMoves(moves []move, first move) {
+	rank := func(mv move) int {
+		if mv == first {
+			return 1 << 30
+		}
+		captured := getCellValue(mv.toCol, mv.toRow, s.t)
+		if isKing(captured) {
+			return winScore
+		}
+		return pieceValues[captured]
+	}
+
+	sort.SliceStable(moves, func(i, j int) bool { return rank(moves[i]) > rank(moves[j]) })
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFENRoundTrip(t *testing.T) {
+	b := Board{Width: 6, Height: 6}
+	start := createInitialTableMap(b.Width, b.Height)
+
+	fen := encodeFEN(start, b, true)
+	if fen != "3htk/6/6/6/6/KTH3 w" {
+		t.Fatalf("encodeFEN = %q", fen)
+	}
+
+	decoded, size, white, err := decodeFEN(fen)
+	if err != nil {
+		t.Fatalf("decodeFEN: %v", err)
+	}
+	if size != b || !white || len(decoded) != len(start) {
+		t.Fatalf("decodeFEN = %v %v %v", decoded, size, white)
+	}
+	for pos, piece := range start {
+		if decoded[pos] != piece {
+			t.Errorf("piece at %v = %c; want %c", pos, decoded[pos], piece)
+		}
+	}
+
+	wide := "12/12/12/12/12/k10K b"
+	if _, size, _, err := decodeFEN(wide); err != nil || size.Width != 12 {
+		t.Errorf("decodeFEN(%q) = %v, %v", wide, size, err)
+	}
+
+	for _, bad := range []string{"", "6/6/6/6/6/6", "3htk/5/6/6/6/KTH3 w", "3htz/6/6/6/6/KTH3 w", "3htk/6/6/6/6/KTH3 x", "3/3/3 w"} {
+		if _, _, _, err := decodeFEN(bad); err == nil {
+			t.Errorf("decodeFEN(%q) should fail", bad)
+		}
+	}
+}
+
+func TestParseMoveText(t *testing.T) {
+	b := Board{Width: 8, Height: 8}
+
+	tests := []struct {
+		text     string
+		expected move
+		ok       bool
+	}{
+		{"b1c3", move{1, 7, 2, 5, 0}, true},
+		{"H8A1", move{7, 0, 0, 7, 0}, true},
+		{"a7a8h", move{0, 1, 0, 0, 'H'}, true},
+		{"a7a8=T", move{0, 1, 0, 0, 'T'}, true},
+		{"b1", move{}, false},
+		{"b1i3", move{}, false},
+		{"", move{}, false},
+	}
+
+	for _, test := range tests {
+		mv, ok := parseMoveText(test.text, b)
+		if ok != test.ok || mv != test.expected {
+			t.Errorf("parseMoveText(%q) = %v, %v; want %v, %v", test.text, mv, ok, test.expected, test.ok)
+		}
+		if want := strings.ToLower(strings.ReplaceAll(test.text, "=", "")); ok && moveText(mv, b.Height) != want {
+			t.Errorf("moveText(%v) = %q; want %q", mv, moveText(mv, b.Height), want)
+		}
+	}
+
+	b = Board{Width: 26, Height: 26}
+	tests = []struct {
+		text     string
+		expected move
+		ok       bool
+	}{
+		{"a10l12", move{0, 16, 11, 14, 0}, true},
+		{"z26z1", move{25, 0, 25, 25, 0}, true},
+		{"k9k10t", move{10, 17, 10, 16, 'T'}, true},
+		{"a27a26", move{}, false},
+	}
+
+	for _, test := range tests {
+		mv, ok := parseMoveText(test.text, b)
+		if ok != test.ok || mv != test.expected {
+			t.Errorf("parseMoveText(%q) = %v, %v; want %v, %v", test.text, mv, ok, test.expected, test.ok)
+		}
+		if want := strings.ToLower(strings.ReplaceAll(test.text, "=", "")); ok && moveText(mv, b.Height) != want {
+			t.Errorf("moveText(%v) = %q; want %q", mv, moveText(mv, b.Height), want)
+		}
+	}
+}
+
+func TestSquareNames(t *testing.T) {
+	for col, name := range map[int]string{0: "a", 25: "z", 26: "aa", 27: "ab", 51: "az", 52: "ba"} {
+		if got := fileName(col); got != name {
+			t.Errorf("fileName(%d) = %q; want %q", col, got, name)
+		}
+		if got, rank, ok := parseSquare(name + "10"); !ok || got != col || rank != 10 {
+			t.Errorf("parseSquare(%q) = %d, %d, %v", name+"10", got, rank, ok)
+		}
+	}
+
+	for _, bad := range []string{"", "a", "10", "a0", "a01", "abc1", "a-1", "é1"} {
+		if _, _, ok := parseSquare(bad); ok {
+			t.Errorf("parseSquare(%q) accepted", bad)
+		}
+	}
+	board := drawTableWithMap(26, 26, table{})
+	if lines := strings.Split(board, "\n"); !strings.HasSuffix(lines[0], "  Y   Z ") || !strings.HasPrefix(lines[2], " 26 │") {
+		t.Errorf("labels of a 26x26 board:\n%s", board)
+	}
+}
+
+func TestGenerateMovesAgreesWithMovePiece(t *testing.T) {
+	m := newModel(defaultConfig())
+	m.Board = Board{Width: 7, Height: 6}
+	m.Table = createInitialTableMap(7, 6)
+
+	for _, white := range []bool{true, false} {
+		m.isWhiteTurn = white
+		moves := generateMoves(m.Table, m.Board, white)
+
+		count := 0
+		for row := 0; row < m.Board.Height; row++ {
+			for col := 0; col < m.Board.Width; col++ {
+				piece := getCellValue(col, row, m.Table)
+				if !isOwnPiece(piece, white) {
+					continue
+				}
+				for toRow := 0; toRow < m.Board.Height; toRow++ {
+					for toCol := 0; toCol < m.Board.Width; toCol++ {
+						valid, _ := isValidPieceMove(piece, m.Table, m.Board, col, row, toCol, toRow)
+						if valid && !isOwnPiece(getCellValue(toCol, toRow, m.Table), white) {
+							count++
+						}
+					}
+				}
+			}
+		}
+
+		if len(moves) != count {
+			t.Errorf("white=%v: generated %d moves; want %d", white, len(moves), count)
+		}
+
+		for _, mv := range moves {
+			probe := m
+			probe.Table = m.Table.clone()
+			if _, err := playMachineMove(probe, mv); err != nil {
+				t.Errorf("movePiece rejected a generated move: %v", err)
+			}
+		}
+	}
+}
+
+func TestSearchCapturesKing(t *testing.T) {
+	// the black King is in reach of the white Horse
+	tb, b, white, err := decodeFEN("5k/6/4H1/6/6/K5 w")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var infos []searchInfo
+	best, ok := search(context.Background(), nil, tb, b, white, searchLimits{depth: 4}, func(info searchInfo) {
+		infos = append(infos, info)
+	})
+
+	if !ok || moveText(best, b.Height) != "e4f6" {
+		t.Errorf("search = %s, %v; want e4f6", moveText(best, b.Height), ok)
+	}
+	if len(infos) != 1 || scoreText(infos[0].score) != "mate 1" {
+		t.Errorf("expected a single iteration reporting mate 1, got %+v", infos)
+	}
+	if len(tb) != 3 {
+		t.Errorf("search must not modify the caller's table")
+	}
+}
+
+func TestSearchRespectsMovetime(t *testing.T) {
+	tb := createInitialTableMap(12, 12)
+	b := Board{Width: 12, Height: 12}
+
+	start := time.Now()
+	_, ok := search(context.Background(), nil, tb, b, true, searchLimits{movetime: 50 * time.Millisecond}, nil)
+	if !ok {
+		t.Fatal("expected a move")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("search took %v with a 50ms movetime", elapsed)
+	}
+}
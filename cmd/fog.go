@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+/*
+ * Fog of war. In variants with fog each side only sees the squares its
+ * pieces stand on and those they could move to or attack; the rest of the
+ * board is drawn as fog until the game is over. Against the computer the
+ * board is shown as the human side sees it. Two players sharing a terminal
+ * get a screen between turns asking to pass the device, so neither sees
+ * the other's view, and a network host sends the guest only what Black
+ * sees. The API and headless mode show the whole board, so they do not
+ * play fog.
+ */
+
+const passDeviceMsg = "\n\nPass the device to %s and press Enter when they are ready.\n"
+const opponentMovedHiddenMsg = "\n\nYour opponent moved.\n"
+
+var errFogHidden = errors.New("fog of war games are only played in the terminal or over the network")
+
+// visibleSquares returns the squares white's side can see: those its
+// pieces stand on, move to or attack, up to and including the first piece
+// in the way.
+func visibleSquares(t table, b Board, white bool) map[[2]int]bool {
+	seen := make(map[[2]int]bool)
+	for sq, piece := range t {
+		info, ok := pieces[piece]
+		if !ok || info.white != white {
+			continue
+		}
+		seen[sq] = true
+
+		// a piece sees where it could go whether it would move or capture
+		sight := *info
+		sight.rules = make([]moveRule, len(info.rules))
+		for i, r := range info.rules {
+			r.moveOnly, r.captureOnly = false, false
+			sight.rules[i] = r
+		}
+		for _, mv := range pieceMoves(nil, t, b, &sight, sq[0], sq[1]) {
+			seen[[2]int{mv.toCol, mv.toRow}] = true
+		}
+	}
+
+	return seen
+}
+
+// fogTable returns t as white's side sees it, with FC on the squares it
+// cannot see. Holes are part of the board and always shown.
+func fogTable(t table, b Board, white bool) table {
+	seen := visibleSquares(t, b, white)
+	fogged := make(table)
+	for row := 0; row < b.Height; row++ {
+		for col := 0; col < b.Width; col++ {
+			sq := [2]int{col, row}
+			piece, ok := t[sq]
+			switch {
+			case piece == HC || seen[sq]:
+				if ok {
+					fogged[sq] = piece
+				}
+			default:
+				fogged[sq] = FC
+			}
+		}
+	}
+
+	return fogged
+}
+
+// viewer tells whose side the board is shown for and whether fog hides
+// part of it: the local side of a network game, the human side against
+// the computer, or the side to move when two players share the terminal.
+// Games between two computers and finished games are shown in full.
+func (m Model) viewer() (white, fogged bool) {
+	if !m.rules().Fog || m.phase != phasePlaying || m.result != resultNone {
+		return false, false
+	}
+
+	switch {
+	case m.net != nil:
+		return m.net.host, true
+	case m.players[0] != nil && m.players[1] != nil:
+		return false, false
+	case m.players[0] != nil:
+		return false, true
+	case m.players[1] != nil:
+		return true, true
+	}
+
+	return m.isWhiteTurn, true
+}
+
+// boardView returns t as the viewer may see it.
+func (m Model) boardView(t table) table {
+	if white, fogged := m.viewer(); fogged {
+		return fogTable(t, m.Board, white)
+	}
+
+	return t
+}
+
+// hotSeat reports whether two players share the terminal in a fog game,
+// so the device has to change hands between turns.
+func (m Model) hotSeat() bool {
+	return m.rules().Fog && m.net == nil && m.players[0] == nil && m.players[1] == nil
+}
+
+// renderHandover hides the board until the next player is at the device.
+func renderHandover(m Model) Model {
+	m.Body.Reset()
+	m.Body.WriteString(fmt.Sprintf(passDeviceMsg, sideName(m.isWhiteTurn)))
+	m.prompt.Prompt = promptContinueMsg
+	m.prompt.Placeholder = ""
+	m.Body.WriteString(m.prompt.View())
+	m.prompt.Focus()
+
+	return m
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestFogTable(t *testing.T) {
+	b := Board{Width: 6, Height: 6}
+	tests := []struct {
+		fen    string
+		square [2]int
+		want   rune // FC when hidden
+	}{
+		{"3htk/6/6/6/6/KTH3 w", [2]int{5, 0}, FC},         // Black's King
+		{"3htk/6/6/6/6/KTH3 w", [2]int{1, 5}, WhiteTower}, // own pieces
+		{"3htk/6/6/6/6/KTH3 w", [2]int{4, 2}, 0},          // where the Tower leaps
+		{"3htk/6/6/6/6/KTH3 w", [2]int{5, 2}, FC},
+		{"5k/6/6/6/2P3/K5 w", [2]int{1, 3}, 0},  // a Pawn sees where it would capture
+		{"5k/6/6/6/2P3/K5 w", [2]int{2, 2}, 0},  // and its double step
+		{"5k/6/6/6/2P3/K5 w", [2]int{2, 1}, FC}, // but no further
+		{"5k/6/6/2h3/2T3/K5 w", [2]int{2, 3}, BlackHorse},
+		{"5k/6/2*3/6/6/K5 w", [2]int{2, 2}, HC}, // holes are always shown
+	}
+
+	for _, test := range tests {
+		tb, _, _, err := decodeFEN(test.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fogTable(tb, b, true)[test.square]; got != test.want {
+			t.Errorf("%s: square %v is %q; want %q", test.fen, test.square, got, test.want)
+		}
+	}
+}
+
+func TestFogHotSeat(t *testing.T) {
+	var m tea.Model = redrawGame(variantGame(t, "fog", Board{Width: 6, Height: 6}, ""))
+	if view := m.View(); !strings.Contains(view, "░░░") || strings.Contains(view, "♚") {
+		t.Fatalf("White sees Black's camp:\n%s", view)
+	}
+
+	m = typeLine(m, "move c1 d3")
+	view := m.View()
+	if !strings.Contains(view, "Pass the device to Black") || strings.ContainsAny(view, "♔♘♚") {
+		t.Fatalf("no hand over screen:\n%s", view)
+	}
+
+	// a move typed on the hand over screen is ignored
+	m = typeLine(m, "move d6 c4")
+	view = m.View()
+	if !strings.Contains(view, "♚") || strings.ContainsAny(view, "♔♘") {
+		t.Errorf("Black's view:\n%s", view)
+	}
+	if got := m.(Model).fen(); got != "3htk/6/6/3H2/6/KT4 b" {
+		t.Errorf("position = %s", got)
+	}
+
+	m = typeLine(m, "move e6 e3")
+	if view := m.View(); !strings.Contains(view, "Pass the device to White") {
+		t.Errorf("no hand over to White:\n%s", view)
+	}
+}
+
+func TestFogNetworkGame(t *testing.T) {
+	hs, err := hostGame("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(hs.Close)
+	gs, err := joinGame(hs.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(gs.Close)
+
+	host := variantGame(t, "fog", Board{Width: 6, Height: 6}, "")
+	host.net = hs
+	guest := newModel(headlessTestConfig(t))
+	guest.net = gs
+
+	host, _ = deliver(t, host, netConnected)
+	guest, _ = deliver(t, guest, netState)
+	if guest.Table[[2]int{0, 5}] != FC || guest.Table[[2]int{5, 0}] != BlackKing {
+		t.Errorf("guest sees %s", guest.fen())
+	}
+
+	host, outcome := runCommand(host, "move c1 d3")
+	if outcome.failed {
+		t.Fatalf("host move failed: %q", outcome.message)
+	}
+	guest, text := deliver(t, guest, netState)
+	if text != "" || strings.Contains(guest.fen(), "H") {
+		t.Errorf("the host's move leaked: %q, %s", text, guest.fen())
+	}
+
+	guest, _ = runCommand(guest, "move e6 e3")
+	_, text = deliver(t, host, netMove)
+	if text != opponentMovedHiddenMsg {
+		t.Errorf("host told %q", text)
+	}
+}
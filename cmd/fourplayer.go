@@ -0,0 +1,353 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/*
+ * Four-player games. A variant with players = 4 puts an army in each corner
+ * of the board: White in the bottom left, then Red, Black and Blue going
+ * clockwise, which is also the order they move in. Red and Blue are drawn
+ * as White's and Black's pieces in colour, and written in FEN as White's
+ * and Black's letters after a '+'.
+ *
+ * Capturing a King knocks its army out and takes the army's other pieces
+ * off the board; an army that resigns is out too, but its pieces stay where
+ * they stand without moving again. In a free-for-all the last army standing
+ * wins. With teams, White and Black play together against Red and Blue,
+ * partners sitting in opposite corners, and a team wins once both of the
+ * other team's armies are out.
+ *
+ * The players share one terminal: four-player games have no network,
+ * machine or API players, no draw offers or setup editor, and repeated
+ * positions are not counted.
+ */
+
+const fourPlayers = 4
+
+const seatTurnMsg = "\n\nIt's %s's turn. You can only move %s pieces.\n"
+const cannotCapturePartnerMsg = "\n\nYou cannot capture your partner's pieces.\n"
+const knockedOutMsg = "%s is out!"
+const teamWinsMsg = "%s and %s win! 🎉"
+const resignedOutMsg = "\n\n%s resigns and is out.\n"
+const outIndicator = "Out: %s\n"
+const fourPlayerUnavailableMsg = "\n\nThat is not available in four-player games.\n"
+
+var errFourPlayersLocal = errors.New("four-player games are played by people at one terminal")
+
+// pieceColor is an army, numbered in the order the armies move.
+type pieceColor int
+
+const (
+	colorWhite pieceColor = iota
+	colorRed
+	colorBlack
+	colorBlue
+)
+
+var colorNames = [...]string{"White", "Red", "Black", "Blue"}
+
+func (c pieceColor) String() string {
+	return colorNames[c]
+}
+
+// team numbers the pair an army plays in when the game has teams: White
+// and Black are 0, Red and Blue 1.
+func (c pieceColor) team() int {
+	return int(c) % 2
+}
+
+// turnIndicators and winResults follow the armies' order.
+var turnIndicators = [...]string{whiteTurnIndicator, "\n\n🟥 Turn: Red\n", blackTurnIndicator, "\n\n🟦 Turn: Blue\n"}
+var winResults = [...]gameResult{resultWhiteWins, resultRedWins, resultBlackWins, resultBlueWins}
+
+// armyPiece is a Red or Blue piece: the White or Black piece it moves like
+// and is drawn as, and its army.
+type armyPiece struct {
+	base  rune
+	color pieceColor
+}
+
+// armies holds the Red and Blue pieces by the rune stored in the table.
+// They are kept in the Unicode private use area from armyRuneBase on.
+var armies = map[rune]armyPiece{}
+
+const armyRuneBase = '\uE100'
+
+var nextArmyRune rune = armyRuneBase
+
+// armyTints are the terminal colours Red and Blue pieces are drawn in.
+var armyTints = map[pieceColor]string{colorRed: "\x1b[31m", colorBlue: "\x1b[34m"}
+
+const tintReset = "\x1b[39m"
+
+// registerArmies adds the Red and Blue counterparts of def to registry.
+// They move like White's piece: four-player variants only use pieces that
+// move the same way in every direction.
+func registerArmies(registry map[rune]*pieceInfo, def *pieceDef) {
+	like := registry[def.white]
+	def.red, def.blue = nextArmyRune, nextArmyRune+1
+	nextArmyRune += 2
+
+	for piece, army := range map[rune]armyPiece{def.red: {def.white, colorRed}, def.blue: {def.black, colorBlue}} {
+		registry[piece] = &pieceInfo{def: def, color: army.color, rules: like.rules, irreversible: like.irreversible}
+		armies[piece] = army
+		if def.value != 0 {
+			pieceValues[piece] = def.value
+		}
+	}
+}
+
+// colorOf returns the army of piece; ok is false for empty squares and
+// holes.
+func colorOf(piece rune) (c pieceColor, ok bool) {
+	info, ok := pieces[piece]
+	if !ok {
+		return 0, false
+	}
+
+	return info.color, true
+}
+
+// inArmy returns the piece of army c of the same kind as piece.
+func inArmy(piece rune, c pieceColor) rune {
+	def := pieces[piece].def
+
+	return [...]rune{def.white, def.red, def.black, def.blue}[c]
+}
+
+// isAnyKing is isKing for the Kings of all four armies.
+func isAnyKing(piece rune) bool {
+	info, ok := pieces[piece]
+	return ok && info.def.white == WhiteKing
+}
+
+// armyBase returns the White or Black piece a Red or Blue piece is drawn
+// as, and any other piece as it is.
+func armyBase(piece rune) rune {
+	if army, ok := armies[piece]; ok {
+		return army.base
+	}
+
+	return piece
+}
+
+// tinted colours the text drawn for piece when it belongs to Red or Blue.
+func tinted(piece rune, text string) string {
+	if army, ok := armies[piece]; ok {
+		return armyTints[army.color] + text + tintReset
+	}
+
+	return text
+}
+
+// directional reports pieces whose moves depend on which way their side
+// faces, which four-player variants cannot use.
+func (def *pieceDef) directional() bool {
+	return strings.ContainsAny(def.betza, "fblri")
+}
+
+// cornerSquares returns the table squares of White's col on its r-th rank
+// from the back for each army, in the armies' order.
+func cornerSquares(col, r, width, height int) [4][2]int {
+	return [4][2]int{
+		{col, height - 1 - r},
+		{col, r},
+		{width - 1 - col, r},
+		{width - 1 - col, height - 1 - r},
+	}
+}
+
+// attacksKing reports whether army c could capture another army's King
+// straight away.
+func attacksKing(t table, b Board, c pieceColor) bool {
+	for sq, piece := range t {
+		if pc, ok := colorOf(piece); !ok || pc != c {
+			continue
+		}
+		for _, mv := range pieceMoves(nil, t, b, pieces[piece], sq[0], sq[1]) {
+			if isAnyKing(getCellValue(mv.toCol, mv.toRow, t)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+/*
+ * playing
+ */
+
+func (m Model) fourPlayer() bool {
+	return m.rules().Players == fourPlayers
+}
+
+// nextSeat returns the army moving after the one to move, skipping those
+// that are out.
+func (m Model) nextSeat() pieceColor {
+	c := m.seat
+	for range fourPlayers {
+		if c = (c + 1) % fourPlayers; !m.out[c] {
+			break
+		}
+	}
+
+	return c
+}
+
+// standing returns the result once the game is decided by the armies still
+// in it, with its banner, or resultNone.
+func (m Model) standing() (gameResult, string) {
+	teams := make(map[int]bool)
+	var alive []pieceColor
+	for c := colorWhite; c <= colorBlue; c++ {
+		if !m.out[c] {
+			alive = append(alive, c)
+			teams[c.team()] = true
+		}
+	}
+
+	switch {
+	case m.rules().Teams && len(teams) == 1:
+		// White and Red lead their teams
+		first := pieceColor(alive[0].team())
+		return winResults[first], fmt.Sprintf(teamWinsMsg, first, first+2)
+	case len(alive) == 1:
+		return winResults[alive[0]], winResults[alive[0]].message()
+	}
+
+	return resultNone, ""
+}
+
+// knockOut takes army c out of the game, recording the removal of its
+// pieces still on t in r.
+func knockOut(m Model, t table, r *moveRecord, c pieceColor) Model {
+	for sq, piece := range t {
+		if pc, ok := colorOf(piece); ok && pc == c && sq != r.capturedAt() {
+			r.effects = append(r.effects, squareChange{sq, piece, 0})
+		}
+	}
+	m.out[c] = true
+
+	return m
+}
+
+// fourPlayerMove is movePiece for four-player games: the army to move
+// moves, a captured King knocks its army out, and the next army still in
+// the game has the move.
+func fourPlayerMove(from, to string, m Model) (Model, string) {
+	if !validateCoordinate(from, m) || !validateCoordinate(to, m) {
+		return m, invalidCoordinatesMsg
+	}
+	fromCol, fromRow := coordinateToPosition(from, m.Board.Height)
+	toCol, toRow := coordinateToPosition(to, m.Board.Height)
+	piece := getCellValue(fromCol, fromRow, m.Table)
+
+	color, ok := colorOf(piece)
+	if !ok {
+		return m, noPieceMsg
+	}
+	if color != m.seat {
+		return m, fmt.Sprintf(seatTurnMsg, m.seat, strings.ToLower(m.seat.String()))
+	}
+
+	validMove, known := isValidPieceMove(piece, m.Table, m.Board, fromCol, fromRow, toCol, toRow)
+	if !known {
+		return m, unknownPieceMsg
+	}
+	if !validMove {
+		return m, invalidMoveMsg
+	}
+
+	rules := m.rules()
+	record := rules.plainRecord(m.Table, m.Board, move{fromCol, fromRow, toCol, toRow, 0})
+	captured, captures := colorOf(record.captured)
+	switch {
+	case captures && captured == color:
+		return m, cannotCaptureSelfMsg
+	case captures && rules.Teams && captured.team() == color.team():
+		return m, cannotCapturePartnerMsg
+	}
+
+	msg := fmt.Sprintf("%s: %s", color, formatMove(m.config.Notation, piece, from, to, record.captured, 0))
+	if captures && isAnyKing(record.captured) && !m.out[captured] {
+		m = knockOut(m, m.Table, &record, captured)
+		if !strings.HasSuffix(msg, EOL) {
+			msg += EOL
+		}
+		msg += drawBoxMessage(fmt.Sprintf(knockedOutMsg, captured))
+	}
+
+	m.Table.play(record)
+	m.moves = append(m.moves, record)
+
+	result, reason := m.standing()
+	if result != resultNone {
+		msg += drawBoxMessage(reason)
+		m.endReason = reason
+	} else {
+		m.seat = m.nextSeat()
+		m.isWhiteTurn = m.seat == colorWhite
+	}
+
+	return finishTurn(m, piece, result, msg)
+}
+
+// resignSeat knocks the army to move out of the game at its own request.
+// Its pieces stay where they stand and no longer move.
+func resignSeat(m Model) (Model, string) {
+	resigned := m.seat
+	m.out[resigned] = true
+
+	msg := fmt.Sprintf(resignedOutMsg, resigned)
+	writeToHistory(strings.TrimLeft(msg, "\n"), m.logFile)
+
+	result, reason := m.standing()
+	if result != resultNone {
+		m.endReason = reason
+		m = finishGame(m, result)
+		writeToHistory(gameOverMsg, m.logFile)
+		recordGame(m)
+	} else {
+		m.seat = m.nextSeat()
+		m.isWhiteTurn = m.seat == colorWhite
+	}
+
+	m.prompt.SetValue("")
+	return redrawGame(m), msg
+}
+
+// runFourPlayerCommand handles the commands that work differently in a
+// four-player game. It reports false for commands that work as usual.
+func runFourPlayerCommand(m Model, fields []string) (Model, commandOutcome, bool) {
+	switch fields[0] {
+	case "resign":
+		m, msg := resignSeat(m)
+		return m, commandOutcome{message: msg}, true
+	case "offer", "draw", "accept", "decline", "edit", "drop", "chat", "undo":
+		return m, commandOutcome{message: fourPlayerUnavailableMsg, failed: true}, true
+	}
+
+	return m, commandOutcome{}, false
+}
+
+// seatIndicator is turnIndicator for four-player games, listing the
+// armies that are out.
+func seatIndicator(m Model) string {
+	indicator := turnIndicators[m.seat]
+
+	var out []string
+	for c := colorWhite; c <= colorBlue; c++ {
+		if m.out[c] {
+			out = append(out, c.String())
+		}
+	}
+	if len(out) > 0 {
+		indicator += fmt.Sprintf(outIndicator, strings.Join(out, ", "))
+	}
+
+	return indicator
+}
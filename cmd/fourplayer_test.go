@@ -0,0 +1,182 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFourPlayerStart(t *testing.T) {
+	const start = "+K+T+H2htk/8/8/8/8/8/8/KTH2+h+t+k w"
+	m := variantGame(t, "four", Board{Width: 8, Height: 8}, "")
+	if got := m.fen(); got != start {
+		t.Errorf("start = %s", got)
+	}
+
+	tb, _, _, err := decodeFEN(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tb[[2]int{0, 0}]; got != pieceDefs[0].red {
+		t.Errorf("a8 holds %q; want Red's King", got)
+	}
+	if c, _ := colorOf(tb[[2]int{7, 7}]); c != colorBlue {
+		t.Errorf("h1 belongs to %s", c)
+	}
+
+	board := drawBoard(m.Board, m.Table, nil)
+	if !strings.Contains(board, armyTints[colorRed]+"♔"+tintReset) || !strings.Contains(board, armyTints[colorBlue]+"♚"+tintReset) {
+		t.Errorf("Red and Blue are not drawn in colour:\n%s", board)
+	}
+}
+
+func TestFourPlayerTurns(t *testing.T) {
+	m := variantGame(t, "four", Board{Width: 8, Height: 8}, "")
+
+	moves := []struct {
+		from, to string
+		msg      string
+		next     pieceColor
+	}{
+		{"c8", "d6", "\n\nIt's White's turn. You can only move white pieces.\n", colorWhite},
+		{"c1", "d3", "", colorRed},
+		{"c8", "d6", "", colorBlack},
+		{"f8", "e6", "", colorBlue},
+		{"f1", "e3", "", colorWhite},
+	}
+	for _, mv := range moves {
+		var msg string
+		m, msg = movePiece(mv.from, mv.to, m)
+		if msg != mv.msg || m.seat != mv.next {
+			t.Errorf("%s%s: message %q, %s to move; want %q, %s", mv.from, mv.to, msg, m.seat, mv.msg, mv.next)
+		}
+	}
+	if got := turnIndicator(m); got != whiteTurnIndicator {
+		t.Errorf("indicator = %q", got)
+	}
+}
+
+func TestFourPlayerKnockOut(t *testing.T) {
+	m := variantGame(t, "four", Board{Width: 8, Height: 8}, "+K2+T3k/8/1H6/8/8/8/8/K6+k w")
+	m, msg := movePiece("b6", "a8", m)
+	if msg != "" {
+		t.Fatal(msg)
+	}
+
+	if !m.out[colorRed] || m.seat != colorBlack {
+		t.Errorf("out %v, %s to move", m.out, m.seat)
+	}
+	if got := m.fen(); got != "H6k/8/8/8/8/8/8/K6+k b" {
+		t.Errorf("after the capture: %s", got)
+	}
+	if got := turnIndicator(m); !strings.Contains(got, "Out: Red") {
+		t.Errorf("indicator = %q", got)
+	}
+
+	// reviewing the game brings Red's pieces back
+	m.reviewPly = 0
+	if got := encodeFEN(reviewTable(m), m.Board, true); got != "+K2+T3k/8/1H6/8/8/8/8/K6+k w" {
+		t.Errorf("start of the review: %s", got)
+	}
+}
+
+func TestFourPlayerResults(t *testing.T) {
+	tests := []struct {
+		name   string
+		fen    string
+		out    []pieceColor
+		move   string
+		msg    string
+		result gameResult
+		reason string
+	}{
+		{"four", "+K6k/8/1H6/8/3T4/8/8/K6+k w", []pieceColor{colorBlack, colorBlue}, "b6a8", "", resultWhiteWins, whiteWinsMsg},
+		{"four", "+K6k/8/1H6/8/3T4/8/8/K6+k w", []pieceColor{colorBlack}, "b6a8", "", resultNone, ""},
+		{"teams", "+K6k/8/1H6/8/3T4/8/8/K6+k w", []pieceColor{colorBlue}, "b6a8", "", resultWhiteWins, "White and Black win! 🎉"},
+		{"teams", "+K6k/8/1H6/8/3T4/8/8/K6+k w", nil, "b6a8", "", resultNone, ""},
+		{"teams", "+K1h4k/8/1H6/8/3T4/8/8/K6+k w", nil, "b6c8", cannotCapturePartnerMsg, resultNone, ""},
+		{"four", "+K1h4k/8/1H6/8/3T4/8/8/K6+k w", nil, "b6c8", "", resultNone, ""},
+	}
+
+	for _, test := range tests {
+		m := variantGame(t, test.name, Board{Width: 8, Height: 8}, test.fen)
+		for _, c := range test.out {
+			m.out[c] = true
+		}
+		m, msg := movePiece(test.move[:2], test.move[2:], m)
+		if msg != test.msg || m.result != test.result || m.endReason != test.reason {
+			t.Errorf("%s %s: message %q, result %v, reason %q; want %q, %v, %q", test.name, test.move, msg, m.result, m.endReason, test.msg, test.result, test.reason)
+		}
+	}
+}
+
+func TestFourPlayerCommands(t *testing.T) {
+	m := variantGame(t, "teams", Board{Width: 8, Height: 8}, "")
+	if _, outcome := runCommand(m, "offer draw"); outcome.message != fourPlayerUnavailableMsg {
+		t.Errorf("offer draw: %q", outcome.message)
+	}
+
+	m, _ = runCommand(m, "resign")
+	if !m.out[colorWhite] || m.seat != colorRed {
+		t.Errorf("after White resigns: out %v, %s to move", m.out, m.seat)
+	}
+	m, _ = runCommand(m, "move c8 d6")
+	if m.seat != colorBlack {
+		t.Errorf("%s to move after Red", m.seat)
+	}
+
+	// Black is left alone for its team and can still win it
+	m, _ = runCommand(m, "resign")
+	if m.result != resultRedWins || m.endReason != "Red and Blue win! 🎉" {
+		t.Errorf("result %v, %q", m.result, m.endReason)
+	}
+
+	// PGN has no way to write the game
+	path := filepath.Join(t.TempDir(), "four.pgn")
+	if _, outcome := runCommand(m, "save "+path); !outcome.failed || !strings.Contains(outcome.message, errFourPlayersPGN.Error()) {
+		t.Errorf("save: %+v", outcome)
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Errorf("save wrote %s", path)
+	}
+}
+
+func TestFourPlayerSubcommands(t *testing.T) {
+	cfg := headlessTestConfig(t)
+	cfg.Variant = "four"
+
+	if err := runServeCommand(nil, cfg, io.Discard); err != errFourPlayersLocal {
+		t.Errorf("serve: %v", err)
+	}
+	if err := runMatchCommand(nil, cfg, io.Discard); err != errFourPlayersLocal {
+		t.Errorf("match: %v", err)
+	}
+	cfg.Width, cfg.Height = 8, 8
+	if _, err := runHeadless(cfg, [2]movePicker{}, strings.NewReader(""), io.Discard, "text"); err != errFourPlayersLocal {
+		t.Errorf("headless: %v", err)
+	}
+}
+
+func TestFourPlayerVariantChecks(t *testing.T) {
+	tests := []struct {
+		text string
+		err  string
+	}{
+		{"name = \"x\"\nlayout = [\"KTH\"]\nplayers = 3", "players must be 2 or 4"},
+		{"name = \"x\"\nlayout = [\"KTH\"]\nteams = true", "teams need 4 players"},
+		{"name = \"x\"\nmin_size = 8\nlayout = [\"KTH\", \"P*\"]\nplayers = 4", "wider than 4 squares"},
+		{"name = \"x\"\nmin_size = 8\nlayout = [\"KTH\", \"P\"]\nplayers = 4", "moves one way for each side"},
+		{"name = \"x\"\nmin_size = 8\nlayout = [\"KTH\"]\nplayers = 4\nsymmetry = \"mirror\"", "rotate symmetry"},
+		{"name = \"x\"\nmin_size = 8\nlayout = [\"KTH\"]\nplayers = 4\nwin = [\"checkmate\"]", "only play king_capture"},
+		{"name = \"x\"\nmin_size = 4\nlayout = [\"TK\"]\nplayers = 4", "can capture a King at once"},
+	}
+
+	for _, test := range tests {
+		_, err := parseVariant([]byte(test.text), "test")
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: error %v; want %q", test.text, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+/*
+ * Finished games are kept in a single JSON-lines file next to the history
+ * files, one record per game in the order they ended. The file is small
+ * enough to be read whole, so queries filter it in memory.
+ */
+
+const gameDBFileName = "games.jsonl"
+const dateLayout = "2006-01-02"
+
+const gamesUsage = "usage: small-chess games [-size WxH] [-result white|black|red|blue|draw] [-since YYYY-MM-DD] [-until YYYY-MM-DD] [-player name] [-variant name] [-min-moves n] [-max-moves n] [-pgn] [-o file]"
+const noGamesFoundMsg = "No games found.\n"
+
+// gameDBMu serializes writers in this process, such as API games ending
+// at the same time.
+var gameDBMu sync.Mutex
+
+var errFourPlayersPGN = errors.New("PGN has no way to write four-player games")
+
+// gameRecord is a finished game as stored in the database.
+type gameRecord struct {
+	ID      int       `json:"id"`
+	Started time.Time `json:"started"`
+	Ended   time.Time `json:"ended"`
+	White   string    `json:"white,omitempty"`
+	Black   string    `json:"black,omitempty"`
+	Width   int       `json:"width"`
+	Height  int       `json:"height"`
+	Variant string    `json:"variant"`
+	FEN     string    `json:"fen,omitempty"` // custom starting position
+	Result  string    `json:"result"`
+	Reason  string    `json:"reason,omitempty"` // how the game ended, when not by capture
+	Moves   []string  `json:"moves"`
+	History string    `json:"history,omitempty"` // the game's text log
+}
+
+// gameFilter selects records; zero fields match everything.
+type gameFilter struct {
+	size     Board
+	result   string
+	since    time.Time
+	until    time.Time // exclusive
+	player   string
+	variant  string
+	minMoves int
+	maxMoves int
+}
+
+func gameDBPath(cfg Config) string {
+	return filepath.Join(cfg.historyDir(), gameDBFileName)
+}
+
+// recordGame stores a game that has just ended and updates the players'
+// ratings. Games without a history file, such as engine matches, are not
+// recorded.
+func recordGame(m Model) error {
+	if m.logFile == "" || m.result == resultNone {
+		return nil
+	}
+
+	rec := m.gameRecord()
+	if err := addGameRecord(gameDBPath(m.config), rec); err != nil {
+		return err
+	}
+
+	return rateGame(m.config, rec)
+}
+
+// gameRecord describes the model's game as a database record.
+func (m Model) gameRecord() gameRecord {
+	rec := gameRecord{
+		Started: m.startTime,
+		Ended:   time.Now(),
+		White:   m.names[0],
+		Black:   m.names[1],
+		Width:   m.Board.Width,
+		Height:  m.Board.Height,
+		Variant: m.rules().Name,
+		Result:  m.result.String(),
+		Reason:  m.endReason,
+		FEN:     m.startFEN,
+		Moves:   make([]string, len(m.moves)),
+		History: m.logFile,
+	}
+	for i, r := range m.moves {
+		rec.Moves[i] = moveText(r.mv, m.Board.Height)
+	}
+
+	return rec
+}
+
+func addGameRecord(path string, rec gameRecord) error {
+	gameDBMu.Lock()
+	defer gameDBMu.Unlock()
+
+	records, err := loadGameRecords(path)
+	if err != nil {
+		return err
+	}
+	rec.ID = len(records) + 1
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// loadGameRecords reads the whole database; a missing file is empty.
+func loadGameRecords(path string) ([]gameRecord, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []gameRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var rec gameRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		records = append(records, rec)
+	}
+
+	return records, scanner.Err()
+}
+
+func queryGames(path string, f gameFilter) ([]gameRecord, error) {
+	records, err := loadGameRecords(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []gameRecord
+	for _, rec := range records {
+		if f.matches(rec) {
+			found = append(found, rec)
+		}
+	}
+
+	return found, nil
+}
+
+func (f gameFilter) matches(rec gameRecord) bool {
+	switch {
+	case f.size.Width != 0 && (rec.Width != f.size.Width || rec.Height != f.size.Height):
+		return false
+	case f.result != "" && rec.Result != f.result:
+		return false
+	case !f.since.IsZero() && rec.Started.Before(f.since):
+		return false
+	case !f.until.IsZero() && !rec.Started.Before(f.until):
+		return false
+	case f.player != "" && !strings.EqualFold(rec.White, f.player) && !strings.EqualFold(rec.Black, f.player):
+		return false
+	case f.variant != "" && rec.Variant != f.variant:
+		return false
+	case f.minMoves != 0 && len(rec.Moves) < f.minMoves:
+		return false
+	case f.maxMoves != 0 && len(rec.Moves) > f.maxMoves:
+		return false
+	}
+
+	return true
+}
+
+/*
+ * PGN
+ */
+
+// fourPlayerRecord reports games of four-player variants, which PGN has
+// no way to write; the export leaves them out and save refuses them.
+func fourPlayerRecord(rec gameRecord) bool {
+	if r := parseGameResult(rec.Result); r == resultRedWins || r == resultBlueWins {
+		return true
+	}
+	v, err := loadVariant(rec.Variant)
+
+	return err == nil && v.Players == fourPlayers
+}
+
+func pgnResult(result string) string {
+	switch result {
+	case "white":
+		return "1-0"
+	case "black":
+		return "0-1"
+	case "draw":
+		return "1/2-1/2"
+	}
+
+	return "*"
+}
+
+func pgnName(name string) string {
+	if name == "" {
+		return "?"
+	}
+
+	return name
+}
+
+// writePGN writes a record in the PGN layout: tag pairs, then the moves in
+// coordinate notation, numbered by full move.
+func writePGN(w io.Writer, rec gameRecord) error {
+	var sb strings.Builder
+
+	tags := [][2]string{
+		{"Event", appName + " game"},
+		{"Site", appName},
+		{"Date", rec.Started.Format("2006.01.02")},
+		{"Round", "-"},
+		{"White", pgnName(rec.White)},
+		{"Black", pgnName(rec.Black)},
+		{"Result", pgnResult(rec.Result)},
+		{"Variant", rec.Variant},
+		{"BoardSize", fmt.Sprintf("%dx%d", rec.Width, rec.Height)},
+		{"PlyCount", fmt.Sprint(len(rec.Moves))},
+	}
+	if rec.Reason != "" {
+		tags = append(tags, [2]string{"Termination", rec.Reason})
+	}
+	if rec.FEN != "" {
+		tags = append(tags, [2]string{"SetUp", "1"}, [2]string{"FEN", rec.FEN})
+	}
+	for _, tag := range tags {
+		sb.WriteString(fmt.Sprintf("[%s %q]\n", tag[0], tag[1]))
+	}
+	sb.WriteString("\n")
+
+	line := 0
+	write := func(token string) {
+		if line > 0 && line+len(token) >= 80 {
+			sb.WriteString("\n")
+			line = 0
+		} else if line > 0 {
+			sb.WriteString(" ")
+			line++
+		}
+		sb.WriteString(token)
+		line += len(token)
+	}
+
+	// a custom position may have Black move first
+	ply := 0
+	if strings.HasSuffix(rec.FEN, " b") {
+		ply = 1
+		if len(rec.Moves) > 0 {
+			write("1...")
+		}
+	}
+	for _, mv := range rec.Moves {
+		if ply%2 == 0 {
+			write(fmt.Sprintf("%d.", ply/2+1))
+		}
+		write(mv)
+		ply++
+	}
+	write(pgnResult(rec.Result))
+	sb.WriteString("\n\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+/*
+ * games subcommand
+ */
+
+// runGamesCommand implements `small-chess games`.
+func runGamesCommand(args []string, cfg Config, out io.Writer) error {
+	fs := flag.NewFlagSet("games", flag.ContinueOnError)
+	fs.SetOutput(out)
+
+	var f gameFilter
+	size := fs.String("size", "", "only games on this board size, such as 8x8")
+	fs.StringVar(&f.result, "result", "", "only games with this result: white, black, red, blue or draw")
+	since := fs.String("since", "", "only games started on or after this date (YYYY-MM-DD)")
+	until := fs.String("until", "", "only games started before this date (YYYY-MM-DD)")
+	fs.StringVar(&f.player, "player", "", "only games with this player on either side")
+	fs.StringVar(&f.variant, "variant", "", "only games of this variant")
+	fs.IntVar(&f.minMoves, "min-moves", 0, "only games with at least this many moves")
+	fs.IntVar(&f.maxMoves, "max-moves", 0, "only games with at most this many moves")
+	pgn := fs.Bool("pgn", false, "print the games as PGN records instead of a table")
+	output := fs.String("o", "", "write the output to this file")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New(gamesUsage)
+	}
+
+	if *size != "" {
+		sizes, err := parseBoardSizes(*size, minBoardSize, maxBoardSize)
+		if err != nil || len(sizes) != 1 {
+			return fmt.Errorf("invalid -size %q", *size)
+		}
+		f.size = sizes[0]
+	}
+	if f.result != "" && parseGameResult(f.result) == resultNone {
+		return fmt.Errorf("-result must be white, black, red, blue or draw")
+	}
+
+	var err error
+	for _, d := range []struct {
+		text string
+		dst  *time.Time
+	}{{*since, &f.since}, {*until, &f.until}} {
+		if d.text == "" {
+			continue
+		}
+		if *d.dst, err = time.ParseInLocation(dateLayout, d.text, time.Local); err != nil {
+			return fmt.Errorf("dates must look like %s: %w", dateLayout, err)
+		}
+	}
+
+	games, err := queryGames(gameDBPath(cfg), f)
+	if err != nil {
+		return err
+	}
+
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if *pgn {
+		for _, rec := range games {
+			if fourPlayerRecord(rec) {
+				continue
+			}
+			if err := writePGN(out, rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return printGames(out, games)
+}
+
+func printGames(out io.Writer, games []gameRecord) error {
+	if len(games) == 0 {
+		_, err := io.WriteString(out, noGamesFoundMsg)
+		return err
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tDATE\tSIZE\tVARIANT\tWHITE\tBLACK\tRESULT\tMOVES")
+	for _, rec := range games {
+		fmt.Fprintf(tw, "%d\t%s\t%dx%d\t%s\t%s\t%s\t%s\t%d\n",
+			rec.ID, rec.Started.Format("2006-01-02 15:04"), rec.Width, rec.Height, rec.Variant,
+			pgnName(rec.White), pgnName(rec.Black), rec.Result, len(rec.Moves))
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGameDBQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db", gameDBFileName)
+	day := func(d int) time.Time { return time.Date(2026, 1, d, 10, 0, 0, 0, time.Local) }
+
+	for _, rec := range []gameRecord{
+		{Started: day(1), Width: 8, Height: 8, Variant: "small", Result: "black", White: "alice", Moves: []string{"b1e4", "d6b5"}},
+		{Started: day(5), Width: 6, Height: 6, Variant: "small", Result: "white", Black: "Bob", Moves: []string{"b1e4"}},
+		{Started: day(9), Width: 8, Height: 8, Variant: "small", Result: "black", Black: "alice", Moves: []string{"b1e4", "d6b5", "e4e6"}},
+	} {
+		if err := addGameRecord(path, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		filter   gameFilter
+		expected []int
+	}{
+		{gameFilter{}, []int{1, 2, 3}},
+		{gameFilter{size: Board{Width: 8, Height: 8}, result: "black"}, []int{1, 3}},
+		{gameFilter{since: day(2)}, []int{2, 3}},
+		{gameFilter{until: day(9)}, []int{1, 2}},
+		{gameFilter{player: "ALICE"}, []int{1, 3}},
+		{gameFilter{player: "bob", result: "black"}, nil},
+		{gameFilter{minMoves: 2, maxMoves: 2}, []int{1}},
+		{gameFilter{variant: "atomic"}, nil},
+	}
+
+	for _, test := range tests {
+		games, err := queryGames(path, test.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int
+		for _, g := range games {
+			ids = append(ids, g.ID)
+		}
+		if !slices.Equal(ids, test.expected) {
+			t.Errorf("query %+v = %v; want %v", test.filter, ids, test.expected)
+		}
+	}
+}
+
+func TestWritePGN(t *testing.T) {
+	rec := gameRecord{
+		Started: time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC),
+		White:   "alice",
+		Width:   6,
+		Height:  6,
+		Variant: "small",
+		Result:  "white",
+		Moves:   []string{"b1e4", "d6b5", "e4e6"},
+	}
+
+	var sb strings.Builder
+	writePGN(&sb, rec)
+
+	for _, want := range []string{`[Date "2026.03.04"]`, `[White "alice"]`, `[Black "?"]`, `[Result "1-0"]`, `[BoardSize "6x6"]`, "\n1. b1e4 d6b5 2. e4e6 1-0\n"} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("PGN is missing %q:\n%s", want, sb.String())
+		}
+	}
+}
+
+func TestFinishedGamesAreRecorded(t *testing.T) {
+	cfg := headlessTestConfig(t)
+	script := "move b1 e4\nmove d6 b5\nmove e4 e6\nmove b5 a3\nmove e6 f6\n"
+
+	if _, err := runHeadless(cfg, [2]movePicker{}, strings.NewReader(script), new(strings.Builder), "text"); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := runGamesCommand([]string{"-size", "6x6", "-result", "white", "-since", time.Now().Format(dateLayout)}, cfg, &out); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 2 || !strings.HasSuffix(lines[1], "white   5") {
+		t.Errorf("games output:\n%s", out.String())
+	}
+
+	out.Reset()
+	runGamesCommand([]string{"-pgn"}, cfg, &out)
+	if !strings.Contains(out.String(), "3. e6f6 1-0") {
+		t.Errorf("PGN export:\n%s", out.String())
+	}
+
+	// four-player games are listed but not exported
+	four := gameRecord{Started: time.Now(), Width: 8, Height: 8, Variant: "four", Result: "red", Moves: []string{"c1d3"}}
+	if err := addGameRecord(gameDBPath(cfg), four); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	runGamesCommand([]string{"-result", "red"}, cfg, &out)
+	if !strings.Contains(out.String(), "four") {
+		t.Errorf("red query:\n%s", out.String())
+	}
+	out.Reset()
+	runGamesCommand([]string{"-pgn"}, cfg, &out)
+	if strings.Count(out.String(), "[Event ") != 1 || strings.Contains(out.String(), "c1d3") {
+		t.Errorf("PGN export with a four-player game:\n%s", out.String())
+	}
+
+	out.Reset()
+	runGamesCommand([]string{"-result", "draw"}, cfg, &out)
+	if out.String() != noGamesFoundMsg {
+		t.Errorf("draw query = %q", out.String())
+	}
+
+	for _, bad := range [][]string{{"-size", "8"}, {"-result", "lost"}, {"-since", "yesterday"}} {
+		if err := runGamesCommand(bad, cfg, &out); err == nil {
+			t.Errorf("games %v should fail", bad)
+		}
+	}
+}
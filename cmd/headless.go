@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Exit codes used by headless mode to report how the game ended.
+const (
+	exitUnfinished = 0
+	exitError      = 1
+	exitWhiteWins  = 10
+	exitBlackWins  = 11
+	exitDraw       = 12
+)
+
+const headlessSizeErr = "headless mode needs a board size: pass -width and -height or set them in the config"
+
+// headlessState is the JSON record written after every command.
+type headlessState struct {
+	Command string   `json:"command"`
+	OK      bool     `json:"ok"`
+	Message string   `json:"message,omitempty"`
+	Turn    string   `json:"turn"`
+	Board   []string `json:"board"`
+	Result  string   `json:"result,omitempty"`
+}
+
+func headlessMain(cfg Config, players [2]movePicker, inputPath, format string) int {
+	in := io.Reader(os.Stdin)
+	if inputPath != "" {
+		f, err := os.Open(inputPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		defer f.Close()
+		in = f
+	}
+
+	code, err := runHeadless(cfg, players, in, os.Stdout, format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	return code
+}
+
+// runHeadless plays a game without the terminal UI. Commands are read one
+// per line from in, using the same syntax as the interactive prompt; empty
+// lines and lines starting with # are skipped. Sides with a movePicker play
+// on their own, so two computer players need no input at all. After every
+// command or computer move the position is written to out as text or as
+// one JSON object per line. The returned exit code reflects the result of
+// the game.
+func runHeadless(cfg Config, players [2]movePicker, in io.Reader, out io.Writer, format string) (int, error) {
+	if format != "text" && format != "json" {
+		return exitError, fmt.Errorf("unknown output format %q (available: text, json)", format)
+	}
+	if cfg.Width == 0 || cfg.Height == 0 {
+		return exitError, fmt.Errorf(headlessSizeErr)
+	}
+
+	m := newModel(cfg)
+	if m.rules().Fog {
+		return exitError, errFogHidden
+	}
+	if m.rules().Players == fourPlayers {
+		return exitError, errFourPlayersLocal
+	}
+	m.Board = Board{Width: cfg.Width, Height: cfg.Height}
+	m.players = players
+	if cfg.Start != "" {
+		spec, _ := parseStartSpec(cfg.Start) // validated with the config
+		m = applyStartSpec(m, spec)
+	}
+	m = startGame(m)
+
+	if err := writeHeadlessState(out, format, m, "", commandOutcome{}); err != nil {
+		return exitError, err
+	}
+
+	scanner := bufio.NewScanner(in)
+	for m.result == resultNone {
+		if p := m.sidePlayer(); p != nil {
+			mv, err := p.pickMove(m.Table.clone(), m.Board, m.isWhiteTurn)
+			if err != nil {
+				return exitError, err
+			}
+
+			if m, err = playMachineMove(m, mv); err != nil {
+				return exitError, err
+			}
+			if err := writeHeadlessState(out, format, m, moveCommand(mv, m.Board.Height), commandOutcome{}); err != nil {
+				return exitError, err
+			}
+			continue
+		}
+
+		if !scanner.Scan() {
+			break
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var outcome commandOutcome
+		m, outcome = runCommand(m, line)
+		if outcome.quit {
+			break
+		}
+
+		if err := writeHeadlessState(out, format, m, line, outcome); err != nil {
+			return exitError, err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return exitError, err
+	}
+
+	return resultExitCode(m.result), nil
+}
+
+func writeHeadlessState(out io.Writer, format string, m Model, command string, outcome commandOutcome) error {
+	state := headlessState{
+		Command: command,
+		OK:      !outcome.failed,
+		Message: strings.TrimSpace(outcome.message),
+		Turn:    "white",
+		Board:   boardRows(m),
+		Result:  m.result.String(),
+	}
+	if !m.isWhiteTurn {
+		state.Turn = "black"
+	}
+
+	if format == "json" {
+		return json.NewEncoder(out).Encode(state)
+	}
+
+	var sb strings.Builder
+	if command != "" {
+		sb.WriteString("> " + command + EOL)
+	}
+	if state.Message != "" {
+		sb.WriteString(state.Message + EOL)
+	}
+	sb.WriteString(drawBoard(m.Board, m.Table, nil))
+	if m.result != resultNone {
+		sb.WriteString(m.resultMessage() + EOL)
+	} else if m.isWhiteTurn {
+		sb.WriteString(strings.TrimSpace(whiteTurnIndicator) + EOL)
+	} else {
+		sb.WriteString(strings.TrimSpace(blackTurnIndicator) + EOL)
+	}
+	sb.WriteString(EOL)
+
+	_, err := io.WriteString(out, sb.String())
+	return err
+}
+
+// boardRows lists the ranks from the top of the board down, one letter per
+// piece (upper case for White) and '.' for empty squares.
+func boardRows(m Model) []string {
+	letters := glyphSets["letters"]
+	rows := make([]string, m.Board.Height)
+
+	for y := 0; y < m.Board.Height; y++ {
+		var row strings.Builder
+		for x := 0; x < m.Board.Width; x++ {
+			if letter, ok := letters[getCellValue(x, y, m.Table)]; ok {
+				row.WriteRune(letter)
+			} else {
+				row.WriteRune('.')
+			}
+		}
+		rows[y] = row.String()
+	}
+
+	return rows
+}
+
+func resultExitCode(r gameResult) int {
+	switch r {
+	case resultWhiteWins:
+		return exitWhiteWins
+	case resultBlackWins:
+		return exitBlackWins
+	case resultDraw:
+		return exitDraw
+	}
+
+	return exitUnfinished
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func headlessTestConfig(t *testing.T) Config {
+	cfg := defaultConfig()
+	cfg.Width = 6
+	cfg.Height = 6
+	cfg.HistoryDir = t.TempDir()
+
+	return cfg
+}
+
+// variantGame starts a game of the named variant on b, from fen or from the
+// variant's layout when fen is empty, and plays the moves given in
+// coordinate notation.
+func variantGame(t *testing.T, name string, b Board, fen string, moves ...string) Model {
+	t.Helper()
+	cfg := headlessTestConfig(t)
+	cfg.Variant = name
+
+	m := newModel(cfg)
+	m.Board, m.startFEN = b, fen
+	m = startGame(m)
+	for _, mv := range moves {
+		var msg string
+		if m, msg = movePiece(mv[:2], mv[2:], m); msg != "" {
+			t.Fatalf("%s: %q", mv, strings.TrimSpace(msg))
+		}
+	}
+
+	return m
+}
+
+func TestRunHeadlessKingCapture(t *testing.T) {
+	script := strings.Join([]string{
+		"# white tower hunts the black king",
+		"move b1 e4",
+		"move d6 b5",
+		"",
+		"move e4 e6",
+		"move b5 a3",
+		"move e6 f6",
+		"move a3 b1", // ignored: the game is already over
+	}, "\n")
+
+	var out strings.Builder
+	code, err := runHeadless(headlessTestConfig(t), [2]movePicker{}, strings.NewReader(script), &out, "json")
+	if err != nil {
+		t.Fatalf("runHeadless: %v", err)
+	}
+	if code != exitWhiteWins {
+		t.Errorf("exit code = %d; want %d", code, exitWhiteWins)
+	}
+
+	var states []headlessState
+	scanner := bufio.NewScanner(strings.NewReader(out.String()))
+	for scanner.Scan() {
+		var state headlessState
+		if err := json.Unmarshal(scanner.Bytes(), &state); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		states = append(states, state)
+	}
+
+	if len(states) != 6 {
+		t.Fatalf("got %d states; want initial position plus 5 moves", len(states))
+	}
+
+	last := states[len(states)-1]
+	if last.Command != "move e6 f6" || last.Result != "white" {
+		t.Errorf("last state = %+v; want the king capture with a white result", last)
+	}
+	if last.Board[0] != ".....T" {
+		t.Errorf("top rank = %q; want %q", last.Board[0], ".....T")
+	}
+}
+
+// illegalPicker always plays a move the game rejects.
+type illegalPicker struct{}
+
+func (illegalPicker) pickMove(table, Board, bool) (move, error) {
+	return move{0, 0, 0, 0, 0}, nil
+}
+
+func (illegalPicker) Close() error {
+	return nil
+}
+
+func TestRunHeadlessIllegalMachineMove(t *testing.T) {
+	var out strings.Builder
+	code, err := runHeadless(headlessTestConfig(t), [2]movePicker{illegalPicker{}}, strings.NewReader(""), &out, "text")
+	if err == nil || !strings.Contains(err.Error(), "illegal move a6a6") || code != exitError {
+		t.Errorf("runHeadless = %d, %v; want %d and an illegal move", code, err, exitError)
+	}
+}
+
+func TestIllegalMachineMoveStopsAsking(t *testing.T) {
+	m := newModel(headlessTestConfig(t))
+	m.Board = Board{Width: 6, Height: 6}
+	m = startGame(m)
+	m.players[0] = illegalPicker{}
+
+	next, _ := m.Update(machineMoveMsg{game: m.startTime})
+	m = next.(Model)
+	if !m.engineFailed || !strings.Contains(m.Body.String(), "illegal move a6a6") {
+		t.Fatalf("failed %v, body:\n%s", m.engineFailed, m.Body.String())
+	}
+	if _, cmd := m.withMachineMove(nil); cmd != nil {
+		t.Error("the failed player is asked again")
+	}
+}
+
+func TestRunHeadlessRejectsBadInput(t *testing.T) {
+	var out strings.Builder
+	code, err := runHeadless(headlessTestConfig(t), [2]movePicker{}, strings.NewReader("fly a1\nmove a6 a5\nexit\nmove a1 a2\n"), &out, "text")
+	if err != nil {
+		t.Fatalf("runHeadless: %v", err)
+	}
+	if code != exitUnfinished {
+		t.Errorf("exit code = %d; want %d", code, exitUnfinished)
+	}
+
+	text := out.String()
+	if !strings.Contains(text, strings.TrimSpace(invalidCommandMsg)) || !strings.Contains(text, strings.TrimSpace(noPieceMsg)) {
+		t.Errorf("expected error messages in output, got:\n%s", text)
+	}
+	if strings.Contains(text, "> move a1 a2") {
+		t.Errorf("commands after exit should not run")
+	}
+
+	if _, err := runHeadless(defaultConfig(), [2]movePicker{}, strings.NewReader(""), &out, "text"); err == nil {
+		t.Errorf("expected an error without a board size")
+	}
+
+	cfg := headlessTestConfig(t)
+	cfg.Variant = "fog"
+	if _, err := runHeadless(cfg, [2]movePicker{}, strings.NewReader(""), &out, "text"); err != errFogHidden {
+		t.Errorf("fog game: %v; want %v", err, errFogHidden)
+	}
+}
@@ -1,52 +1,149 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
 type Board struct {
-	Width  int
-	Height int
+	Width    int
+	Height   int
+	Topology string // which edges wrap around, see topology.go
 }
 
 type Model struct {
-	Board       Board
-	Body        *strings.Builder
-	err         error
-	prompt      textinput.Model
-	Table       table
-	startTime   time.Time
-	logFile     string
-	isWhiteTurn bool
+	Board        Board
+	Body         *strings.Builder
+	err          error
+	prompt       textinput.Model
+	Table        table
+	startTime    time.Time
+	logFile      string
+	logTag       string // put in the history file name, such as an API game's ID
+	isWhiteTurn  bool
+	config       Config
+	result       gameResult
+	players      [2]movePicker
+	thinking     bool
+	engineFailed bool // a computer player failed and is asked for no more moves
+	moves        []moveRecord
+	net          *netSession
+	offer        string    // pending offer: offerDraw or offerUndo
+	offerWhite   bool      // side that made the pending offer
+	names        [2]string // White's and Black's names, empty when unknown
+	pickSide     int       // side whose name is being asked: 1 White, 2 Black
+	phase        gamePhase
+	startFEN     string            // custom starting position, empty for the standard layout
+	startNote    string            // how startFEN was made, logged when a game starts
+	startPending bool              // the starting position is still to be chosen in setup
+	variant      *variant          // the rules played, see rules()
+	cursor       [2]int            // square under the editor's cursor
+	reviewPly    int               // number of moves shown while reviewing
+	endReason    string            // banner explaining how the game ended, if not by capture
+	promoting    [2]string         // from and to of a move waiting for its promotion piece
+	handover     bool              // a fog game waits for the device to change hands
+	seat         pieceColor        // the army to move in four-player games
+	out          [fourPlayers]bool // the armies of a four-player game that are out
+}
+
+// moveRecord remembers a played move so it can be listed or taken back.
+type moveRecord struct {
+	mv       move
+	piece    rune
+	captured rune
+	promoted rune // what piece became on arrival, 0 when it did not promote
+
+	enPassant bool           // captured stood beside the destination, on the mover's row
+	castle    *move          // the partner's move when the King castled
+	effects   []squareChange // what the variant's capture effect changed after the move
 }
 
 type (
 	errMsg error
 )
 
-type table map[[2]int]rune
+type gameResult int
 
-func createInitialTableMap(width, height int) table {
-	m := make(table)
-	if width >= 3 && height >= 1 {
-		m[[2]int{width - 3, 0}] = BlackHorse
-		m[[2]int{width - 2, 0}] = BlackTower
-		m[[2]int{width - 1, 0}] = BlackKing
+const (
+	resultNone gameResult = iota
+	resultWhiteWins
+	resultBlackWins
+	resultDraw
+	resultRedWins  // four-player games only
+	resultBlueWins // four-player games only
+)
+
+func (r gameResult) String() string {
+	switch r {
+	case resultWhiteWins:
+		return "white"
+	case resultBlackWins:
+		return "black"
+	case resultDraw:
+		return "draw"
+	case resultRedWins:
+		return "red"
+	case resultBlueWins:
+		return "blue"
+	}
+
+	return ""
+}
+
+// parseGameResult is the inverse of gameResult.String.
+func parseGameResult(s string) gameResult {
+	for _, r := range []gameResult{resultWhiteWins, resultBlackWins, resultDraw, resultRedWins, resultBlueWins} {
+		if r.String() == s {
+			return r
+		}
 	}
-	if width >= 3 && height >= 1 {
-		m[[2]int{0, height - 1}] = WhiteKing
-		m[[2]int{1, height - 1}] = WhiteTower
-		m[[2]int{2, height - 1}] = WhiteHorse
+
+	return resultNone
+}
+
+func (r gameResult) message() string {
+	switch r {
+	case resultWhiteWins:
+		return whiteWinsMsg
+	case resultBlackWins:
+		return blackWinsMsg
+	case resultDraw:
+		return drawMsg
+	case resultRedWins:
+		return redWinsMsg
+	case resultBlueWins:
+		return blueWinsMsg
 	}
-	return m
+
+	return ""
+}
+
+// resultMessage is the banner shown once the game is over.
+func (m Model) resultMessage() string {
+	if m.endReason != "" {
+		return m.endReason
+	}
+
+	return m.result.message()
+}
+
+type table map[[2]int]rune
+
+// createInitialTableMap sets up the small game, the default variant.
+func createInitialTableMap(width, height int) table {
+	return smallVariant().initialTable(width, height)
 }
 
 const TLC = '\u250C' // ┌ top left corner
@@ -62,6 +159,10 @@ const LC = '\u251C'  // ├ Left Cell
 const TC = '\u252C'  // ┬ Top Cell
 const BC = '\u2534'  // ┴ Bottom Cell
 const EOL = "\n"     // End of Line
+const HC = '\u2592'  // ▒ Hole Cell, a square no piece can stand on, ride through or leap across
+const FC = '\u2591'  // ░ Fog Cell, a square hidden from the player in fog of war
+const WH = '\u2504'  // ┄ Wrapping Horizontal edge
+const WV = '\u2506'  // ┆ Wrapping Vertical edge
 
 const WhiteHorse = '\u2658' // ♘ White Horse (Unicode chess knight)
 const WhiteTower = '\u2656' // ♖ White Tower (Unicode chess rook)
@@ -70,17 +171,65 @@ const BlackHorse = '\u265E' // ♞ Black Horse (Unicode black knight)
 const BlackTower = '\u265C' // ♜ Black Tower (Unicode black rook)
 const BlackKing = '\u265A'  // ♚ Black King  (Unicode black king)
 
-const minValidSize = 6
-const maxValidSize = 12
+/*
+ * Themes and glyph sets
+ */
+
+type boardTheme struct {
+	topLeft, topRight, bottomLeft, bottomRight rune
+	horizontal, vertical, cross                rune
+	leftCell, rightCell, topCell, bottomCell   rune
+	hole                                       rune // fills the squares of holes
+	wrapHorizontal, wrapVertical               rune // edges that wrap around
+	fog                                        rune // fills the squares hidden by fog of war
+}
+
+var themes = map[string]boardTheme{
+	"unicode": {TLC, TRC, BLC, BRC, HL, VL, CR, LC, RC, TC, BC, HC, WH, WV, FC},
+	"ascii":   {'+', '+', '+', '+', '-', '|', '+', '+', '+', '+', '+', '#', '~', ':', '?'},
+}
+
+// glyphSets map piece runes to the rune drawn on screen. Pieces missing
+// from a set are drawn as they are stored in the table.
+var glyphSets = map[string]map[rune]rune{
+	"unicode": {},
+	"letters": {HC: '*', FC: '?'}, // the pieces are added as they are registered
+}
+
+// activeTheme and activeGlyphs are set from the config before the UI starts.
+var activeTheme = themes["unicode"]
+var activeGlyphs = glyphSets["unicode"]
+
+func applyRenderConfig(cfg Config) {
+	if theme, ok := themes[cfg.Theme]; ok {
+		activeTheme = theme
+	}
+	if glyphs, ok := glyphSets[cfg.Glyphs]; ok {
+		activeGlyphs = glyphs
+	}
+}
+
+func glyph(piece rune) rune {
+	if army, ok := armies[piece]; ok {
+		piece = army.base
+	}
+	if g, ok := activeGlyphs[piece]; ok {
+		return g
+	}
+
+	return piece
+}
 
 /*
  * Game messages
  */
 
 const welcomeMessage = "Welcome to xxxxxx Chess"
-const initialBoardMessage = "\nSelect board size to start.\nValues must be between 6 and 12 on each dimension.\n\n"
+const initialBoardMessage = "\nSelect board size to start.\nValues must be between 6 and 26 on each dimension.\n\n"
 const promptWidthMsg = "Enter Board width (X): "
 const promptHeightMsg = "Enter Board height (Y): "
+const configErrorMsg = "Config error: %v\n"
+const playerErrorMsg = "Player error: %v\n"
 const promptContinueMsg = "\nType a command (type help for options): \n> "
 const invalidInputMsg = "\n\nInvalid input. Please enter a number between %d and %d.\n"
 const creatingBoardMsg = "\n\nCreating board of size %dx%d\n"
@@ -92,31 +241,207 @@ const blackTurnMsg = "\n\nIt's Black's turn. You can only move black pieces.\n"
 const unknownPieceMsg = "\n\nUnknown piece type.\n"
 const invalidMoveMsg = "\n\nInvalid move for this piece type.\n"
 const cannotCaptureSelfMsg = "\n\nCannot capture your own piece.\n"
-const moveUsageMsg = "\n\nUsage: move <from> <to>\n"
+const moveUsageMsg = "\n\nUsage: move <from> <to>[=<piece>]\n"
+const waitForEngineMsg = "\n\nWait for the computer to move.\n"
+const engineErrorMsg = "\n\nComputer player failed: %v\n"
+const networkErrorMsg = "Network error: %v\n"
 const gameEndedMsg = "Game ended by player"
 const gameOverMsg = "Game Over!"
 const gameOverThanksMsg = "\n\nGame Over! Thanks for playing!"
+const gameOverOptionsMsg = "\nType new, rematch, review or save.\n"
 const blackWinsMsg = "⬛ Black wins! 🎉"
 const whiteWinsMsg = "⬜ White wins! 🎉"
+const drawMsg = "Draw! 🤝"
+const redWinsMsg = "🟥 Red wins! 🎉"
+const blueWinsMsg = "🟦 Blue wins! 🎉"
 const gameResetMsg = "Game reset"
+const moveTakenBackMsg = "\nMove %s taken back\n"
+const resignedMsg = "%s resigns\n"
+const drawAgreedMsg = "Draw agreed\n"
+const resignedBannerMsg = "%s resigns. %s wins!"
+const drawAgreedBannerMsg = "Draw agreed"
 const whiteTurnIndicator = "\n\n⬜ Turn: White\n"
 const blackTurnIndicator = "\n\n⬛ Turn: Black\n"
+const checkIndicator = "Check!\n"
 
 const helpMessage = `
 
 Available commands:
-  move <from> <to>       Move a piece (e.g. move B1 C3)
+  move <from> <to>       Move a piece (e.g. move B1 C3, or move A5 A6=H to promote)
+  drop <piece>@<square>  Drop a captured piece in games with drops (e.g. drop H@E4)
+  resign                 Resign the game (in four-player games, leave it)
+  offer draw             Offer a draw on your turn
+  accept / decline       Answer your opponent's offer on your turn
   restart                Restart the match
+  edit                   Set up a custom starting position
   exit                   Exit the game
-  help                   Show this list`
+  help                   Show this list
+
+Network games:
+  chat <message>         Send a message to your opponent
+  undo                   Ask to take back your last move`
 
 func main() {
+	flags := flag.NewFlagSet(appName, flag.ExitOnError)
+	configPath := bindConfigFlags(flags)
+	headless := flags.Bool("headless", false, "play without the terminal UI, reading commands line by line")
+	input := flags.String("input", "", "file to read headless commands from (default stdin)")
+	format := flags.String("format", "text", "headless output format: text or json")
+	whiteSpec := flags.String("white", "human", "who plays White: "+playerSpecHelp)
+	blackSpec := flags.String("black", "human", "who plays Black: "+playerSpecHelp)
+	hostAddr := flags.String("host", "", "host a network game on this address (e.g. :7878)")
+	joinAddr := flags.String("join", "", "join the network game hosted at this address")
+	flags.Parse(os.Args[1:])
+
+	cfg, err := loadConfig(*configPath)
+	if err == nil {
+		err = applyConfigFlags(flags, &cfg)
+	}
+	// `config set` reads the file itself and may be repairing it
+	if err != nil && (flags.Arg(0) != "config" || flags.Arg(1) != "set") {
+		fmt.Printf(configErrorMsg, err)
+		os.Exit(1)
+	}
+
+	applyRenderConfig(cfg)
+
+	switch flags.Arg(0) {
+	case "config":
+		if err := runConfigCommand(flags.Args()[1:], *configPath, cfg, os.Stdout); err != nil {
+			fmt.Printf(configErrorMsg, err)
+			os.Exit(1)
+		}
+		return
+
+	case "engine":
+		if v, _ := loadVariant(cfg.Variant); v != nil && v.Name != defaultVariant {
+			fmt.Fprintln(os.Stderr, errEngineVariant)
+			os.Exit(1)
+		}
+		if err := runEngineProtocol(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+
+	case "match":
+		if err := runMatchCommand(flags.Args()[1:], cfg, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+
+	case "api":
+		if err := runAPICommand(flags.Args()[1:], cfg, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+
+	case "games":
+		if err := runGamesCommand(flags.Args()[1:], cfg, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+
+	case "leaderboard":
+		if err := runLeaderboardCommand(flags.Args()[1:], cfg, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+
+	case "stats":
+		if err := runStatsCommand(flags.Args()[1:], cfg, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+
+	case "watch":
+		if err := runWatchCommand(flags.Args()[1:], cfg, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+
+	case "variants":
+		if err := runVariantsCommand(flags.Args()[1:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+
+	case "serve":
+		if err := runServeCommand(flags.Args()[1:], cfg, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var players [2]movePicker
+	for i, spec := range []string{*whiteSpec, *blackSpec} {
+		if players[i], err = newPlayer(spec, cfg); err != nil {
+			closePlayers(players)
+			fmt.Printf(playerErrorMsg, err)
+			os.Exit(1)
+		}
+	}
+	defer closePlayers(players)
+
+	if v, _ := loadVariant(cfg.Variant); v != nil && v.Players == fourPlayers && (players[0] != nil || players[1] != nil || *headless || *hostAddr != "" || *joinAddr != "") {
+		fmt.Printf(playerErrorMsg, errFourPlayersLocal)
+		os.Exit(1)
+	}
+
+	if *headless {
+		code := headlessMain(cfg, players, *input, *format)
+		closePlayers(players)
+		os.Exit(code)
+	}
+
+	m := newModel(cfg)
+	m.players = players
+	m.names = playerNames(*whiteSpec, *blackSpec)
+
+	if *hostAddr != "" || *joinAddr != "" {
+		if err := checkNetPlayers(players); err != nil {
+			fmt.Printf(playerErrorMsg, err)
+			os.Exit(1)
+		}
+		if *hostAddr != "" {
+			m.net, err = hostGame(*hostAddr)
+		} else {
+			m.net, err = joinGame(*joinAddr)
+		}
+		if err != nil {
+			fmt.Printf(networkErrorMsg, err)
+			os.Exit(1)
+		}
+		defer m.net.Close()
+	}
+
+	p := tea.NewProgram(m)
+
+	if _, err := p.Run(); err != nil {
+		fmt.Printf("Error starting program: %v\n", err)
+	}
+}
+
+// newModel returns a model waiting for the board size to be entered.
+func newModel(cfg Config) Model {
 	ti := textinput.New()
 	ti.Prompt = promptWidthMsg
-	ti.CharLimit = 20
+	ti.CharLimit = 256
 	ti.Width = 20
 
-	p := tea.NewProgram(Model{
+	// the config is checked when it is loaded; a variant that cannot be
+	// loaded leaves nil, which plays the small game
+	v, _ := loadVariant(cfg.Variant)
+
+	return Model{
 		Board: Board{
 			Width:  0,
 			Height: 0,
@@ -127,10 +452,8 @@ func main() {
 		startTime:   time.Time{},
 		logFile:     "",
 		isWhiteTurn: true,
-	})
-
-	if _, err := p.Run(); err != nil {
-		fmt.Printf("Error starting program: %v\n", err)
+		config:      cfg,
+		variant:     v,
 	}
 }
 
@@ -148,7 +471,7 @@ func (m Model) View() string {
 
 func (m Model) Init() tea.Cmd {
 	// needed by model.
-	return nil
+	return m.waitForNet()
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -156,18 +479,26 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
-		switch msg.Type {
+		if m.phase == phaseEditing && m.prompt.Value() == "" {
+			m = moveCursor(m, msg.String())
+		}
+
+		switch m.config.keyAction(msg.String()) {
 
-		case tea.KeyCtrlC, tea.KeyEsc:
+		case actionQuit:
 			return m, tea.Quit
 
-		case tea.KeyEnter:
-			if m.Board.Width == 0 || m.Board.Height == 0 {
+		case actionSubmit:
+			if m.isGuestWaiting() {
+				m.prompt.SetValue("")
+				return m, cmd
+			}
+			if m.phase == phaseSetup && (m.Board.Width == 0 || m.Board.Height == 0) {
 				if m.Board.Width == 0 {
-					w, err := strconv.Atoi(m.prompt.Value())
-					if err != nil || !validateBoardSize(w) {
+					w, err := strconv.Atoi(m.promptValueOr(m.config.Width))
+					if err != nil || !m.rules().validSize(w) {
 						if !strings.Contains(m.Body.String(), invalidInputMsg) {
-							m.Body.WriteString(fmt.Sprintf(invalidInputMsg, minValidSize, maxValidSize))
+							m.Body.WriteString(fmt.Sprintf(invalidInputMsg, m.rules().MinSize, m.rules().MaxSize))
 						}
 						m.prompt.SetValue("")
 						return m, cmd
@@ -176,10 +507,10 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 						m.prompt.SetValue("")
 					}
 				} else if m.Board.Height == 0 {
-					h, err := strconv.Atoi(m.prompt.Value())
-					if err != nil || !validateBoardSize(h) {
+					h, err := strconv.Atoi(m.promptValueOr(m.config.Height))
+					if err != nil || !m.rules().validSize(h) {
 						if !strings.Contains(m.Body.String(), invalidInputMsg) {
-							m.Body.WriteString(fmt.Sprintf(invalidInputMsg, minValidSize, maxValidSize))
+							m.Body.WriteString(fmt.Sprintf(invalidInputMsg, m.rules().MinSize, m.rules().MaxSize))
 						}
 						m.prompt.SetValue("")
 						return m, cmd
@@ -187,158 +518,230 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 						m.Board.Height = h
 						m.prompt.SetValue("")
 						m.Body.WriteString(fmt.Sprintf(creatingBoardMsg, m.Board.Width, m.Board.Height))
-						m.Table = createInitialTableMap(m.Board.Width, m.Board.Height)
-						m.startTime = time.Now()
-						m.logFile = m.createNewLogFile()
-
-						writeToHistory(fmt.Sprintf("Game started with board size %dx%d\n", m.Board.Width, m.Board.Height), m.logFile)
+						m = chooseStart(m)
 					}
 				}
-			} else {
-				switch strings.Split(strings.ToLower(m.prompt.Value()), " ")[0] {
-				case "restart":
-					m = resetGame(m)
+			} else if m.phase == phaseSetup && m.startPending {
+				var ok bool
+				if m, ok = pickStart(m); !ok {
 					return m, cmd
-
-				case "exit":
-					if m.logFile != "" {
-						writeToHistory(gameEndedMsg, m.logFile)
-					}
-					return m, tea.Quit
-
-				case "help", "h":
-					if !strings.Contains(m.Body.String(), helpMessage) {
-						m.Body.WriteString(helpMessage)
-					}
+				}
+			} else if m.phase == phaseSetup && m.pickSide != 0 {
+				var ok bool
+				if m, ok = pickPlayer(m); !ok {
 					return m, cmd
-
-				case "move", "mv":
-					base := strings.Split(strings.ToLower(m.prompt.Value()), " ")
-					if len(base) < 3 {
-						m.Body.WriteString(moveUsageMsg)
+				}
+			} else {
+				input := m.prompt.Value()
+				if m.handover {
+					m.handover = false
+					m.prompt.SetValue("")
+					return redrawGame(m), cmd
+				}
+				if m.promoting != ([2]string{}) {
+					var ok bool
+					if input, ok = pickPromotion(m, input); !ok {
 						m.prompt.SetValue("")
 						return m, cmd
 					}
-					from := base[1]
-					to := base[2]
-					m, msg := movePiece(from, to, m)
-					if msg != "" {
-						m.Body.WriteString(msg)
-					}
+					m.promoting = [2]string{}
+				} else if from, to, ok := needsPromotionChoice(m, input); ok {
+					m.promoting = [2]string{from, to}
 					m.prompt.SetValue("")
-					return m, cmd
-
-				default:
-					if !strings.Contains(m.Body.String(), invalidCommandMsg) {
-						m.Body.WriteString(invalidCommandMsg)
-					}
-					return m, cmd
+					return redrawGame(m), cmd
+				}
+				white := m.isWhiteTurn
+				m, outcome := runCommand(m, input)
+				if outcome.quit {
+					return m, tea.Quit
 				}
+				if outcome.message != "" && !strings.Contains(m.Body.String(), outcome.message) {
+					m.Body.WriteString(outcome.message)
+				}
+				if m.hotSeat() && m.isWhiteTurn != white && m.phase == phasePlaying {
+					m.handover = true
+					m = redrawGame(m)
+				}
+				m.prompt.SetValue("")
+				return m.withMachineMove(cmd)
 			}
 		}
+	case machineMoveMsg:
+		m.thinking = false
+		if msg.game != m.startTime || m.phase != phasePlaying {
+			return m.withMachineMove(nil)
+		}
+		err := msg.err
+		if err == nil {
+			m, err = playMachineMove(m, msg.mv)
+		}
+		if err != nil {
+			m.engineFailed = true
+			m.Body.WriteString(fmt.Sprintf(engineErrorMsg, err))
+			return m, nil
+		}
+		return m.withMachineMove(nil)
+	case netMsg:
+		m, text := handleNetMessage(m, netMessage(msg))
+		if m.Table != nil {
+			m = redrawGame(m)
+		}
+		if text != "" {
+			m.Body.WriteString(text)
+		}
+		return m, m.waitForNet()
 	case errMsg:
 		m.err = msg
 		return m, nil
 	}
 
 	m.prompt, cmd = m.prompt.Update(msg)
+	m = renderBody(m)
+
+	return m.withMachineMove(cmd)
+}
 
-	if m.Board.Width == 0 || m.Board.Height == 0 {
+// renderBody draws the screen for the current stage: the size prompts, the
+// guest's waiting screen or the game.
+func renderBody(m Model) Model {
+	if m.isGuestWaiting() {
+		m.Body.Reset()
+		m.Body.Write([]byte(drawBoxMessage(welcomeMessage)))
+		m.Body.WriteString(waitingForHostMsg)
+	} else if m.Board.Width == 0 || m.Board.Height == 0 {
 		m.Body.Reset()
 
 		m.Body.Write([]byte(drawBoxMessage(welcomeMessage)))
+		if m.net != nil && m.net.listener != nil {
+			m.Body.WriteString(fmt.Sprintf(hostingMsg, m.net.addr))
+		}
 		m.Body.Write([]byte(initialBoardMessage))
 
 		if m.Board.Width != 0 {
 			m.prompt.Prompt = promptHeightMsg
+			m.prompt.Placeholder = sizePlaceholder(m.config.Height)
 		} else {
 			m.prompt.Prompt = promptWidthMsg
+			m.prompt.Placeholder = sizePlaceholder(m.config.Width)
 		}
 
 		m.Body.WriteString(m.prompt.View())
 		m.prompt.Focus()
+	} else if m.startPending {
+		m = renderPickStart(m)
+	} else if m.pickSide != 0 {
+		m = renderPickPlayer(m)
 	} else {
-		m.Body.Reset()
+		m = redrawGame(m)
+	}
+
+	return m
+}
+
+// redrawGame replaces the body with the board, whose turn it is (or the
+// result) and the command prompt. While reviewing, the reviewed position is
+// shown instead.
+func redrawGame(m Model) Model {
+	if m.phase == phaseEditing {
+		return renderEditor(m)
+	}
+
+	if m.handover {
+		return renderHandover(m)
+	}
+
+	m.Body.Reset()
+	m.Body.WriteString("\n\n")
+
+	if m.phase == phaseReviewing {
+		m.Body.WriteString(drawBoard(m.Board, reviewTable(m), nil))
+		m.Body.WriteString(reviewCaption(m))
+	} else {
+		m.Body.WriteString(drawBoard(m.Board, m.boardView(m.Table), nil))
+	}
+
+	if m.phase == phaseReviewing {
+		m.Body.WriteString(strings.TrimPrefix(reviewHelpMsg, "\n"))
+		m.Body.WriteString("\n")
+	} else if m.result != resultNone {
 		m.Body.WriteString("\n\n")
-		m.Body.WriteString(drawTableWithMap(m.Board.Height, m.Board.Width, m.Table))
+		m.Body.WriteString(drawBoxMessage(m.resultMessage()))
+		m.Body.WriteString(gameOverOptionsMsg)
+	} else {
+		m.Body.WriteString(turnIndicator(m))
+	}
 
-		if m.isWhiteTurn {
-			m.Body.WriteString(whiteTurnIndicator)
-		} else {
-			m.Body.WriteString(blackTurnIndicator)
-		}
+	m.prompt.Prompt = promptContinueMsg
+	if m.promoting != ([2]string{}) {
+		m.prompt.Prompt = promotionPrompt(m)
+	}
+	m.prompt.Placeholder = ""
+	m.Body.WriteString(m.prompt.View())
+	m.prompt.Focus()
 
-		m.prompt.Prompt = promptContinueMsg
-		m.Body.WriteString(m.prompt.View())
-		m.prompt.Focus()
+	return m
+}
+
+// promptValueOr returns the typed prompt value, or the configured default
+// when the prompt was submitted empty.
+func (m Model) promptValueOr(def int) string {
+	if m.prompt.Value() == "" && def != 0 {
+		return strconv.Itoa(def)
 	}
 
-	return m, cmd
+	return m.prompt.Value()
+}
+
+func sizePlaceholder(def int) string {
+	if def == 0 {
+		return ""
+	}
+
+	return strconv.Itoa(def)
 }
 
 /*
  * Validations
  */
 
+// isValidKingMove, isValidTowerMove and isValidHorseMove check the
+// movement of the standard pieces on an empty board.
 func isValidKingMove(fromCol, fromRow, toCol, toRow int) bool {
-	colDiff := abs(toCol - fromCol)
-	rowDiff := abs(toRow - fromRow)
-	return colDiff <= 1 && rowDiff <= 1 && !(colDiff == 0 && rowDiff == 0)
+	valid, _ := isValidPieceMove(WhiteKing, nil, Board{}, fromCol, fromRow, toCol, toRow)
+	return valid
 }
 
 func isValidTowerMove(fromCol, fromRow, toCol, toRow int) bool {
-	colDiff := abs(toCol - fromCol)
-	rowDiff := abs(toRow - fromRow)
-
-	straightMove := (colDiff == 0 && rowDiff > 0 && rowDiff <= 3) || (rowDiff == 0 && colDiff > 0 && colDiff <= 3)
-	diagonalMove := (colDiff == rowDiff) && colDiff > 0 && colDiff <= 3
-
-	return straightMove || diagonalMove
+	valid, _ := isValidPieceMove(WhiteTower, nil, Board{}, fromCol, fromRow, toCol, toRow)
+	return valid
 }
 
 func isValidHorseMove(fromCol, fromRow, toCol, toRow int) bool {
-	colDiff := abs(toCol - fromCol)
-	rowDiff := abs(toRow - fromRow)
-
-	return (colDiff == 2 && rowDiff == 1) || (colDiff == 1 && rowDiff == 2)
+	valid, _ := isValidPieceMove(WhiteHorse, nil, Board{}, fromCol, fromRow, toCol, toRow)
+	return valid
 }
 
+// validateCoordinate checks that coord, such as "b1" or "L12", names a
+// square of the board.
 func validateCoordinate(coord string, m Model) bool {
-	height := m.Board.Height
-	width := m.Board.Width
-
-	if len(coord) != 2 {
-		return false
-	}
+	col, rank, ok := parseSquare(coord)
 
-	col := coord[0]
-	row := coord[1]
-
-	col = strings.ToUpper(string(col))[0]
-	if col < 'A' || col >= byte('A'+width) {
-		return false
-	}
-
-	if row < '1' || row > byte('0'+height) {
-		return false
-	}
-	return true
+	return ok && col < m.Board.Width && rank <= m.Board.Height
 }
 
+// validateBoardSize checks a side against the sizes of the small game.
 func validateBoardSize(side int) bool {
-	if side < minValidSize || side > maxValidSize {
-		return false
-	}
-
-	return true
+	return smallVariant().validSize(side)
 }
 
 func isWhitePiece(piece rune) bool {
-	return piece == WhiteKing || piece == WhiteTower || piece == WhiteHorse
+	info, ok := pieces[piece]
+	return ok && info.white
 }
 
 func isBlackPiece(piece rune) bool {
-	return piece == BlackKing || piece == BlackTower || piece == BlackHorse
+	info, ok := pieces[piece]
+	return ok && info.color == colorBlack
 }
 
 /*
@@ -353,17 +756,39 @@ func abs(x int) int {
 	return x
 }
 
+// createNewLogFile creates an empty history file named after the start
+// time and m.logTag. Games started in the same second, as over SSH, get a
+// numbered name each rather than sharing a file.
 func (m *Model) createNewLogFile() string {
-	historyDir := "history"
+	historyDir := m.config.historyDir()
 	if err := os.MkdirAll(historyDir, 0755); err != nil {
 		return ""
 	}
 
-	filename := fmt.Sprintf("game_%02d_%02d_%02d_%02d_%02d.txt",
-		m.startTime.Day(), m.startTime.Month(),
+	prefix := "game_"
+	if m.logTag != "" {
+		prefix += m.logTag + "_"
+	}
+	stamp := fmt.Sprintf("%s%d_%02d_%02d_%02d_%02d_%02d", prefix,
+		m.startTime.Year(), m.startTime.Month(), m.startTime.Day(),
 		m.startTime.Hour(), m.startTime.Minute(), m.startTime.Second())
 
-	return filepath.Join(historyDir, filename)
+	for n := 1; ; n++ {
+		filename := stamp + ".txt"
+		if n > 1 {
+			filename = fmt.Sprintf("%s_%d.txt", stamp, n)
+		}
+		path := filepath.Join(historyDir, filename)
+
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return path
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return ""
+		}
+	}
 }
 
 func writeToHistory(message string, logFile string) error {
@@ -371,9 +796,7 @@ func writeToHistory(message string, logFile string) error {
 		return fmt.Errorf("no log file specified")
 	}
 
-	historyDir := "history"
-
-	if err := os.MkdirAll(historyDir, 0755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(logFile), 0755); err != nil {
 		return err
 	}
 
@@ -397,16 +820,24 @@ func writeToHistory(message string, logFile string) error {
  */
 
 func movePiece(from, to string, m Model) (Model, string) {
+	if m.phase == phaseFinished || m.phase == phaseReviewing {
+		return m, gameIsOverMsg
+	}
+	if m.fourPlayer() {
+		return fourPlayerMove(from, to, m)
+	}
+	if letter, ok := strings.CutSuffix(from, "@"); ok {
+		return dropPiece(letter, to, m)
+	}
+	to, choice := splitPromotion(to)
 	if !validateCoordinate(from, m) || !validateCoordinate(to, m) {
 		return m, invalidCoordinatesMsg
 	}
-	fromCol := int(strings.ToUpper(string(from[0]))[0] - 'A')
-	fromRow := m.Board.Height - int(from[1]-'0')
-	toCol := int(strings.ToUpper(string(to[0]))[0] - 'A')
-	toRow := m.Board.Height - int(to[1]-'0')
+	fromCol, fromRow := coordinateToPosition(from, m.Board.Height)
+	toCol, toRow := coordinateToPosition(to, m.Board.Height)
 	piece, ok := m.Table[[2]int{fromCol, fromRow}]
 
-	if !ok || piece == EC {
+	if !ok || piece == EC || piece == HC {
 		return m, noPieceMsg
 	}
 
@@ -417,24 +848,24 @@ func movePiece(from, to string, m Model) (Model, string) {
 		return m, blackTurnMsg
 	}
 
-	var validMove bool
-
-	switch piece {
-	case WhiteKing, BlackKing:
-		validMove = isValidKingMove(fromCol, fromRow, toCol, toRow)
-	case WhiteTower, BlackTower:
-		validMove = isValidTowerMove(fromCol, fromRow, toCol, toRow)
-	case WhiteHorse, BlackHorse:
-		validMove = isValidHorseMove(fromCol, fromRow, toCol, toRow)
-	default:
-		return m, unknownPieceMsg
+	rules := m.rules()
+	mv := move{fromCol, fromRow, toCol, toRow, choice}
+	if choice != 0 && !slices.Contains(rules.promotions(piece, toRow, m.Board), string(choice)) {
+		return m, invalidPromotionMsg
 	}
+	record := rules.record(m.Table, m.Board, m.isWhiteTurn, mv, m.moves)
+	if !record.enPassant && record.castle == nil {
+		validMove, known := isValidPieceMove(piece, m.Table, m.Board, fromCol, fromRow, toCol, toRow)
+		if !known {
+			return m, unknownPieceMsg
+		}
 
-	if !validMove {
-		return m, invalidMoveMsg
+		if !validMove {
+			return m, invalidMoveMsg
+		}
 	}
 
-	captured := m.Table[[2]int{toCol, toRow}]
+	captured := record.captured
 
 	if captured != 0 && captured != EC {
 		if m.isWhiteTurn && isWhitePiece(captured) {
@@ -445,38 +876,82 @@ func movePiece(from, to string, m Model) (Model, string) {
 		}
 	}
 
-	msg := ""
-	isGameOver := false
-	if captured != 0 && captured != EC {
-		msg = fmt.Sprintf("Moved %c from %s to %s. Captured %c \n", piece, from, to, captured)
+	if rules.wins(winCheckmate) && leavesKingAttacked(m.Table, m.Board, record, m.isWhiteTurn) {
+		return m, kingLeftInCheckMsg
+	}
+
+	if record.removesKing(m.isWhiteTurn) {
+		return m, ownKingCaptureMsg
+	}
+
+	return playRecord(m, record, formatMove(m.config.Notation, piece, from, to, captured, record.promoted))
+}
+
+// playRecord plays a validated move, described by msg, ends the game when
+// it is won or drawn and shows the position after it.
+func playRecord(m Model, record moveRecord, msg string) (Model, string) {
+	rules := m.rules()
+	piece := record.piece
+	result := resultNone
+	if record.removesKing(true) {
+		msg += drawBoxMessage(blackWinsMsg)
+		result = resultBlackWins
+	} else if record.removesKing(false) {
+		msg += drawBoxMessage(whiteWinsMsg)
+		result = resultWhiteWins
+	}
+
+	m.Table.play(record)
+	m.moves = append(m.moves, record)
+	m = lapseDrawOffer(m, isWhitePiece(piece))
+	m.isWhiteTurn = !m.isWhiteTurn
 
-		if captured == WhiteKing {
-			msg += drawBoxMessage(fmt.Sprintf("blackWinsMsg"))
-			isGameOver = true
-		} else if captured == BlackKing {
-			msg += drawBoxMessage(fmt.Sprintf("whiteWinsMsg"))
-			isGameOver = true
+	if result == resultNone {
+		var reason string
+		if result, reason = rules.outcome(m.Table, m.Board, !m.isWhiteTurn, piece, record.mv.toRow, m.moves); result != resultNone {
+			if !strings.HasSuffix(msg, EOL) {
+				msg += EOL
+			}
+			msg += drawBoxMessage(reason)
+			m.endReason = reason
+		}
+	}
+
+	return finishTurn(m, piece, result, msg)
+}
+
+// finishTurn ends the turn of a move of piece, described by msg: it checks
+// the draw rules unless the move already decided the game, logs the move,
+// ends the game when result says so and shows the position.
+func finishTurn(m Model, piece rune, result gameResult, msg string) (Model, string) {
+	rules := m.rules()
+	if result == resultNone {
+		if reason := drawReason(m, rules.moveLimit(m.config.MoveLimit)); reason != "" {
+			if !strings.HasSuffix(msg, EOL) {
+				msg += EOL
+			}
+			msg += drawBoxMessage(reason)
+			result = resultDraw
+			m.endReason = reason
 		}
-	} else {
-		msg = fmt.Sprintf("Moved %c from %s to %s.", piece, from, to)
 	}
 
 	writeToHistory(msg, m.logFile)
 
-	if isGameOver {
+	if result != resultNone {
+		m = finishGame(m, result)
 		writeToHistory(gameOverMsg, m.logFile)
+		recordGame(m)
 	}
-
-	delete(m.Table, [2]int{fromCol, fromRow})
-	m.Table[[2]int{toCol, toRow}] = piece
 	m.Body.Reset()
 	m.Body.WriteString("\n\n")
-	m.Body.WriteString(drawTableWithMap(m.Board.Height, m.Board.Width, m.Table))
+	m.Body.WriteString(drawBoard(m.Board, m.boardView(m.Table), nil))
 
-	if isGameOver {
+	if result != resultNone {
 		m.Body.WriteString("\n\n")
 		m.Body.WriteString(msg)
 		m.Body.WriteString(gameOverThanksMsg)
+		m.Body.WriteString(gameOverOptionsMsg)
 		m.prompt.SetValue("")
 		m.prompt.Prompt = promptContinueMsg
 		m.Body.WriteString(m.prompt.View())
@@ -484,44 +959,148 @@ func movePiece(from, to string, m Model) (Model, string) {
 		return m, ""
 	}
 
-	m.isWhiteTurn = !m.isWhiteTurn
-
-	if m.isWhiteTurn {
-		m.Body.WriteString(whiteTurnIndicator)
-	} else {
-		m.Body.WriteString(blackTurnIndicator)
-	}
+	m.Body.WriteString(turnIndicator(m))
 
 	m.prompt.SetValue("")
 	m.prompt.Prompt = promptContinueMsg
 	m.Body.WriteString(m.prompt.View())
 	m.prompt.Focus()
 
-	if msg != "" {
+	// in fog the move is only described to a viewer who could see it
+	if viewer, fogged := m.viewer(); msg != "" && (!fogged || viewer == isWhitePiece(piece)) {
 		m.Body.WriteString("\n\n" + msg)
 	}
 
 	return m, ""
 }
 
+// turnIndicator shows whose turn it is, in games won by checkmate whether
+// their King is in check, and in games with drops what each side holds.
+func turnIndicator(m Model) string {
+	if m.fourPlayer() {
+		return seatIndicator(m)
+	}
+
+	indicator := blackTurnIndicator
+	if m.isWhiteTurn {
+		indicator = whiteTurnIndicator
+	}
+	if m.rules().wins(winCheckmate) && kingAttacked(m.Table, m.Board, m.isWhiteTurn) {
+		indicator += checkIndicator
+	}
+
+	return indicator + handsIndicator(m)
+}
+
+// formatMove describes a move in the given notation style. Captured is 0 or
+// EC when the destination was empty, promoted 0 when the piece did not
+// promote.
+func formatMove(notation string, piece rune, from, to string, captured, promoted rune) string {
+	isCapture := captured != 0 && captured != EC
+	from = strings.ToLower(from)
+	to = strings.ToLower(to)
+
+	switch notation {
+	case "algebraic":
+		if promoted != 0 {
+			to += "=" + string(glyph(promoted))
+		}
+		if isCapture {
+			return fmt.Sprintf("%c%sx%s\n", glyph(piece), from, to)
+		}
+		return fmt.Sprintf("%c%s-%s", glyph(piece), from, to)
+	case "coordinate":
+		if promoted != 0 {
+			to += string(unicode.ToLower(pieces[promoted].def.letter))
+		}
+		if isCapture {
+			return fmt.Sprintf("%s%s\n", from, to)
+		}
+		return from + to
+	}
+
+	if promoted != 0 {
+		to += fmt.Sprintf(" and promoted to %c", glyph(promoted))
+	}
+	if isCapture {
+		return fmt.Sprintf("Moved %c from %s to %s. Captured %c \n", glyph(piece), from, to, glyph(captured))
+	}
+
+	return fmt.Sprintf("Moved %c from %s to %s.", glyph(piece), from, to)
+}
+
+// undoMove takes back the last move, reopening the game if that move ended
+// it.
+func undoMove(m Model) (Model, bool) {
+	if len(m.moves) == 0 {
+		return m, false
+	}
+
+	last := m.moves[len(m.moves)-1]
+	m.moves = m.moves[:len(m.moves)-1]
+	m.Table.unplay(last)
+	m.isWhiteTurn = isWhitePiece(last.piece)
+	m.result = resultNone
+	m.endReason = ""
+	m.phase = phasePlaying
+
+	writeToHistory(fmt.Sprintf(moveTakenBackMsg, moveText(last.mv, m.Board.Height)), m.logFile)
+
+	return m, true
+}
+
+// takeBack undoes moves until it is the requesting side's turn again, so
+// their last move is gone.
+func takeBack(m Model, white bool) (Model, bool) {
+	plies := 1
+	if n := len(m.moves); n > 0 && isWhitePiece(m.moves[n-1].piece) != white {
+		plies = 2
+	}
+	if len(m.moves) < plies {
+		return m, false
+	}
+
+	for i := 0; i < plies; i++ {
+		m, _ = undoMove(m)
+	}
+
+	return m, true
+}
+
+// resignGame ends the game in favour of the other side.
+func resignGame(m Model, white bool) Model {
+	m = finishGame(m, resultWhiteWins)
+	if white {
+		m.result = resultBlackWins
+	}
+	m.endReason = fmt.Sprintf(resignedBannerMsg, sideName(white), sideName(!white))
+
+	writeToHistory(fmt.Sprintf(resignedMsg, sideName(white)), m.logFile)
+	recordGame(m)
+
+	return m
+}
+
+func agreeDraw(m Model) Model {
+	m = finishGame(m, resultDraw)
+	m.endReason = drawAgreedBannerMsg
+	writeToHistory(drawAgreedMsg, m.logFile)
+	recordGame(m)
+
+	return m
+}
+
 func resetGame(m Model) Model {
 	if m.logFile != "" {
 		writeToHistory(gameResetMsg, m.logFile)
 	}
 
-	width := m.Board.Width
-	height := m.Board.Height
-
 	m.Body.Reset()
-	m.Table = createInitialTableMap(width, height)
-	m.startTime = time.Now()
-	m.logFile = m.createNewLogFile()
 	m.isWhiteTurn = true
-
-	writeToHistory(fmt.Sprintf("Game started with board size %dx%d\n", width, height), m.logFile)
+	m = startGame(m)
 
 	m.Body.WriteString("\n\n")
-	m.Body.WriteString(drawTableWithMap(height, width, m.Table))
+	m.Body.WriteString(drawBoard(m.Board, m.boardView(m.Table), nil))
 	m.Body.WriteString(whiteTurnIndicator)
 	m.prompt.SetValue("")
 	m.prompt.Prompt = promptContinueMsg
@@ -529,6 +1108,35 @@ func resetGame(m Model) Model {
 	return m
 }
 
+// startGame sets up the initial position for the model's board size and
+// opens a new history file for it.
+func startGame(m Model) Model {
+	m.Board.Topology = m.rules().Topology
+	m.Table, m.isWhiteTurn = m.startingPosition()
+	m.startTime = time.Now()
+	m.logFile = m.createNewLogFile()
+	m.phase = phasePlaying
+	m.result = resultNone
+	m.endReason = ""
+	m.moves = nil
+	m.offer = ""
+	m.engineFailed = false
+	m.seat, m.out = colorWhite, [fourPlayers]bool{}
+
+	writeToHistory(fmt.Sprintf("Game started with board size %dx%d\n", m.Board.Width, m.Board.Height), m.logFile)
+	if name := m.rules().Name; name != defaultVariant {
+		writeToHistory(fmt.Sprintf(variantHistoryMsg, name), m.logFile)
+	}
+	if m.startNote != "" {
+		writeToHistory(m.startNote+"\n", m.logFile)
+	}
+	if m.startFEN != "" {
+		writeToHistory(fmt.Sprintf(startPositionMsg, m.startFEN), m.logFile)
+	}
+
+	return m
+}
+
 func getCellValue(x, y int, t table) rune {
 	if piece, ok := t[[2]int{x, y}]; ok {
 		return piece
@@ -542,30 +1150,48 @@ func getCellValue(x, y int, t table) rune {
  */
 
 func drawTableWithMap(height, width int, t table) string {
+	return drawBoard(Board{Width: width, Height: height}, t, nil)
+}
+
+// drawBoard draws t on b with the cursor square, if any, bracketed and the
+// edges that wrap around dashed.
+func drawBoard(b Board, t table, cursor *[2]int) string {
 	var tableBuilder strings.Builder
 
-	buildTableTopLine(width, &tableBuilder)
-	buildTableMiddleLineWithMap(width, height, &tableBuilder, t)
-	buildTableBottomLine(width, &tableBuilder)
+	buildTableTopLine(b.Width, &tableBuilder, b.wrapsEnds())
+	buildTableMiddleLineWithMap(b.Width, b.Height, &tableBuilder, t, cursor, b.wrapsSides())
+	buildTableBottomLine(b.Width, &tableBuilder, b.wrapsEnds())
 
 	return tableBuilder.String()
 }
 
+// edgeRune returns the rune for an outer edge, dashed when it wraps.
+func edgeRune(edge rune, wraps bool) rune {
+	switch {
+	case !wraps:
+		return edge
+	case edge == activeTheme.horizontal:
+		return activeTheme.wrapHorizontal
+	default:
+		return activeTheme.wrapVertical
+	}
+}
+
 func drawBoxMessage(msg string) string {
 	padding := 5
 	emojiPad := 0
 	contentLen := len(msg) + padding*2
 
-	if strings.Contains(msg, "⬛") || strings.Contains(msg, "⬜") {
+	if strings.ContainsAny(msg, "⬛⬜🟥🟦") {
 		emojiPad = 1
 		padding += 1
 	}
 
 	var box strings.Builder
 
-	box.WriteString(fmt.Sprintf("%c%s%c%s", TLC, strings.Repeat(string(HL), contentLen), TRC, EOL))
-	box.WriteString(fmt.Sprintf("%c%s%s%s%c%s", VL, strings.Repeat(" ", padding), msg, strings.Repeat(" ", padding+emojiPad), VL, EOL))
-	box.WriteString(fmt.Sprintf("%c%s%c%s", BLC, strings.Repeat(string(HL), contentLen), BRC, EOL))
+	box.WriteString(fmt.Sprintf("%c%s%c%s", activeTheme.topLeft, strings.Repeat(string(activeTheme.horizontal), contentLen), activeTheme.topRight, EOL))
+	box.WriteString(fmt.Sprintf("%c%s%s%s%c%s", activeTheme.vertical, strings.Repeat(" ", padding), msg, strings.Repeat(" ", padding+emojiPad), activeTheme.vertical, EOL))
+	box.WriteString(fmt.Sprintf("%c%s%c%s", activeTheme.bottomLeft, strings.Repeat(string(activeTheme.horizontal), contentLen), activeTheme.bottomRight, EOL))
 
 	return box.String()
 }
@@ -573,29 +1199,29 @@ func drawBoxMessage(msg string) string {
 func drawTable(height, width int) string {
 	table := strings.Builder{}
 
-	buildTableTopLine(width, &table)
+	buildTableTopLine(width, &table, false)
 	buildTableMiddleLine(width, height, &table)
-	buildTableBottomLine(width, &table)
+	buildTableBottomLine(width, &table, false)
 
 	return table.String()
 }
 
-func buildTableTopLine(width int, table *strings.Builder) {
+func buildTableTopLine(width int, table *strings.Builder, wraps bool) {
 	table.WriteString(string("    "))
 	for i := 0; i < width; i++ {
-		table.WriteString(fmt.Sprintf("  %c ", 'A'+i))
+		table.WriteString(fmt.Sprintf(" %2s ", strings.ToUpper(fileName(i))))
 	}
 
 	table.WriteString(string(EOL))
 	table.WriteString(string("    "))
-	table.WriteString(string(TLC))
+	table.WriteString(string(activeTheme.topLeft))
 
 	for i := 0; i < width; i++ {
-		table.WriteString(strings.Repeat(string(HL), 3))
+		table.WriteString(strings.Repeat(string(edgeRune(activeTheme.horizontal, wraps)), 3))
 		if i < width-1 {
-			table.WriteString(string(TC))
+			table.WriteString(string(activeTheme.topCell))
 		} else {
-			table.WriteString(string(TRC))
+			table.WriteString(string(activeTheme.topRight))
 			table.WriteString(string(EOL))
 		}
 	}
@@ -605,8 +1231,8 @@ func buildTableMiddleLine(width, height int, tableBuilder *strings.Builder) {
 	chars := []struct {
 		left, center, right, accross rune
 	}{
-		{VL, EC, VL, VL},
-		{LC, HL, RC, CR},
+		{activeTheme.vertical, EC, activeTheme.vertical, activeTheme.vertical},
+		{activeTheme.leftCell, activeTheme.horizontal, activeTheme.rightCell, activeTheme.cross},
 	}
 
 	t := createInitialTableMap(width, height)
@@ -622,9 +1248,9 @@ func buildTableMiddleLine(width, height int, tableBuilder *strings.Builder) {
 
 		for w := 0; w < width; w++ {
 			if h%2 == 0 {
-				tableBuilder.WriteString(fmt.Sprintf(" %c ", getCellValue(w, h/2, t)))
+				tableBuilder.WriteString(fmt.Sprintf(" %c ", glyph(getCellValue(w, h/2, t))))
 			} else {
-				tableBuilder.WriteString(strings.Repeat(string(HL), 3))
+				tableBuilder.WriteString(strings.Repeat(string(activeTheme.horizontal), 3))
 			}
 			if w == width-1 {
 				tableBuilder.WriteString(string(chars[h%2].right))
@@ -636,12 +1262,13 @@ func buildTableMiddleLine(width, height int, tableBuilder *strings.Builder) {
 	}
 }
 
-func buildTableMiddleLineWithMap(width, height int, tableBuilder *strings.Builder, t table) {
+func buildTableMiddleLineWithMap(width, height int, tableBuilder *strings.Builder, t table, cursor *[2]int, wraps bool) {
+	side := edgeRune(activeTheme.vertical, wraps)
 	chars := []struct {
 		left, center, right, accross rune
 	}{
-		{VL, EC, VL, VL},
-		{LC, HL, RC, CR},
+		{side, EC, side, activeTheme.vertical},
+		{activeTheme.leftCell, activeTheme.horizontal, activeTheme.rightCell, activeTheme.cross},
 	}
 
 	for h := 0; h < height*2-1; h++ {
@@ -654,9 +1281,27 @@ func buildTableMiddleLineWithMap(width, height int, tableBuilder *strings.Builde
 		for w := 0; w < width; w++ {
 			if h%2 == 0 {
 				y := h / 2
-				tableBuilder.WriteString(fmt.Sprintf(" %c ", getCellValue(w, y, t)))
+				// holes and fog fill their squares
+				cell, filled := glyph(getCellValue(w, y, t)), true
+				switch getCellValue(w, y, t) {
+				case HC:
+					cell = activeTheme.hole
+				case FC:
+					cell = activeTheme.fog
+				default:
+					filled = false
+				}
+				// Red and Blue pieces are drawn in colour
+				drawn := tinted(getCellValue(w, y, t), string(cell))
+				if cursor != nil && *cursor == [2]int{w, y} {
+					tableBuilder.WriteString(fmt.Sprintf("[%s]", drawn))
+				} else if filled {
+					tableBuilder.WriteString(strings.Repeat(string(cell), 3))
+				} else {
+					tableBuilder.WriteString(fmt.Sprintf(" %s ", drawn))
+				}
 			} else {
-				tableBuilder.WriteString(strings.Repeat(string(HL), 3))
+				tableBuilder.WriteString(strings.Repeat(string(activeTheme.horizontal), 3))
 			}
 			if w == width-1 {
 				tableBuilder.WriteString(string(chars[h%2].right))
@@ -668,16 +1313,16 @@ func buildTableMiddleLineWithMap(width, height int, tableBuilder *strings.Builde
 	}
 }
 
-func buildTableBottomLine(width int, table *strings.Builder) {
+func buildTableBottomLine(width int, table *strings.Builder, wraps bool) {
 	table.WriteString(string("    "))
-	table.WriteString(string(BLC))
+	table.WriteString(string(activeTheme.bottomLeft))
 
 	for i := 0; i < width; i++ {
-		table.WriteString(strings.Repeat(string(HL), 3))
+		table.WriteString(strings.Repeat(string(edgeRune(activeTheme.horizontal, wraps)), 3))
 		if i < width-1 {
-			table.WriteString(string(BC))
+			table.WriteString(string(activeTheme.bottomCell))
 		} else {
-			table.WriteString(string(BRC))
+			table.WriteString(string(activeTheme.bottomRight))
 			table.WriteString(string(EOL))
 		}
 	}
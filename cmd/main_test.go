@@ -1,7 +1,9 @@
 package main
 
 import (
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestValidateBoardSize(t *testing.T) {
@@ -12,8 +14,9 @@ func TestValidateBoardSize(t *testing.T) {
 		{5, 5, false},
 		{6, 6, true},
 		{12, 12, true},
-		{13, 10, false},
-		{10, 13, false},
+		{26, 13, true},
+		{27, 10, false},
+		{10, 27, false},
 	}
 
 	for _, test := range tests {
@@ -51,6 +54,13 @@ func TestValidateCoordinate(t *testing.T) {
 			t.Errorf("validateCoordinate(%q) = %v; want %v", test.coord, result, test.expected)
 		}
 	}
+
+	big := Model{Board: Board{Width: 26, Height: 26}}
+	for coord, expected := range map[string]bool{"L12": true, "z26": true, "A27": false, "A01": false, "AA1": false, "A1B2": false} {
+		if result := validateCoordinate(coord, big); result != expected {
+			t.Errorf("validateCoordinate(%q) on 26x26 = %v; want %v", coord, result, expected)
+		}
+	}
 }
 
 func TestPieceIdentification(t *testing.T) {
@@ -147,3 +157,22 @@ func TestValidMoves(t *testing.T) {
 		})
 	}
 }
+
+func TestLogFilesAreNotShared(t *testing.T) {
+	cfg := headlessTestConfig(t)
+	start := time.Date(2026, 10, 18, 15, 4, 5, 0, time.Local)
+
+	seen := map[string]bool{}
+	for range 3 {
+		m := newModel(cfg)
+		m.startTime = start
+		path := m.createNewLogFile()
+		if path == "" || seen[path] {
+			t.Fatalf("log file %q for a game started in the same second", path)
+		}
+		seen[path] = true
+	}
+	if !seen[filepath.Join(cfg.HistoryDir, "game_2026_10_18_15_04_05_2.txt")] {
+		t.Errorf("log files: %v", seen)
+	}
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// matchOptions configures an engine-vs-engine match. Each start position is
+// played twice with colors swapped.
+type matchOptions struct {
+	engines      [2]string
+	games        int
+	concurrency  int
+	sizes        []Board // nil picks a random size for every pair of games
+	openingPlies int
+	maxPlies     int
+	seed         int64
+	reportEvery  int
+	sprt         *sprtOptions
+}
+
+// sprtOptions stops the match once the games decide between H0 (the Elo
+// difference is elo0) and H1 (it is elo1).
+type sprtOptions struct {
+	elo0, elo1  float64
+	alpha, beta float64
+}
+
+// matchGame is one scheduled game. Games 2n and 2n+1 share the board size
+// and opening, with engine 1 playing White in the even one.
+type matchGame struct {
+	index   int
+	board   Board
+	opening []move
+}
+
+type matchGameResult struct {
+	game   matchGame
+	result gameResult
+	plies  int
+	err    error
+}
+
+// matchStats counts results from engine 1's point of view.
+type matchStats struct {
+	wins, draws, losses int
+}
+
+type sprtDecision int
+
+const (
+	sprtContinue sprtDecision = iota
+	sprtAcceptH0
+	sprtAcceptH1
+)
+
+const matchUsage = "usage: match -engine1 <player> -engine2 <player> [flags]"
+
+/*
+ * command line
+ */
+
+func runMatchCommand(args []string, cfg Config, out io.Writer) error {
+	fs := flag.NewFlagSet("match", flag.ContinueOnError)
+	fs.SetOutput(out)
+
+	var opts matchOptions
+	fs.StringVar(&opts.engines[0], "engine1", "ai", "first player: "+playerSpecHelp)
+	fs.StringVar(&opts.engines[1], "engine2", "ai", "second player: "+playerSpecHelp)
+	fs.IntVar(&opts.games, "games", 100, "number of games, rounded up to an even number")
+	fs.IntVar(&opts.concurrency, "concurrency", 1, "games played at the same time")
+	sizes := fs.String("sizes", "8x8", "comma separated board sizes such as 6x6,8x10, or random")
+	fs.IntVar(&opts.openingPlies, "random-plies", 2, "random moves played from the start position before the engines take over")
+	fs.IntVar(&opts.maxPlies, "max-plies", 200, "adjudicate the game as a draw after this many plies")
+	fs.Int64Var(&opts.seed, "seed", 1, "seed for the random sizes and openings")
+	fs.IntVar(&opts.reportEvery, "report", 10, "print the standings every this many games")
+	sprt := fs.String("sprt", "", "stop early with a SPRT, given as elo0,elo1[,alpha,beta]")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if opts.games < 1 || opts.concurrency < 1 || opts.maxPlies < 1 || opts.openingPlies < 0 {
+		return fmt.Errorf(matchUsage)
+	}
+
+	rules := newModel(cfg).rules()
+	if rules.Players == fourPlayers {
+		return errFourPlayersLocal
+	}
+	var err error
+	if opts.sizes, err = parseBoardSizes(*sizes, rules.MinSize, rules.MaxSize); err != nil {
+		return err
+	}
+	if *sprt != "" {
+		if opts.sprt, err = parseSPRT(*sprt); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(out, "Match %s vs %s, %d games\n", opts.engines[0], opts.engines[1], opts.games+opts.games%2)
+
+	stats, decision, err := runMatch(context.Background(), cfg, opts, func(stats matchStats) {
+		if opts.reportEvery > 0 && stats.games()%opts.reportEvery == 0 {
+			fmt.Fprintln(out, stats.summary(opts.sprt))
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "Final: "+stats.summary(opts.sprt))
+	switch decision {
+	case sprtAcceptH0:
+		fmt.Fprintln(out, "SPRT: H0 accepted")
+	case sprtAcceptH1:
+		fmt.Fprintln(out, "SPRT: H1 accepted")
+	}
+
+	return nil
+}
+
+// parseBoardSizes reads "6x6,8x10" style lists of sides between minSize
+// and maxSize. "random" returns nil.
+func parseBoardSizes(text string, minSize, maxSize int) ([]Board, error) {
+	if text == "random" {
+		return nil, nil
+	}
+
+	var sizes []Board
+	for _, item := range strings.Split(text, ",") {
+		w, h, ok := strings.Cut(strings.TrimSpace(item), "x")
+		width, errW := strconv.Atoi(w)
+		height, errH := strconv.Atoi(h)
+		if !ok || errW != nil || errH != nil || min(width, height) < minSize || max(width, height) > maxSize {
+			return nil, fmt.Errorf("invalid board size %q: sides must be between %d and %d", item, minSize, maxSize)
+		}
+		sizes = append(sizes, Board{Width: width, Height: height})
+	}
+
+	return sizes, nil
+}
+
+func parseSPRT(text string) (*sprtOptions, error) {
+	parts := strings.Split(text, ",")
+	if len(parts) != 2 && len(parts) != 4 {
+		return nil, fmt.Errorf("sprt must be elo0,elo1[,alpha,beta]")
+	}
+
+	values := []float64{0, 0, 0.05, 0.05}
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("sprt must be elo0,elo1[,alpha,beta]: %w", err)
+		}
+		values[i] = v
+	}
+
+	s := &sprtOptions{elo0: values[0], elo1: values[1], alpha: values[2], beta: values[3]}
+	if s.elo0 >= s.elo1 || s.alpha <= 0 || s.alpha >= 1 || s.beta <= 0 || s.beta >= 1 {
+		return nil, fmt.Errorf("sprt needs elo0 < elo1 and alpha, beta between 0 and 1")
+	}
+
+	return s, nil
+}
+
+/*
+ * running games
+ */
+
+// runMatch plays the match, calling progress after every finished game. It
+// stops early when the SPRT reaches a decision.
+func runMatch(ctx context.Context, cfg Config, opts matchOptions, progress func(matchStats)) (matchStats, sprtDecision, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan matchGame)
+	results := make(chan matchGameResult)
+
+	go func() {
+		defer close(jobs)
+		for pair := 0; pair*2 < opts.games; pair++ {
+			board, opening := matchOpening(cfg, opts, pair)
+			for _, index := range []int{pair * 2, pair*2 + 1} {
+				select {
+				case jobs <- matchGame{index: index, board: board, opening: opening}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			matchWorker(ctx, cfg, opts, jobs, results)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var stats matchStats
+	decision := sprtContinue
+	var err error
+
+	for r := range results {
+		if err != nil || decision != sprtContinue {
+			continue
+		}
+		if r.err != nil {
+			err = fmt.Errorf("game %d: %w", r.game.index+1, r.err)
+			cancel()
+			continue
+		}
+
+		stats.add(r.result, r.game.index%2 == 0)
+		if progress != nil {
+			progress(stats)
+		}
+		if opts.sprt != nil {
+			if decision = stats.sprt(*opts.sprt); decision != sprtContinue {
+				cancel()
+			}
+		}
+	}
+
+	return stats, decision, err
+}
+
+// matchWorker plays games from jobs with its own pair of players, so
+// external engines are never shared between goroutines.
+func matchWorker(ctx context.Context, cfg Config, opts matchOptions, jobs <-chan matchGame, results chan<- matchGameResult) {
+	var players [2]movePicker
+	defer func() { closePlayers(players) }()
+
+	for i, spec := range opts.engines {
+		p, err := newPlayer(spec, cfg)
+		if err == nil && p == nil {
+			err = fmt.Errorf("match players cannot be human")
+		}
+		if err != nil {
+			select {
+			case results <- matchGameResult{err: err}:
+			case <-ctx.Done():
+			}
+			return
+		}
+		players[i] = p
+	}
+
+	for game := range jobs {
+		white, black := players[0], players[1]
+		if game.index%2 == 1 {
+			white, black = black, white
+		}
+
+		result, plies, err := playMatchGame(ctx, cfg, game, [2]movePicker{white, black}, opts.maxPlies)
+		if errors.Is(err, context.Canceled) {
+			return
+		}
+
+		select {
+		case results <- matchGameResult{game: game, result: result, plies: plies, err: err}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// matchOpening picks the board size and random opening for a pair of games.
+// It only depends on the seed and the pair number, so results can be
+// reproduced whatever the concurrency. Opening moves neither capture a King
+// nor end the game, and the configured variant's rules must allow them.
+func matchOpening(cfg Config, opts matchOptions, pair int) (Board, []move) {
+	rng := rand.New(rand.NewSource(opts.seed + int64(pair)))
+	rules := newModel(cfg).rules()
+
+	var b Board
+	if len(opts.sizes) > 0 {
+		b = opts.sizes[rng.Intn(len(opts.sizes))]
+	} else {
+		b = Board{
+			Width:  rules.MinSize + rng.Intn(rules.MaxSize-rules.MinSize+1),
+			Height: rules.MinSize + rng.Intn(rules.MaxSize-rules.MinSize+1),
+		}
+	}
+
+	m := matchModel(cfg, b)
+	var opening []move
+
+	for len(opening) < opts.openingPlies {
+		var quiet []move
+		for _, mv := range rules.generateMoves(m.Table, m.Board, m.isWhiteTurn) {
+			if !isKing(getCellValue(mv.toCol, mv.toRow, m.Table)) {
+				quiet = append(quiet, mv)
+			}
+		}
+
+		played := false
+		for len(quiet) > 0 && !played {
+			i := rng.Intn(len(quiet))
+			probe := m
+			probe.Table = m.Table.clone()
+			if next, err := playMachineMove(probe, quiet[i]); err == nil && next.result == resultNone {
+				m, played = next, true
+				opening = append(opening, quiet[i])
+			}
+			quiet = append(quiet[:i], quiet[i+1:]...)
+		}
+		if !played {
+			break
+		}
+	}
+
+	return b, opening
+}
+
+// matchModel sets up a game of the configured variant on b without a
+// history file.
+func matchModel(cfg Config, b Board) Model {
+	m := newModel(cfg)
+	m.Board = b
+	m.Board.Topology = m.rules().Topology
+	m.Table, m.isWhiteTurn = m.startingPosition()
+
+	return m
+}
+
+// playMatchGame plays one game through movePiece, so matches follow exactly
+// the rules of interactive games. Nothing is written to the history.
+func playMatchGame(ctx context.Context, cfg Config, game matchGame, players [2]movePicker, maxPlies int) (gameResult, int, error) {
+	m := matchModel(cfg, game.board)
+	m.players = players
+
+	for _, mv := range game.opening {
+		var err error
+		if m, err = playMachineMove(m, mv); err != nil {
+			return resultNone, 0, fmt.Errorf("opening: %w", err)
+		}
+	}
+
+	plies := len(game.opening)
+	for m.result == resultNone && plies < maxPlies {
+		if err := ctx.Err(); err != nil {
+			return resultNone, plies, err
+		}
+
+		mv, err := m.sidePlayer().pickMove(m.Table.clone(), m.Board, m.isWhiteTurn)
+		if err != nil {
+			return resultNone, plies, err
+		}
+
+		if m, err = playMachineMove(m, mv); err != nil {
+			return resultNone, plies, err
+		}
+		plies++
+	}
+
+	if m.result == resultNone {
+		return resultDraw, plies, nil
+	}
+
+	return m.result, plies, nil
+}
+
+/*
+ * statistics
+ */
+
+func (s *matchStats) add(r gameResult, engine1White bool) {
+	switch {
+	case r == resultDraw:
+		s.draws++
+	case (r == resultWhiteWins) == engine1White:
+		s.wins++
+	default:
+		s.losses++
+	}
+}
+
+func (s matchStats) games() int {
+	return s.wins + s.draws + s.losses
+}
+
+func (s matchStats) score() float64 {
+	return (float64(s.wins) + float64(s.draws)/2) / float64(s.games())
+}
+
+// variance is the per game variance of the score.
+func (s matchStats) variance() float64 {
+	n := float64(s.games())
+	mean := s.score()
+
+	return (float64(s.wins)*math.Pow(1-mean, 2) +
+		float64(s.draws)*math.Pow(0.5-mean, 2) +
+		float64(s.losses)*math.Pow(mean, 2)) / n
+}
+
+func eloFromScore(score float64) float64 {
+	return -400 * math.Log10(1/score-1)
+}
+
+func scoreFromElo(elo float64) float64 {
+	return 1 / (1 + math.Pow(10, -elo/400))
+}
+
+// elo returns the Elo difference of engine 1 over engine 2 and the margin
+// of its 95% confidence interval. A sweep has no bound on either.
+func (s matchStats) elo() (float64, float64) {
+	if s.games() == 0 {
+		return 0, math.Inf(1)
+	}
+
+	score := s.score()
+	if score == 0 || score == 1 {
+		return eloFromScore(score), math.Inf(1)
+	}
+	deviation := math.Sqrt(s.variance() / float64(s.games()))
+	low := eloFromScore(math.Max(score-1.96*deviation, 0))
+	high := eloFromScore(math.Min(score+1.96*deviation, 1))
+
+	return eloFromScore(score), (high - low) / 2
+}
+
+// llr is the log likelihood ratio of H1 against H0, using the normal
+// approximation of the score distribution.
+func (s matchStats) llr(elo0, elo1 float64) float64 {
+	variance := s.variance()
+	if s.games() == 0 || variance == 0 {
+		return 0
+	}
+
+	s0, s1 := scoreFromElo(elo0), scoreFromElo(elo1)
+
+	return float64(s.games()) * (s1 - s0) * (2*s.score() - s0 - s1) / (2 * variance)
+}
+
+func (o sprtOptions) bounds() (float64, float64) {
+	return math.Log(o.beta / (1 - o.alpha)), math.Log((1 - o.beta) / o.alpha)
+}
+
+func (s matchStats) sprt(o sprtOptions) sprtDecision {
+	llr := s.llr(o.elo0, o.elo1)
+	lower, upper := o.bounds()
+
+	switch {
+	case llr >= upper:
+		return sprtAcceptH1
+	case llr <= lower:
+		return sprtAcceptH0
+	}
+
+	return sprtContinue
+}
+
+func (s matchStats) summary(o *sprtOptions) string {
+	elo, margin := s.elo()
+	eloText := fmt.Sprintf("Elo %+.1f ± %.1f", elo, margin)
+	switch {
+	case math.IsInf(elo, 1):
+		eloText = "Elo +∞ (unbounded)"
+	case math.IsInf(elo, -1):
+		eloText = "Elo -∞ (unbounded)"
+	case math.IsInf(margin, 1):
+		eloText = fmt.Sprintf("Elo %+.1f ± ∞", elo)
+	}
+	text := fmt.Sprintf("Games %d: +%d =%d -%d  %s", s.games(), s.wins, s.draws, s.losses, eloText)
+
+	if o != nil {
+		lower, upper := o.bounds()
+		text += fmt.Sprintf("  LLR %.2f [%.2f, %.2f]", s.llr(o.elo0, o.elo1), lower, upper)
+	}
+
+	return text
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatchStatsElo(t *testing.T) {
+	stats := matchStats{wins: 60, draws: 20, losses: 20}
+
+	elo, margin := stats.elo()
+	if math.Abs(elo-147.19) > 0.01 {
+		t.Errorf("elo = %.2f; want 147.19", elo)
+	}
+	if margin <= 0 || margin > 100 {
+		t.Errorf("margin = %.2f; want a finite positive error bar", margin)
+	}
+
+	even := matchStats{wins: 10, draws: 10, losses: 10}
+	if elo, _ := even.elo(); elo != 0 {
+		t.Errorf("even match elo = %.2f; want 0", elo)
+	}
+
+	// sweeps have no finite estimate
+	tests := []struct {
+		stats matchStats
+		want  string
+	}{
+		{matchStats{wins: 10}, "Games 10: +10 =0 -0  Elo +∞ (unbounded)"},
+		{matchStats{losses: 4}, "Games 4: +0 =0 -4  Elo -∞ (unbounded)"},
+		{matchStats{wins: 1, losses: 3}, "Games 4: +1 =0 -3  Elo -190.8 ± ∞"},
+	}
+	for _, test := range tests {
+		if _, margin := test.stats.elo(); math.IsNaN(margin) {
+			t.Errorf("%+v: margin is NaN", test.stats)
+		}
+		if got := test.stats.summary(nil); got != test.want {
+			t.Errorf("summary(%+v) = %q; want %q", test.stats, got, test.want)
+		}
+	}
+}
+
+func TestMatchStatsSPRT(t *testing.T) {
+	o := sprtOptions{elo0: 0, elo1: 10, alpha: 0.05, beta: 0.05}
+
+	tests := []struct {
+		stats    matchStats
+		expected sprtDecision
+	}{
+		{matchStats{wins: 5, draws: 5, losses: 5}, sprtContinue},
+		{matchStats{wins: 400, draws: 200, losses: 250}, sprtAcceptH1},
+		{matchStats{wins: 250, draws: 200, losses: 400}, sprtAcceptH0},
+	}
+
+	for _, test := range tests {
+		if got := test.stats.sprt(o); got != test.expected {
+			t.Errorf("sprt(%+v) = %v (llr %.2f); want %v", test.stats, got, test.stats.llr(o.elo0, o.elo1), test.expected)
+		}
+	}
+}
+
+func TestParseMatchOptions(t *testing.T) {
+	small := smallVariant()
+	sizes, err := parseBoardSizes("6x6, 8x10", small.MinSize, small.MaxSize)
+	if err != nil || !reflect.DeepEqual(sizes, []Board{{Width: 6, Height: 6}, {Width: 8, Height: 10}}) {
+		t.Errorf("parseBoardSizes = %v, %v", sizes, err)
+	}
+	if sizes, err := parseBoardSizes("random", small.MinSize, small.MaxSize); sizes != nil || err != nil {
+		t.Errorf("parseBoardSizes(random) = %v, %v", sizes, err)
+	}
+	for _, bad := range []string{"6", "5x6", "6x27", "axb"} {
+		if _, err := parseBoardSizes(bad, small.MinSize, small.MaxSize); err == nil {
+			t.Errorf("parseBoardSizes(%q) should fail", bad)
+		}
+	}
+
+	if s, err := parseSPRT("0,5"); err != nil || s.alpha != 0.05 || s.elo1 != 5 {
+		t.Errorf("parseSPRT = %+v, %v", s, err)
+	}
+	for _, bad := range []string{"5", "5,0", "0,5,1,0.05"} {
+		if _, err := parseSPRT(bad); err == nil {
+			t.Errorf("parseSPRT(%q) should fail", bad)
+		}
+	}
+}
+
+func TestMatchOpeningIsReproducible(t *testing.T) {
+	opts := matchOptions{openingPlies: 4, seed: 7}
+
+	b1, o1 := matchOpening(defaultConfig(), opts, 3)
+	b2, o2 := matchOpening(defaultConfig(), opts, 3)
+	if b1 != b2 || !reflect.DeepEqual(o1, o2) {
+		t.Errorf("same seed and pair gave different openings")
+	}
+	if len(o1) != 4 || !validateBoardSize(b1.Width) || !validateBoardSize(b1.Height) {
+		t.Errorf("opening = %v on %v", o1, b1)
+	}
+}
+
+func TestRunMatch(t *testing.T) {
+	opts := matchOptions{
+		engines:      [2]string{"ai:1", "ai:2"},
+		games:        6,
+		concurrency:  3,
+		sizes:        []Board{{Width: 6, Height: 6}},
+		openingPlies: 2,
+		maxPlies:     30,
+		seed:         1,
+	}
+
+	reports := 0
+	stats, decision, err := runMatch(context.Background(), defaultConfig(), opts, func(matchStats) { reports++ })
+	if err != nil {
+		t.Fatalf("runMatch: %v", err)
+	}
+	if stats.games() != 6 || reports != 6 || decision != sprtContinue {
+		t.Errorf("stats = %+v, reports = %d, decision = %v", stats, reports, decision)
+	}
+
+	opts.engines[1] = "human"
+	if _, _, err := runMatch(context.Background(), defaultConfig(), opts, nil); err == nil || !strings.Contains(err.Error(), "human") {
+		t.Errorf("expected an error for a human player, got %v", err)
+	}
+}
+
+func TestMatchPlaysVariant(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Variant = "chess"
+
+	b, opening := matchOpening(cfg, matchOptions{openingPlies: 4, seed: 7}, 0)
+	if b.Width != 8 || b.Height != 8 || len(opening) != 4 {
+		t.Fatalf("opening = %v on %v", opening, b)
+	}
+
+	opts := matchOptions{engines: [2]string{"ai:1", "ai:1"}, games: 2, concurrency: 1, openingPlies: 2, maxPlies: 12, seed: 1}
+	if stats, _, err := runMatch(context.Background(), cfg, opts, nil); err != nil || stats.games() != 2 {
+		t.Errorf("runMatch = %+v, %v", stats, err)
+	}
+}
@@ -0,0 +1,749 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+/*
+ * Network games are played between a host, who plays White and keeps the
+ * authoritative game, and a guest, who plays Black. Messages are JSON
+ * objects, one per line, each carrying the protocol version. The guest
+ * sends move requests; the host validates them with movePiece and answers
+ * with the new state or an error.
+ */
+
+const netProtocolVersion = 1
+const netHandshakeTimeout = 5 * time.Second
+const netReconnectWindow = time.Minute
+const netReconnectDelay = time.Second
+
+// Message types. The last group never travels over the wire; it reports
+// connection changes to the UI.
+const (
+	netHello       = "hello"
+	netWelcome     = "welcome"
+	netState       = "state"
+	netMove        = "move"
+	netError       = "error"
+	netResign      = "resign"
+	netDrawOffer   = "draw_offer"
+	netDrawReply   = "draw_reply"
+	netUndoRequest = "undo_request"
+	netUndoReply   = "undo_reply"
+	netChat        = "chat"
+
+	netConnected    = "connected"
+	netDisconnected = "disconnected"
+	netLost         = "lost"
+)
+
+const offerDraw = "draw"
+const offerUndo = "undo"
+
+const hostingMsg = "\nHosting a network game on %s. You play White.\n"
+const waitingForHostMsg = "\n\nConnected. Waiting for the host to start the game...\n"
+const opponentConnectedMsg = "\n\nOpponent connected.\n"
+const opponentDisconnectedMsg = "\n\nOpponent disconnected. Waiting for them to reconnect...\n"
+const opponentLeftMsg = "\n\nYour opponent left the game.\n"
+const reconnectingMsg = "\n\nConnection lost. Reconnecting...\n"
+const reconnectedMsg = "\n\nReconnected.\n"
+const connectionLostMsg = "\n\nCould not reconnect. The game is over.\n"
+const opponentTurnMsg = "\n\nIt's your opponent's turn.\n"
+const opponentMovedMsg = "\n\nOpponent moved %s to %s.\n"
+const opponentDroppedMsg = "\n\nOpponent dropped %s on %s.\n"
+const opponentResignedMsg = "\n\nYour opponent resigned.\n"
+const opponentChatMsg = "\n\nOpponent: %s\n"
+const hostErrorMsg = "\n\nHost: %s\n"
+const drawOfferedMsg = "\n\nYour opponent offers a draw. Type 'accept' or 'decline'.\n"
+const undoRequestedMsg = "\n\nYour opponent asks to take back their move. Type 'accept' or 'decline'.\n"
+const offerSentMsg = "\n\nRequest sent. Waiting for your opponent to answer.\n"
+const offerAcceptedMsg = "\n\nYour opponent accepted.\n"
+const offerDeclinedMsg = "\n\nYour opponent declined.\n"
+const noOfferMsg = "\n\nThere is nothing to answer.\n"
+const requestPendingMsg = "\n\nAn offer or request is already waiting for an answer.\n"
+const noGameInProgressMsg = "\n\nThere is no game in progress.\n"
+const networkOnlyMsg = "\n\nThis command is only available in network games.\n"
+const networkRestartMsg = "\n\nNetwork games cannot be restarted.\n"
+const notConnectedMsg = "\n\nYour opponent is not connected.\n"
+const gameNotStartedMsg = "the game has not started"
+const gameFinishedMsg = "the game is over"
+
+var errNotConnected = errors.New("not connected")
+var errNetMachine = errors.New("network games are played by people at both ends, not by computer players")
+
+// checkNetPlayers refuses computer players in a network game: their moves
+// would be made locally and never reach the other end.
+func checkNetPlayers(players [2]movePicker) error {
+	if players[0] != nil || players[1] != nil {
+		return errNetMachine
+	}
+
+	return nil
+}
+
+type netMessage struct {
+	Version  int    `json:"v"`
+	Type     string `json:"type"`
+	Token    string `json:"token,omitempty"`
+	From     string `json:"from,omitempty"`
+	To       string `json:"to,omitempty"`
+	FEN      string `json:"fen,omitempty"`
+	Result   string `json:"result,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	Variant  string `json:"variant,omitempty"`
+	LastMove string `json:"last_move,omitempty"`
+	Hands    string `json:"hands,omitempty"`
+	Accept   bool   `json:"accept,omitempty"`
+	Text     string `json:"text,omitempty"`
+}
+
+// netSession is one side of a network game. Incoming messages and
+// connection changes are queued on events for the UI.
+type netSession struct {
+	host   bool
+	events chan netMessage
+	done   chan struct{}
+	hands  string // the guest's copy of the pieces in hand, which the host works out
+
+	mu       sync.Mutex
+	conn     net.Conn
+	token    string
+	listener net.Listener
+	addr     string
+	closed   bool
+}
+
+/*
+ * connections
+ */
+
+// hostGame listens on addr for a guest. Only the first guest is accepted;
+// after that, connections must present its token, which lets the guest
+// reconnect after a network failure.
+func hostGame(addr string) (*netSession, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &netSession{host: true, events: make(chan netMessage, 16), done: make(chan struct{}), listener: ln, addr: ln.Addr().String()}
+	go s.acceptLoop()
+
+	return s, nil
+}
+
+// joinGame connects to a host and completes the handshake.
+func joinGame(addr string) (*netSession, error) {
+	s := &netSession{events: make(chan netMessage, 16), done: make(chan struct{}), addr: addr}
+
+	conn, dec, err := s.dial("")
+	if err != nil {
+		return nil, err
+	}
+	go s.readLoop(conn, dec)
+
+	return s, nil
+}
+
+// newLocalHost returns the host side of a game whose guest plays in the
+// same process, such as another SSH session. See joinLocal.
+func newLocalHost() *netSession {
+	return &netSession{host: true, events: make(chan netMessage, 16), done: make(chan struct{})}
+}
+
+// joinLocal connects a guest to a local host through an in-memory pipe.
+// Local guests cannot reconnect: when the pipe breaks, the game is lost.
+func (s *netSession) joinLocal() *netSession {
+	hostConn, guestConn := net.Pipe()
+	guest := &netSession{events: make(chan netMessage, 16), done: make(chan struct{}), conn: guestConn}
+
+	s.mu.Lock()
+	s.conn = hostConn
+	s.mu.Unlock()
+
+	go guest.readLoop(guestConn, json.NewDecoder(guestConn))
+	go func() {
+		s.emit(netMessage{Type: netConnected})
+		s.readLoop(hostConn, json.NewDecoder(hostConn))
+	}()
+
+	return guest
+}
+
+func (s *netSession) acceptLoop() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.greet(conn)
+	}
+}
+
+// greet runs the host side of the handshake.
+func (s *netSession) greet(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(netHandshakeTimeout))
+	dec := json.NewDecoder(conn)
+
+	var hello netMessage
+	if err := dec.Decode(&hello); err != nil || hello.Type != netHello {
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	if hello.Version != netProtocolVersion {
+		writeNetMessage(conn, netMessage{Type: netError, Text: fmt.Sprintf("protocol version %d is not supported, use %d", hello.Version, netProtocolVersion)})
+		conn.Close()
+		return
+	}
+
+	s.mu.Lock()
+	if s.token != "" && hello.Token != s.token {
+		s.mu.Unlock()
+		writeNetMessage(conn, netMessage{Type: netError, Text: "a game is already in progress"})
+		conn.Close()
+		return
+	}
+	if s.token == "" {
+		s.token = newNetToken()
+	}
+	old := s.conn
+	s.conn = conn
+	err := writeNetMessage(conn, netMessage{Type: netWelcome, Token: s.token})
+	s.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	s.emit(netMessage{Type: netConnected})
+	s.readLoop(conn, dec)
+}
+
+// dial runs the guest side of the handshake.
+func (s *netSession) dial(token string) (net.Conn, *json.Decoder, error) {
+	conn, err := net.DialTimeout("tcp", s.addr, netHandshakeTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := writeNetMessage(conn, netMessage{Type: netHello, Token: token}); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(netHandshakeTimeout))
+	dec := json.NewDecoder(conn)
+
+	var welcome netMessage
+	if err := dec.Decode(&welcome); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	if welcome.Type != netWelcome {
+		conn.Close()
+		if welcome.Type == netError {
+			return nil, nil, errors.New(welcome.Text)
+		}
+		return nil, nil, fmt.Errorf("unexpected %q message from host", welcome.Type)
+	}
+
+	s.mu.Lock()
+	s.conn = conn
+	s.token = welcome.Token
+	s.mu.Unlock()
+
+	return conn, dec, nil
+}
+
+func (s *netSession) readLoop(conn net.Conn, dec *json.Decoder) {
+	for {
+		var msg netMessage
+		if err := dec.Decode(&msg); err != nil {
+			break
+		}
+		s.emit(msg)
+	}
+
+	s.mu.Lock()
+	current := s.conn == conn
+	if current {
+		s.conn = nil
+	}
+	closed := s.closed
+	s.mu.Unlock()
+	conn.Close()
+
+	if !current || closed {
+		return
+	}
+
+	s.emit(netMessage{Type: netDisconnected})
+	if !s.host && s.addr != "" {
+		s.reconnect()
+	} else if !s.host {
+		s.emit(netMessage{Type: netLost})
+	}
+}
+
+// reconnect keeps dialing the host with the session token until it
+// answers or netReconnectWindow has passed.
+func (s *netSession) reconnect() {
+	deadline := time.Now().Add(netReconnectWindow)
+
+	for time.Now().Before(deadline) {
+		select {
+		case <-s.done:
+			return
+		case <-time.After(netReconnectDelay):
+		}
+
+		s.mu.Lock()
+		token := s.token
+		s.mu.Unlock()
+
+		conn, dec, err := s.dial(token)
+		if err != nil {
+			continue
+		}
+
+		s.emit(netMessage{Type: netConnected})
+		go s.readLoop(conn, dec)
+		return
+	}
+
+	s.emit(netMessage{Type: netLost})
+}
+
+func (s *netSession) emit(msg netMessage) {
+	select {
+	case s.events <- msg:
+	case <-s.done:
+	}
+}
+
+func (s *netSession) send(msg netMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return errNotConnected
+	}
+
+	return writeNetMessage(s.conn, msg)
+}
+
+func (s *netSession) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	conn := s.conn
+	s.conn = nil
+	s.mu.Unlock()
+
+	close(s.done)
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+func writeNetMessage(w io.Writer, msg netMessage) error {
+	msg.Version = netProtocolVersion
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+func newNetToken() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+/*
+ * game flow
+ */
+
+// netMsg delivers a netSession event to Update.
+type netMsg netMessage
+
+func (m Model) waitForNet() tea.Cmd {
+	if m.net == nil {
+		return nil
+	}
+
+	s := m.net
+	return func() tea.Msg {
+		select {
+		case msg := <-s.events:
+			return netMsg(msg)
+		case <-s.done:
+			return nil
+		}
+	}
+}
+
+// isGuestWaiting reports whether this is a guest that has not received the
+// first position from the host yet.
+func (m Model) isGuestWaiting() bool {
+	return m.net != nil && !m.net.host && m.Table == nil
+}
+
+// sendGameState shares the host's game with the guest. In fog the guest
+// gets only what Black sees, and the host's moves are not named, until the
+// game is over.
+func sendGameState(m Model) {
+	if m.net == nil || !m.net.host || m.Table == nil {
+		return
+	}
+
+	state := netMessage{Type: netState, FEN: m.fen(), Result: m.result.String(), Reason: m.endReason, Variant: m.rules().Name}
+	_, fogged := m.viewer()
+	if fogged {
+		state.FEN = encodeFEN(fogTable(m.Table, m.Board, false), m.Board, m.isWhiteTurn)
+	}
+	if n := len(m.moves); n > 0 && (!fogged || !isWhitePiece(m.moves[n-1].piece)) {
+		state.LastMove = moveText(m.moves[n-1].mv, m.Board.Height)
+	}
+
+	state.Hands = handsIndicator(m)
+
+	m.net.send(state)
+}
+
+// handleNetMessage applies a message from the other side and returns the
+// text to show the player.
+func handleNetMessage(m Model, msg netMessage) (Model, string) {
+	switch msg.Type {
+	case netConnected:
+		if m.net.host {
+			sendGameState(m)
+			return m, opponentConnectedMsg
+		}
+		return m, reconnectedMsg
+
+	case netDisconnected:
+		if m.net.host && m.net.listener == nil {
+			return m, opponentLeftMsg
+		}
+		if m.net.host {
+			return m, opponentDisconnectedMsg
+		}
+		return m, reconnectingMsg
+
+	case netLost:
+		return m, connectionLostMsg
+
+	case netState:
+		return applyNetState(m, msg)
+
+	case netMove:
+		return hostGuestMove(m, msg)
+
+	case netError:
+		return m, fmt.Sprintf(hostErrorMsg, msg.Text)
+
+	case netResign:
+		if m.net.host && m.Table != nil && m.result == resultNone {
+			m = resignGame(m, false)
+			sendGameState(m)
+			return m, opponentResignedMsg
+		}
+
+	case netDrawOffer:
+		// a draw is offered on the offering side's turn, like in local games
+		if !m.canOffer() || m.isWhiteTurn == m.net.host {
+			return m, ""
+		}
+		m.offer, m.offerWhite = offerDraw, !m.net.host
+		return m, drawOfferedMsg
+
+	case netUndoRequest:
+		if !m.canOffer() {
+			return m, ""
+		}
+		m.offer, m.offerWhite = offerUndo, !m.net.host
+		return m, undoRequestedMsg
+
+	case netDrawReply, netUndoReply:
+		// only an answer to the offer this side made counts
+		kind := offerDraw
+		if msg.Type == netUndoReply {
+			kind = offerUndo
+		}
+		if m.offer != kind || m.offerWhite != m.net.host {
+			return m, ""
+		}
+		m.offer = ""
+
+		if !msg.Accept {
+			return m, offerDeclinedMsg
+		}
+		if m.net.host {
+			if msg.Type == netDrawReply {
+				m = agreeDraw(m)
+			} else {
+				m, _ = takeBack(m, true)
+			}
+			sendGameState(m)
+		}
+		return m, offerAcceptedMsg
+
+	case netChat:
+		return m, fmt.Sprintf(opponentChatMsg, msg.Text)
+	}
+
+	return m, ""
+}
+
+// canOffer reports whether a new offer or request can be made: the game is
+// in progress and nothing is waiting for an answer.
+func (m Model) canOffer() bool {
+	return m.Table != nil && m.result == resultNone && m.offer == ""
+}
+
+// lapseNetOffer withdraws the pending offer of a network game once a move
+// is played: a request to take back a move at once, and a draw offer when
+// its receiver moves instead of answering, as in lapseDrawOffer.
+func lapseNetOffer(m Model, moverWhite bool) Model {
+	if m.offer == offerUndo {
+		m.offer = ""
+		return m
+	}
+
+	return lapseDrawOffer(m, moverWhite)
+}
+
+// applyNetState replaces the guest's game with the host's.
+func applyNetState(m Model, msg netMessage) (Model, string) {
+	if m.net.host {
+		return m, ""
+	}
+
+	if msg.Variant != "" {
+		v, ok := knownVariant(msg.Variant)
+		if !ok {
+			return m, fmt.Sprintf(hostErrorMsg, fmt.Errorf("the host plays the variant %q, which is not loaded here", msg.Variant))
+		}
+		m.variant = v
+	}
+
+	t, b, white, err := decodeFEN(msg.FEN)
+	if err != nil {
+		return m, fmt.Sprintf(hostErrorMsg, err)
+	}
+
+	if m.Table == nil {
+		m.startTime = time.Now()
+		m.logFile = m.createNewLogFile()
+		writeToHistory(fmt.Sprintf("Joined network game with board size %dx%d\n", b.Width, b.Height), m.logFile)
+	}
+
+	if m.Table != nil && msg.FEN != m.fen() {
+		m = lapseNetOffer(m, !white)
+	}
+
+	b.Topology = m.rules().Topology
+	m.Table, m.Board, m.isWhiteTurn = t, b, white
+	m.net.hands = msg.Hands
+	m.result, m.endReason = parseGameResult(msg.Result), msg.Reason
+	m.phase = phasePlaying
+	if m.result != resultNone {
+		m.phase = phaseFinished
+	}
+
+	if msg.LastMove == "" {
+		return m, ""
+	}
+
+	writeToHistory(fmt.Sprintf("Moved %s\n", msg.LastMove), m.logFile)
+	if mv, ok := parseMoveText(msg.LastMove, b); ok && mv.isDrop() && white {
+		return m, fmt.Sprintf("\n\nYou dropped %c on %s.\n", mv.promotion, squareName(mv.toCol, mv.toRow, b.Height))
+	} else if ok && mv.isDrop() {
+		return m, fmt.Sprintf(opponentDroppedMsg, string(mv.promotion), squareName(mv.toCol, mv.toRow, b.Height))
+	} else if ok && white {
+		return m, fmt.Sprintf("\n\nYou moved %s to %s.\n", squareName(mv.fromCol, mv.fromRow, b.Height), squareName(mv.toCol, mv.toRow, b.Height))
+	} else if ok {
+		return m, fmt.Sprintf(opponentMovedMsg, squareName(mv.fromCol, mv.fromRow, b.Height), squareName(mv.toCol, mv.toRow, b.Height))
+	}
+
+	return m, ""
+}
+
+// hostGuestMove validates a move requested by the guest with the same
+// rules as local moves.
+func hostGuestMove(m Model, msg netMessage) (Model, string) {
+	reject := func(reason string) (Model, string) {
+		m.net.send(netMessage{Type: netError, Text: reason})
+		return m, ""
+	}
+
+	switch {
+	case !m.net.host:
+		return m, ""
+	case m.Table == nil:
+		return reject(gameNotStartedMsg)
+	case m.result != resultNone:
+		return reject(gameFinishedMsg)
+	case m.isWhiteTurn:
+		return reject(strings.TrimSpace(opponentTurnMsg))
+	}
+
+	moved, text := movePiece(msg.From, msg.To, m)
+	if text != "" {
+		return reject(strings.TrimSpace(text))
+	}
+	moved = lapseNetOffer(moved, false)
+
+	sendGameState(moved)
+	if _, fogged := moved.viewer(); fogged {
+		return moved, opponentMovedHiddenMsg
+	}
+
+	if letter, ok := strings.CutSuffix(msg.From, "@"); ok {
+		return moved, fmt.Sprintf(opponentDroppedMsg, strings.ToUpper(letter), msg.To)
+	}
+
+	return moved, fmt.Sprintf(opponentMovedMsg, msg.From, msg.To)
+}
+
+// runNetCommand handles the commands that involve the remote player.
+func runNetCommand(m Model, fields []string, input string) (Model, commandOutcome) {
+	if m.net == nil {
+		return m, commandOutcome{message: networkOnlyMsg, failed: true}
+	}
+
+	if fields[0] != "chat" && (m.Table == nil || m.result != resultNone) {
+		return m, commandOutcome{message: noGameInProgressMsg, failed: true}
+	}
+
+	var msg netMessage
+	switch fields[0] {
+	case "chat":
+		text := strings.TrimSpace(strings.TrimSpace(input)[len(fields[0]):])
+		if text == "" {
+			return m, commandOutcome{message: "\n\nUsage: chat <message>\n", failed: true}
+		}
+		msg = netMessage{Type: netChat, Text: text}
+
+	case "resign":
+		if m.net.host {
+			m = resignGame(m, true)
+			sendGameState(m)
+			return redrawGame(m), commandOutcome{}
+		}
+		msg = netMessage{Type: netResign}
+
+	case "offer", "draw":
+		if !m.canOffer() {
+			return m, commandOutcome{message: requestPendingMsg, failed: true}
+		}
+		if m.isWhiteTurn != m.net.host {
+			return m, commandOutcome{message: offerOnYourTurnMsg, failed: true}
+		}
+		msg = netMessage{Type: netDrawOffer}
+
+	case "undo":
+		if !m.canOffer() {
+			return m, commandOutcome{message: requestPendingMsg, failed: true}
+		}
+		msg = netMessage{Type: netUndoRequest}
+
+	case "accept", "decline":
+		// the host plays White
+		if m.offer == "" || m.offerWhite == m.net.host {
+			return m, commandOutcome{message: noOfferMsg, failed: true}
+		}
+		if m.offer == offerDraw && m.isWhiteTurn != m.net.host {
+			return m, commandOutcome{message: answerOnYourTurnMsg, failed: true}
+		}
+
+		accept := fields[0] == "accept"
+		msg = netMessage{Type: netDrawReply, Accept: accept}
+		if m.offer == offerUndo {
+			msg.Type = netUndoReply
+		}
+		m.offer = ""
+
+		if err := m.net.send(msg); err != nil {
+			return m, commandOutcome{message: notConnectedMsg, failed: true}
+		}
+		if accept && m.net.host {
+			if msg.Type == netDrawReply {
+				m = agreeDraw(m)
+			} else {
+				m, _ = takeBack(m, false)
+			}
+			sendGameState(m)
+			m = redrawGame(m)
+		}
+		return m, commandOutcome{}
+	}
+
+	if err := m.net.send(msg); err != nil {
+		return m, commandOutcome{message: notConnectedMsg, failed: true}
+	}
+	switch msg.Type {
+	case netDrawOffer:
+		m.offer, m.offerWhite = offerDraw, m.net.host
+		return m, commandOutcome{message: offerSentMsg}
+	case netUndoRequest:
+		m.offer, m.offerWhite = offerUndo, m.net.host
+		return m, commandOutcome{message: offerSentMsg}
+	}
+
+	return m, commandOutcome{}
+}
+
+// runNetMove plays a move typed by the local player of a network game. The
+// guest only sends the request; the host's answer updates the board.
+func runNetMove(m Model, from, to string) (Model, commandOutcome) {
+	if m.Table == nil || m.isWhiteTurn != m.net.host {
+		return m, commandOutcome{message: opponentTurnMsg, failed: true}
+	}
+
+	if !m.net.host {
+		if err := m.net.send(netMessage{Type: netMove, From: from, To: to}); err != nil {
+			return m, commandOutcome{message: notConnectedMsg, failed: true}
+		}
+		return m, commandOutcome{}
+	}
+
+	m, msg := movePiece(from, to, m)
+	if msg == "" {
+		m = lapseNetOffer(m, true)
+		sendGameState(m)
+	}
+
+	return m, commandOutcome{message: msg, failed: msg != ""}
+}
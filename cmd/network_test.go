@@ -0,0 +1,244 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// nextNetEvent waits for the next event of a session.
+func nextNetEvent(t *testing.T, s *netSession) netMessage {
+	t.Helper()
+
+	select {
+	case msg := <-s.events:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a network message")
+	}
+
+	return netMessage{}
+}
+
+// deliver hands the next event of m's session to handleNetMessage.
+func deliver(t *testing.T, m Model, want string) (Model, string) {
+	t.Helper()
+
+	msg := nextNetEvent(t, m.net)
+	if msg.Type != want {
+		t.Fatalf("got %q message %+v; want %q", msg.Type, msg, want)
+	}
+
+	return handleNetMessage(m, msg)
+}
+
+// startNetGame connects a guest to a host that has started a 6x6 game.
+func startNetGame(t *testing.T) (host, guest Model) {
+	t.Helper()
+
+	hs, err := hostGame("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(hs.Close)
+
+	gs, err := joinGame(hs.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(gs.Close)
+
+	host = newModel(headlessTestConfig(t))
+	host.net = hs
+	host.Board = Board{Width: 6, Height: 6}
+	host = startGame(host)
+
+	guest = newModel(headlessTestConfig(t))
+	guest.net = gs
+
+	host, _ = deliver(t, host, netConnected)
+	guest, _ = deliver(t, guest, netState)
+	if guest.Table == nil || guest.fen() != host.fen() {
+		t.Fatalf("guest position %q; want %q", guest.fen(), host.fen())
+	}
+
+	return host, guest
+}
+
+func TestNetworkGame(t *testing.T) {
+	host, guest := startNetGame(t)
+
+	if _, outcome := runCommand(guest, "move d6 b5"); outcome.message != opponentTurnMsg {
+		t.Errorf("guest moved on White's turn: %+v", outcome)
+	}
+
+	host, outcome := runCommand(host, "move b1 e4")
+	if outcome.failed {
+		t.Fatalf("host move failed: %q", outcome.message)
+	}
+	guest, text := deliver(t, guest, netState)
+	if guest.isWhiteTurn || !strings.Contains(text, "Opponent moved b1 to e4") {
+		t.Errorf("guest state after host move: white=%v, %q", guest.isWhiteTurn, text)
+	}
+
+	// the host checks guest moves with the regular rules
+	guest.net.send(netMessage{Type: netMove, From: "d6", To: "d2"})
+	host, _ = deliver(t, host, netMove)
+	if _, text := deliver(t, guest, netError); !strings.Contains(text, "Invalid move") {
+		t.Errorf("illegal move answer = %q", text)
+	}
+
+	if guest, outcome = runCommand(guest, "move d6 b5"); outcome.failed {
+		t.Fatalf("guest move failed: %q", outcome.message)
+	}
+	host, _ = deliver(t, host, netMove)
+	guest, _ = deliver(t, guest, netState)
+	if !host.isWhiteTurn || guest.fen() != host.fen() {
+		t.Errorf("positions diverged: host %q, guest %q", host.fen(), guest.fen())
+	}
+
+	guest, _ = runCommand(guest, "chat good luck")
+	if _, text := deliver(t, host, netChat); !strings.Contains(text, "good luck") {
+		t.Errorf("chat = %q", text)
+	}
+
+	// the guest takes back their move with the host's consent
+	guest, _ = runCommand(guest, "undo")
+	host, _ = deliver(t, host, netUndoRequest)
+	if host, outcome = runCommand(host, "accept"); outcome.failed {
+		t.Fatalf("accept failed: %q", outcome.message)
+	}
+	guest, _ = deliver(t, guest, netUndoReply)
+	guest, _ = deliver(t, guest, netState)
+	if len(host.moves) != 1 || guest.isWhiteTurn || guest.fen() != host.fen() {
+		t.Errorf("after undo: %d moves, host %q, guest %q", len(host.moves), host.fen(), guest.fen())
+	}
+
+	guest, _ = runCommand(guest, "resign")
+	host, _ = deliver(t, host, netResign)
+	guest, _ = deliver(t, guest, netState)
+	if host.result != resultWhiteWins || guest.result != resultWhiteWins {
+		t.Errorf("results after resign: host %v, guest %v", host.result, guest.result)
+	}
+}
+
+func TestNetworkMachinePlayers(t *testing.T) {
+	machine := searchPlayer{limits: searchLimits{depth: 1}, rules: smallVariant()}
+
+	if err := checkNetPlayers([2]movePicker{}); err != nil {
+		t.Errorf("two people: %v", err)
+	}
+	for _, players := range [][2]movePicker{{machine, nil}, {nil, machine}} {
+		if err := checkNetPlayers(players); err != errNetMachine {
+			t.Errorf("checkNetPlayers(%v) = %v; want %v", players, err, errNetMachine)
+		}
+	}
+
+	// a model that gets one anyway never asks it for a move
+	host, _ := startNetGame(t)
+	host.players = [2]movePicker{machine, nil}
+	if _, cmd := host.withMachineMove(nil); cmd != nil {
+		t.Errorf("the computer was asked to move in a network game")
+	}
+}
+
+func TestNetworkOffers(t *testing.T) {
+	host, guest := startNetGame(t)
+
+	// an answer to an offer never made changes nothing
+	guest.net.send(netMessage{Type: netDrawReply, Accept: true})
+	host, _ = deliver(t, host, netDrawReply)
+	if host.result != resultNone {
+		t.Fatalf("unsolicited answer ended the game: %v", host.result)
+	}
+
+	if _, outcome := runCommand(guest, "offer draw"); outcome.message != offerOnYourTurnMsg {
+		t.Errorf("guest offered on White's turn: %+v", outcome)
+	}
+
+	host, _ = runCommand(host, "offer draw")
+	guest, _ = deliver(t, guest, netDrawOffer)
+	if _, outcome := runCommand(host, "accept"); outcome.message != noOfferMsg {
+		t.Errorf("host accepted its own offer: %+v", outcome)
+	}
+	if _, outcome := runCommand(guest, "accept"); outcome.message != answerOnYourTurnMsg {
+		t.Errorf("guest accepted on White's turn: %+v", outcome)
+	}
+
+	// the guest moves instead of answering, which declines the offer
+	host, _ = runCommand(host, "move b1 e4")
+	guest, _ = deliver(t, guest, netState)
+	guest, _ = runCommand(guest, "move d6 b5")
+	host, _ = deliver(t, host, netMove)
+	guest, _ = deliver(t, guest, netState)
+	if host.offer != "" || guest.offer != "" {
+		t.Fatalf("offer still pending: host %q, guest %q", host.offer, guest.offer)
+	}
+	guest.net.send(netMessage{Type: netDrawReply, Accept: true})
+	host, _ = deliver(t, host, netDrawReply)
+	if host.result != resultNone {
+		t.Fatalf("late answer ended the game: %v", host.result)
+	}
+
+	host, _ = runCommand(host, "offer draw")
+	guest, _ = deliver(t, guest, netDrawOffer)
+	host, _ = runCommand(host, "move e4 b1")
+	guest, _ = deliver(t, guest, netState)
+	if guest, outcome := runCommand(guest, "accept"); outcome.failed {
+		t.Fatalf("accept failed: %q", outcome.message)
+	} else if guest.offer != "" {
+		t.Errorf("guest offer = %q", guest.offer)
+	}
+	host, _ = deliver(t, host, netDrawReply)
+	if host.result != resultDraw {
+		t.Errorf("result = %v; want a draw", host.result)
+	}
+}
+
+func TestNetworkReconnect(t *testing.T) {
+	host, guest := startNetGame(t)
+
+	// a third player cannot take the guest's seat
+	if _, err := joinGame(host.net.addr); err == nil || !strings.Contains(err.Error(), "in progress") {
+		t.Errorf("second guest: %v", err)
+	}
+
+	guest.net.mu.Lock()
+	guest.net.conn.Close()
+	guest.net.mu.Unlock()
+
+	host, _ = deliver(t, host, netDisconnected)
+	guest, _ = deliver(t, guest, netDisconnected)
+	if _, outcome := runCommand(host, "chat anyone?"); outcome.message != notConnectedMsg {
+		t.Errorf("chat while disconnected: %+v", outcome)
+	}
+
+	guest, _ = deliver(t, guest, netConnected)
+	host, _ = deliver(t, host, netConnected)
+	guest, _ = deliver(t, guest, netState)
+	if guest.fen() != host.fen() {
+		t.Errorf("guest position after reconnect %q; want %q", guest.fen(), host.fen())
+	}
+}
+
+func TestNetworkProtocolVersion(t *testing.T) {
+	hs, err := hostGame("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hs.Close()
+
+	conn, err := net.Dial("tcp", hs.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte(`{"v":0,"type":"hello"}` + "\n"))
+	buf := make([]byte, 256)
+	n, _ := conn.Read(buf)
+	if !strings.Contains(string(buf[:n]), "not supported") {
+		t.Errorf("answer to an old client = %q", buf[:n])
+	}
+}
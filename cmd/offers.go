@@ -0,0 +1,126 @@
+package main
+
+import "fmt"
+
+/*
+ * Resigning and draw offers in games played on this machine. A draw is
+ * offered on the offering side's turn and answered on the opponent's: with
+ * accept or decline, or by simply moving, which declines it. Computer
+ * players answer at once. Network games relay the same commands to the
+ * other side instead, with the same checks (see runNetCommand).
+ */
+
+const drawOfferMadeMsg = "\n\n%s offers a draw. %s can accept or decline it on their turn.\n"
+const offerPendingMsg = "\n\nA draw offer is already waiting for an answer.\n"
+const offerOnYourTurnMsg = "\n\nYou can only offer a draw on your turn.\n"
+const answerOnYourTurnMsg = "\n\nThe offer is answered by your opponent on their turn.\n"
+const computerAcceptsMsg = "\n\nThe computer accepts the draw.\n"
+const computerDeclinesMsg = "\n\nThe computer declines the draw.\n"
+const drawDeclinedMsg = "\n\n%s declines the draw.\n"
+const drawOfferHistoryMsg = "%s offers a draw\n"
+const drawDeclinedHistoryMsg = "%s declines the draw\n"
+
+// drawResponder is implemented by movePickers that can answer draw offers.
+// Players without it always decline.
+type drawResponder interface {
+	acceptDraw(t table, b Board, white bool) bool
+}
+
+// acceptDraw takes the draw when the built-in evaluation does not favour
+// the computer's side.
+func (p searchPlayer) acceptDraw(t table, b Board, white bool) bool {
+	return evaluate(t, b, white) <= 0
+}
+
+func sideName(white bool) string {
+	if white {
+		return "White"
+	}
+
+	return "Black"
+}
+
+// localSide returns the side typing at the keyboard: the only human side
+// when playing the computer, otherwise the side to move.
+func (m Model) localSide() bool {
+	switch {
+	case m.players[0] == nil && m.players[1] != nil:
+		return true
+	case m.players[0] != nil && m.players[1] == nil:
+		return false
+	}
+
+	return m.isWhiteTurn
+}
+
+// runOfferCommand handles resign, offer draw, accept and decline in games
+// that are not played over the network.
+func runOfferCommand(m Model, fields []string) (Model, commandOutcome) {
+	if m.Table == nil || m.result != resultNone {
+		return m, commandOutcome{message: noGameInProgressMsg, failed: true}
+	}
+
+	// the commands that end the game redraw it, so clear what was typed first
+	m.prompt.SetValue("")
+
+	side := m.localSide()
+	opponent := m.players[0]
+	if side {
+		opponent = m.players[1]
+	}
+
+	switch fields[0] {
+	case "resign":
+		m.offer = ""
+		return redrawGame(resignGame(m, side)), commandOutcome{}
+
+	case "offer", "draw":
+		if m.offer != "" {
+			return m, commandOutcome{message: offerPendingMsg, failed: true}
+		}
+		if side != m.isWhiteTurn {
+			return m, commandOutcome{message: offerOnYourTurnMsg, failed: true}
+		}
+		writeToHistory(fmt.Sprintf(drawOfferHistoryMsg, sideName(side)), m.logFile)
+
+		if opponent != nil {
+			if r, ok := opponent.(drawResponder); ok && r.acceptDraw(m.Table.clone(), m.Board, !side) {
+				m = redrawGame(agreeDraw(m))
+				return m, commandOutcome{message: computerAcceptsMsg}
+			}
+			writeToHistory(fmt.Sprintf(drawDeclinedHistoryMsg, sideName(!side)), m.logFile)
+			return m, commandOutcome{message: computerDeclinesMsg}
+		}
+
+		m.offer, m.offerWhite = offerDraw, side
+		return m, commandOutcome{message: fmt.Sprintf(drawOfferMadeMsg, sideName(side), sideName(!side))}
+
+	case "accept", "decline":
+		if m.offer == "" {
+			return m, commandOutcome{message: noOfferMsg, failed: true}
+		}
+		if m.offerWhite == m.isWhiteTurn {
+			return m, commandOutcome{message: answerOnYourTurnMsg, failed: true}
+		}
+
+		m.offer = ""
+		if fields[0] == "accept" {
+			return redrawGame(agreeDraw(m)), commandOutcome{}
+		}
+		writeToHistory(fmt.Sprintf(drawDeclinedHistoryMsg, sideName(m.isWhiteTurn)), m.logFile)
+		return m, commandOutcome{message: fmt.Sprintf(drawDeclinedMsg, sideName(m.isWhiteTurn))}
+	}
+
+	return m, commandOutcome{message: invalidCommandMsg, failed: true}
+}
+
+// lapseDrawOffer withdraws a pending draw offer once its receiver moves
+// instead of answering it.
+func lapseDrawOffer(m Model, moverWhite bool) Model {
+	if m.offer == offerDraw && moverWhite != m.offerWhite {
+		m.offer = ""
+		writeToHistory(fmt.Sprintf(drawDeclinedHistoryMsg, sideName(moverWhite)), m.logFile)
+	}
+
+	return m
+}
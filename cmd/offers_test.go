@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHotSeatDrawOffer(t *testing.T) {
+	cfg := headlessTestConfig(t)
+	script := strings.Join([]string{
+		"offer draw",
+		"accept", // rejected: White cannot answer its own offer
+		"move b1 e4",
+		"offer draw", // rejected: an offer is pending
+		"accept",
+	}, "\n")
+
+	var out strings.Builder
+	code, err := runHeadless(cfg, [2]movePicker{}, strings.NewReader(script), &out, "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != exitDraw {
+		t.Fatalf("exit code = %d; want %d\n%s", code, exitDraw, out.String())
+	}
+	for _, want := range []string{strings.TrimSpace(answerOnYourTurnMsg), strings.TrimSpace(offerPendingMsg), drawAgreedBannerMsg} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output is missing %q:\n%s", want, out.String())
+		}
+	}
+
+	records, _ := loadGameRecords(gameDBPath(cfg))
+	if len(records) != 1 || records[0].Result != "draw" || records[0].Reason != drawAgreedBannerMsg {
+		t.Fatalf("recorded games = %+v", records)
+	}
+	history, _ := os.ReadFile(records[0].History)
+	if !strings.Contains(string(history), "White offers a draw\nMoved") || !strings.Contains(string(history), drawAgreedMsg) {
+		t.Errorf("history:\n%s", history)
+	}
+}
+
+func TestDrawOfferLapses(t *testing.T) {
+	m := startGame(newTestGame(t))
+
+	steps := []struct {
+		command string
+		failed  bool
+	}{
+		{"accept", true}, // nothing offered
+		{"offer draw", false},
+		{"move b1 e4", false},
+		{"move d6 b5", false}, // Black moves instead of answering
+		{"accept", true},
+		{"offer draw", false},
+		{"move e4 e3", false},
+		{"decline", false},
+		{"move b5 a3", false},
+	}
+
+	for _, step := range steps {
+		var outcome commandOutcome
+		if m, outcome = runCommand(m, step.command); outcome.failed != step.failed {
+			t.Fatalf("%q: failed = %v (%q); want %v", step.command, outcome.failed, outcome.message, step.failed)
+		}
+	}
+	if m.result != resultNone || m.offer != "" {
+		t.Errorf("result %v, offer %q; want the game to go on", m.result, m.offer)
+	}
+}
+
+func TestResign(t *testing.T) {
+	hotSeat := startGame(newTestGame(t))
+	hotSeat, _ = runCommand(hotSeat, "move b1 e4")
+	if hotSeat, _ = runCommand(hotSeat, "resign"); hotSeat.result != resultWhiteWins {
+		t.Errorf("Black resigning on its turn: result %v", hotSeat.result)
+	}
+	if !strings.Contains(hotSeat.Body.String(), "Black resigns. White wins!") {
+		t.Errorf("no banner:\n%s", hotSeat.Body.String())
+	}
+	if _, outcome := runCommand(hotSeat, "resign"); outcome.message != gameIsOverMsg {
+		t.Errorf("resigning a finished game: %q", outcome.message)
+	}
+
+	// against the computer the human resigns even on the computer's turn
+	computer := newTestGame(t)
+	computer.players[0] = searchPlayer{limits: searchLimits{depth: 1}}
+	computer = startGame(computer)
+	if computer, _ = runCommand(computer, "resign"); computer.result != resultWhiteWins {
+		t.Errorf("human Black resigning: result %v", computer.result)
+	}
+}
+
+func TestComputerAnswersDrawOffer(t *testing.T) {
+	tests := []struct {
+		name     string
+		t        table
+		expected string
+	}{
+		{"computer ahead", table{{0, 5}: WhiteKing, {2, 5}: WhiteHorse, {5, 0}: BlackKing, {4, 0}: BlackTower}, computerDeclinesMsg},
+		{"computer behind", table{{0, 5}: WhiteKing, {1, 5}: WhiteTower, {5, 0}: BlackKing, {3, 0}: BlackHorse}, computerAcceptsMsg},
+	}
+
+	for _, test := range tests {
+		m := newTestGame(t)
+		m.players[1] = searchPlayer{limits: searchLimits{depth: 1}}
+		m = startGame(m)
+		m.Table = test.t
+
+		m, outcome := runCommand(m, "offer draw")
+		if outcome.message != test.expected {
+			t.Errorf("%s: answer %q; want %q", test.name, outcome.message, test.expected)
+		}
+		if accepted := m.result == resultDraw; accepted != (test.expected == computerAcceptsMsg) {
+			t.Errorf("%s: result %v", test.name, m.result)
+		}
+	}
+}
+
+// newTestGame returns a model on a 6x6 board with White to move, not yet
+// started.
+func newTestGame(t *testing.T) Model {
+	m := newModel(headlessTestConfig(t))
+	m.Board = Board{Width: 6, Height: 6}
+	m.isWhiteTurn = true
+
+	return m
+}
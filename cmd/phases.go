@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+/*
+ * A game goes through explicit phases. Setup asks for the board size and
+ * the players, playing accepts moves, and once a result is reached the
+ * game is finished: moves are refused and the players choose between a new
+ * game, a rematch, reviewing the moves or saving the game. Reviewing steps
+ * through the finished game without changing it, and editing sets up a
+ * custom starting position (see editor.go).
+ */
+
+type gamePhase int
+
+const (
+	phaseSetup gamePhase = iota
+	phasePlaying
+	phaseFinished
+	phaseReviewing
+	phaseEditing
+)
+
+const gameIsOverMsg = "\n\nThe game is over. Type new, rematch, review or save.\n"
+const nothingToReviewMsg = "\n\nThere are no moves to review.\n"
+const reviewingMsg = "\n\nReviewing move %d of %d%s\n"
+const reviewEndMsg = "\n\nThat is the end of the game.\n"
+const reviewStartMsg = "\n\nThat is the start of the game.\n"
+const saveUsageMsg = "\n\nUsage: save <file>\n"
+const gameSavedMsg = "\n\nGame saved to %s\n"
+const saveErrorMsg = "\n\nCould not save the game: %v\n"
+
+const gameOverHelpMsg = `
+
+The game is over:
+  new                    Start a new game, choosing the board again
+  rematch                Play again on this board with colours swapped
+  review                 Step through the moves of the game
+  save [file]            Save the game as PGN
+  edit                   Set up a custom starting position
+  exit                   Exit the game`
+
+const reviewHelpMsg = `
+
+Reviewing the game:
+  next / prev            Step one move forward or back (n / p)
+  first / last           Jump to the start or the end
+  done                   Stop reviewing`
+
+// finishGame ends the game with result, locking it against further moves.
+func finishGame(m Model, result gameResult) Model {
+	m.result = result
+	m.phase = phaseFinished
+	m.offer = ""
+
+	return m
+}
+
+// runGameOverCommand handles the commands of the finished and reviewing
+// phases. It reports false for commands that work the same in every phase,
+// which runCommand then runs as usual.
+func runGameOverCommand(m Model, fields []string, input string) (Model, commandOutcome, bool) {
+	switch fields[0] {
+	case "exit", "chat", "restart":
+		return m, commandOutcome{}, false
+	}
+
+	if m.phase == phaseReviewing {
+		m, outcome := runReviewCommand(m, fields[0])
+		return m, outcome, true
+	}
+
+	switch fields[0] {
+	case "help", "h":
+		return m, commandOutcome{message: gameOverHelpMsg}, true
+
+	case "new":
+		if m.net != nil {
+			return m, commandOutcome{message: networkRestartMsg, failed: true}, true
+		}
+		return renderBody(newGame(m)), commandOutcome{}, true
+
+	case "edit":
+		if m.net != nil {
+			return m, commandOutcome{message: networkRestartMsg, failed: true}, true
+		}
+		return enterEditor(m), commandOutcome{}, true
+
+	case "rematch":
+		if m.net != nil {
+			return m, commandOutcome{message: networkRestartMsg, failed: true}, true
+		}
+		return redrawGame(rematch(m)), commandOutcome{}, true
+
+	case "review":
+		if len(m.moves) == 0 {
+			return m, commandOutcome{message: nothingToReviewMsg, failed: true}, true
+		}
+		m.phase = phaseReviewing
+		m.reviewPly = len(m.moves)
+		m.prompt.SetValue("")
+		return redrawGame(m), commandOutcome{}, true
+
+	case "save":
+		if len(fields) > 2 {
+			return m, commandOutcome{message: saveUsageMsg, failed: true}, true
+		}
+		path := strings.TrimSuffix(m.logFile, ".txt") + ".pgn"
+		if len(fields) == 2 {
+			path = strings.Fields(input)[1]
+		} else if m.logFile == "" {
+			return m, commandOutcome{message: saveUsageMsg, failed: true}, true
+		}
+		if err := saveGame(m, path); err != nil {
+			return m, commandOutcome{message: fmt.Sprintf(saveErrorMsg, err), failed: true}, true
+		}
+		return m, commandOutcome{message: fmt.Sprintf(gameSavedMsg, path)}, true
+	}
+
+	return m, commandOutcome{message: gameIsOverMsg, failed: true}, true
+}
+
+func runReviewCommand(m Model, command string) (Model, commandOutcome) {
+	switch command {
+	case "next", "n":
+		if m.reviewPly == len(m.moves) {
+			return m, commandOutcome{message: reviewEndMsg, failed: true}
+		}
+		m.reviewPly++
+	case "prev", "p":
+		if m.reviewPly == 0 {
+			return m, commandOutcome{message: reviewStartMsg, failed: true}
+		}
+		m.reviewPly--
+	case "first":
+		m.reviewPly = 0
+	case "last":
+		m.reviewPly = len(m.moves)
+	case "done":
+		m.phase = phaseFinished
+	case "help", "h":
+		return m, commandOutcome{message: reviewHelpMsg}
+	default:
+		return m, commandOutcome{message: reviewHelpMsg, failed: true}
+	}
+
+	m.prompt.SetValue("")
+	return redrawGame(m), commandOutcome{}
+}
+
+// reviewTable returns the position after the first m.reviewPly moves,
+// taking the later ones back on a copy of the final position.
+func reviewTable(m Model) table {
+	t := m.Table.clone()
+	for i := len(m.moves) - 1; i >= m.reviewPly; i-- {
+		t.unplay(m.moves[i])
+	}
+
+	return t
+}
+
+// reviewCaption describes the move that led to the reviewed position.
+func reviewCaption(m Model) string {
+	if m.reviewPly == 0 {
+		return fmt.Sprintf(reviewingMsg, 0, len(m.moves), ": starting position")
+	}
+
+	mv := m.moves[m.reviewPly-1].mv
+	return fmt.Sprintf(reviewingMsg, m.reviewPly, len(m.moves), ": "+moveText(mv, m.Board.Height))
+}
+
+// newGame goes back to setup, asking for the board size and players again.
+func newGame(m Model) Model {
+	m.Board = Board{}
+	m.Table = nil
+	m.startFEN, m.startNote = "", ""
+	m.phase = phaseSetup
+	m.result = resultNone
+	m.endReason = ""
+	m.moves = nil
+	m.logFile = ""
+	for i, p := range m.players {
+		if p == nil {
+			m.names[i] = ""
+		}
+	}
+	m.prompt.SetValue("")
+
+	return m
+}
+
+// rematch starts another game on the same board with the players' colours
+// swapped.
+func rematch(m Model) Model {
+	m.players[0], m.players[1] = m.players[1], m.players[0]
+	m.names[0], m.names[1] = m.names[1], m.names[0]
+	m.prompt.SetValue("")
+
+	return startGame(m)
+}
+
+// saveGame writes the game to path as PGN.
+func saveGame(m Model, path string) error {
+	rec := m.gameRecord()
+	if fourPlayerRecord(rec) {
+		return errFourPlayersPGN
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return writePGN(f, rec)
+}
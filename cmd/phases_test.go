@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestGamePhases(t *testing.T) {
+	var m tea.Model = newModel(headlessTestConfig(t))
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 80, Height: 40})
+
+	// setup: default board size and start, alice plays White
+	for _, line := range []string{"", "", "", "alice", ""} {
+		m = typeLine(m, line)
+	}
+	if got := m.(Model); got.phase != phasePlaying || got.Board != (Board{Width: 6, Height: 6, Topology: topologyFlat}) {
+		t.Fatalf("after setup: phase %v, board %v", got.phase, got.Board)
+	}
+
+	for _, line := range []string{"move b1 e4", "move d6 b5", "move e4 e6", "move b5 a3", "move e6 f6"} {
+		m = typeLine(m, line)
+	}
+	got := m.(Model)
+	if got.phase != phaseFinished || got.result != resultWhiteWins || got.isWhiteTurn {
+		t.Fatalf("after the King capture: phase %v, result %v, white to move %v", got.phase, got.result, got.isWhiteTurn)
+	}
+	if !strings.Contains(m.View(), gameOverOptionsMsg) {
+		t.Errorf("no options after the result:\n%s", m.View())
+	}
+
+	// the finished game is locked
+	m = typeLine(m, "move a3 b1")
+	if got := m.(Model); len(got.moves) != 5 || !strings.Contains(m.View(), strings.TrimSpace(gameIsOverMsg)) {
+		t.Errorf("move after the game: %d moves\n%s", len(got.moves), m.View())
+	}
+
+	steps := []struct {
+		line string
+		want string
+	}{
+		{"review", "Reviewing move 5 of 5: e6f6"},
+		{"first", drawTableWithMap(6, 6, createInitialTableMap(6, 6))},
+		{"next", "Reviewing move 1 of 5: b1e4"},
+		{"prev", "Reviewing move 0 of 5: starting position"},
+		{"prev", strings.TrimSpace(reviewStartMsg)},
+		{"move b1 e4", "next / prev"},
+		{"done", gameOverOptionsMsg},
+	}
+	for _, step := range steps {
+		if m = typeLine(m, step.line); !strings.Contains(m.View(), step.want) {
+			t.Errorf("%q: view is missing %q:\n%s", step.line, step.want, m.View())
+		}
+	}
+	if got := m.(Model); got.phase != phaseFinished || len(got.moves) != 5 {
+		t.Errorf("after reviewing: phase %v, %d moves", got.phase, len(got.moves))
+	}
+
+	path := filepath.Join(t.TempDir(), "Game.pgn")
+	m = typeLine(m, "save "+path)
+	if data, err := os.ReadFile(path); err != nil || !strings.Contains(string(data), "3. e6f6 1-0") {
+		t.Errorf("saved game: %v\n%s", err, data)
+	}
+
+	m = typeLine(m, "rematch")
+	got = m.(Model)
+	if got.phase != phasePlaying || len(got.moves) != 0 || !got.isWhiteTurn || got.names != [2]string{"", "alice"} {
+		t.Errorf("rematch: phase %v, %d moves, names %q", got.phase, len(got.moves), got.names)
+	}
+
+	m = typeLine(m, "resign")
+	m = typeLine(m, "new")
+	if got := m.(Model); got.phase != phaseSetup || got.Table != nil || !strings.Contains(m.View(), promptWidthMsg) {
+		t.Errorf("new game: phase %v\n%s", got.phase, m.View())
+	}
+}
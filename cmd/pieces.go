@@ -0,0 +1,454 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+/*
+ * Pieces are declared in pieceDefs with their movement written in Betza
+ * notation, and registerPiece turns each into the move rules used by move
+ * validation, move generation and the search. A new fairy piece only needs
+ * a line in the table.
+ *
+ * The notation is a list of atoms, each a leap in every direction:
+ *   W (1,0) F (1,1) D (2,0) N (2,1) A (2,2) H (3,0) C (3,1) Z (3,2) G (3,3)
+ * and the compounds K = WF, R = WW, B = FF and Q = WWFF. A doubled atom
+ * rides any distance in its direction and a count after an atom limits the
+ * ride, so R3 moves up to three squares like a rook. Riders stop at the
+ * first piece in their way; leaps jump over pieces, and over holes unless
+ * they leap along a file, rank or diagonal.
+ *
+ * Lower case letters before an atom restrict it: f, b, l and r keep the
+ * directions going forwards, backwards, left or right (any of them given),
+ * m only moves without capturing and c only captures. Forwards is up the
+ * board for White and down for Black. i allows the move only from the
+ * side's second rank, where pawns start, and n makes a long leap lame, so
+ * the squares it passes over must be empty.
+ */
+
+// pieceDef declares a piece of the game.
+type pieceDef struct {
+	name   string
+	letter rune // White's letter; Black's is the lower case one
+	white  rune
+	black  rune
+	betza  string
+	value  int     // material value used by the search, 0 for the King
+	drawn  [2]rune // White's and Black's glyphs when they differ from the runes
+
+	red, blue rune // the runes of four-player games' other armies, set as the piece is registered
+}
+
+var pieceDefs = []pieceDef{
+	{name: "King", letter: 'K', white: WhiteKing, black: BlackKing, betza: "K"},
+	{name: "Tower", letter: 'T', white: WhiteTower, black: BlackTower, betza: "WDHFAG", value: 500},
+	{name: "Horse", letter: 'H', white: WhiteHorse, black: BlackHorse, betza: "N", value: 300},
+	{name: "Pawn", letter: 'P', white: WhitePawn, black: BlackPawn, betza: "fmWfcFifmnD", value: 100},
+	{name: "Bishop", letter: 'B', white: WhiteBishop, black: BlackBishop, betza: "B", value: 330},
+	{name: "Rook", letter: 'R', white: WhiteRook, black: BlackRook, betza: "R", value: 500, drawn: [2]rune{'\u2656', '\u265C'}},
+	{name: "Queen", letter: 'Q', white: WhiteQueen, black: BlackQueen, betza: "Q", value: 900},
+}
+
+// The chess pieces. Rooks are stored apart from Towers, which already use
+// the rook glyphs, and are drawn with them.
+const (
+	WhitePawn   = '\u2659' // ♙
+	WhiteBishop = '\u2657' // ♗
+	WhiteQueen  = '\u2655' // ♕
+	WhiteRook   = '\uE000' // drawn as ♖
+	BlackPawn   = '\u265F' // ♟
+	BlackBishop = '\u265D' // ♝
+	BlackQueen  = '\u265B' // ♛
+	BlackRook   = '\uE001' // drawn as ♜
+)
+
+// moveRule is one direction a piece moves in, in table coordinates.
+type moveRule struct {
+	dx, dy      int
+	steps       int // the longest ride, 1 for a leap and 0 for no limit
+	moveOnly    bool
+	captureOnly bool
+	initial     bool // only from the side's second rank
+	lame        bool // blocked by the squares a long leap passes over
+}
+
+// pieceInfo is a registered piece as seen by one side.
+type pieceInfo struct {
+	def   *pieceDef
+	white bool
+	color pieceColor
+	rules []moveRule
+	// irreversible pieces only move forwards, so positions before their
+	// moves cannot come back
+	irreversible bool
+}
+
+// owns reports whether target belongs to the same army as the piece.
+func (info *pieceInfo) owns(target rune) bool {
+	other, ok := pieces[target]
+	return ok && other.color == info.color
+}
+
+// pieces holds the registered pieces by the rune stored in the table.
+var pieces = registerPieces(pieceDefs)
+
+func registerPieces(defs []pieceDef) map[rune]*pieceInfo {
+	registry := make(map[rune]*pieceInfo)
+	for i := range defs {
+		if err := registerPiece(registry, &defs[i]); err != nil {
+			panic(err)
+		}
+	}
+
+	return registry
+}
+
+// registerPiece parses def's movement and adds it to registry, along with
+// its letters and value.
+func registerPiece(registry map[rune]*pieceInfo, def *pieceDef) error {
+	if _, ok := registry[def.white]; ok {
+		return fmt.Errorf("%s: piece %c is already defined", def.name, def.white)
+	}
+	if _, ok := registry[def.black]; ok {
+		return fmt.Errorf("%s: piece %c is already defined", def.name, def.black)
+	}
+	if _, ok := pieceByLetter(string(def.letter)); ok {
+		return fmt.Errorf("%s: the letter %c is already used", def.name, def.letter)
+	}
+
+	rules, err := parseBetza(def.betza)
+	if err != nil {
+		return fmt.Errorf("%s: %w", def.name, err)
+	}
+
+	irreversible := true
+	for _, r := range rules {
+		irreversible = irreversible && r.dy > 0
+	}
+
+	for _, white := range []bool{true, false} {
+		info := &pieceInfo{def: def, white: white, color: colorBlack, irreversible: irreversible}
+		if white {
+			info.color = colorWhite
+		}
+		for _, r := range rules {
+			// forwards is towards row 0 for White, and Black sees the board
+			// turned around
+			if white {
+				r.dy = -r.dy
+			} else {
+				r.dx = -r.dx
+			}
+			info.rules = append(info.rules, r)
+		}
+		// keep moves in the order of the board scan, top left first
+		sort.SliceStable(info.rules, func(i, j int) bool {
+			a, b := info.rules[i], info.rules[j]
+			return a.dy < b.dy || (a.dy == b.dy && a.dx < b.dx)
+		})
+
+		piece, letter, drawn := def.white, def.letter, def.drawn[0]
+		if !white {
+			piece, letter, drawn = def.black, unicode.ToLower(def.letter), def.drawn[1]
+		}
+		registry[piece] = info
+		glyphSets["letters"][piece] = letter
+		if drawn != 0 {
+			glyphSets["unicode"][piece] = drawn
+		}
+		if def.value != 0 {
+			pieceValues[piece] = def.value
+		}
+	}
+	registerArmies(registry, def)
+
+	return nil
+}
+
+// unregisterPiece takes def, registered with registerPiece, out of registry
+// again, along with its letters, glyphs and value.
+func unregisterPiece(registry map[rune]*pieceInfo, def *pieceDef) {
+	for _, piece := range []rune{def.white, def.black, def.red, def.blue} {
+		delete(registry, piece)
+		delete(armies, piece)
+		delete(pieceValues, piece)
+		for _, set := range glyphSets {
+			delete(set, piece)
+		}
+	}
+}
+
+/*
+ * Betza notation
+ */
+
+var betzaAtoms = map[rune][2]int{
+	'W': {1, 0}, 'F': {1, 1}, 'D': {2, 0}, 'N': {2, 1}, 'A': {2, 2},
+	'H': {3, 0}, 'C': {3, 1}, 'Z': {3, 2}, 'G': {3, 3},
+}
+
+// betzaCompounds expand to their atoms and how far those ride.
+var betzaCompounds = map[rune]struct {
+	atoms string
+	ride  int
+}{
+	'K': {"WF", 1},
+	'R': {"W", 0},
+	'B': {"F", 0},
+	'Q': {"WF", 0},
+}
+
+// parseBetza reads a movement in Betza notation into rules with forwards as
+// positive dy.
+func parseBetza(text string) ([]moveRule, error) {
+	var rules []moveRule
+	src := []rune(text)
+	if len(src) == 0 {
+		return nil, fmt.Errorf("empty movement")
+	}
+
+	for i := 0; i < len(src); {
+		mods := ""
+		for i < len(src) && strings.ContainsRune("fblrmcin", src[i]) {
+			mods += string(src[i])
+			i++
+		}
+		if i == len(src) {
+			return nil, fmt.Errorf("movement %q ends with modifiers", text)
+		}
+
+		letter := src[i]
+		i++
+		atoms := string(letter)
+		ride := 1
+		if compound, ok := betzaCompounds[letter]; ok {
+			atoms, ride = compound.atoms, compound.ride
+		} else if _, ok := betzaAtoms[letter]; !ok {
+			return nil, fmt.Errorf("unknown atom %q in %q", letter, text)
+		}
+
+		switch {
+		case i < len(src) && src[i] == letter:
+			ride = 0
+			i++
+		case i < len(src) && unicode.IsDigit(src[i]):
+			n := 0
+			for i < len(src) && unicode.IsDigit(src[i]) {
+				n = n*10 + int(src[i]-'0')
+				i++
+			}
+			if n == 0 {
+				return nil, fmt.Errorf("range in %q must be at least 1", text)
+			}
+			ride = n
+		}
+
+		for _, atom := range atoms {
+			rules = append(rules, atomRules(betzaAtoms[atom], ride, mods)...)
+		}
+	}
+
+	return rules, nil
+}
+
+// atomRules lists the directions of a leap allowed by the modifiers.
+func atomRules(leap [2]int, steps int, mods string) []moveRule {
+	var rules []moveRule
+	seen := make(map[[2]int]bool)
+	dirs := strings.Map(func(r rune) rune {
+		if strings.ContainsRune("fblr", r) {
+			return r
+		}
+		return -1
+	}, mods)
+
+	for _, d := range [][2]int{{leap[0], leap[1]}, {leap[1], leap[0]}} {
+		for _, sx := range []int{1, -1} {
+			for _, sy := range []int{1, -1} {
+				dx, dy := d[0]*sx, d[1]*sy
+				if seen[[2]int{dx, dy}] || !allowedDirection(dx, dy, dirs) {
+					continue
+				}
+				seen[[2]int{dx, dy}] = true
+				rules = append(rules, moveRule{
+					dx: dx, dy: dy, steps: steps,
+					moveOnly:    strings.ContainsRune(mods, 'm') && !strings.ContainsRune(mods, 'c'),
+					captureOnly: strings.ContainsRune(mods, 'c') && !strings.ContainsRune(mods, 'm'),
+					initial:     strings.ContainsRune(mods, 'i'),
+					lame:        strings.ContainsRune(mods, 'n'),
+				})
+			}
+		}
+	}
+
+	return rules
+}
+
+func allowedDirection(dx, dy int, dirs string) bool {
+	if dirs == "" {
+		return true
+	}
+
+	return (strings.ContainsRune(dirs, 'f') && dy > 0) ||
+		(strings.ContainsRune(dirs, 'b') && dy < 0) ||
+		(strings.ContainsRune(dirs, 'l') && dx < 0) ||
+		(strings.ContainsRune(dirs, 'r') && dx > 0)
+}
+
+/*
+ * movement
+ */
+
+// reaches reports whether rule takes a piece from one square to another on
+// t, with nothing in the way of a ride or a lame leap.
+func (r moveRule) reaches(t table, b Board, fromCol, fromRow, toCol, toRow int) bool {
+	if b.wraps() {
+		return r.reachesAround(t, b, fromCol, fromRow, toCol, toRow)
+	}
+
+	colDiff, rowDiff := toCol-fromCol, toRow-fromRow
+
+	var n int
+	switch {
+	case r.dx != 0:
+		n = colDiff / r.dx
+	default:
+		n = rowDiff / r.dy
+	}
+	if n < 1 || colDiff != n*r.dx || rowDiff != n*r.dy || (r.steps != 0 && n > r.steps) {
+		return false
+	}
+
+	// a ride is blocked on the squares it stops on, a lame leap on every
+	// square it passes and a leap along a line by the holes it crosses
+	unitX, unitY, per := r.dx, r.dy, 1
+	if r.lame || r.leapsLine() {
+		per = gcd(abs(r.dx), abs(r.dy))
+		unitX, unitY = r.dx/per, r.dy/per
+	}
+	for step := 1; step < n*per; step++ {
+		cell := getCellValue(fromCol+step*unitX, fromRow+step*unitY, t)
+		if cell == HC || (!isEmptySquare(cell) && (r.lame || step%per == 0)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// leapsLine reports whether the rule leaps over squares of a file, rank or
+// diagonal, as the Tower's D, A, H and G do. Such a leap jumps pieces but
+// not holes.
+func (r moveRule) leapsLine() bool {
+	return (r.dx == 0 || r.dy == 0 || abs(r.dx) == abs(r.dy)) && gcd(abs(r.dx), abs(r.dy)) > 1
+}
+
+// pieceMoves appends the moves of the piece on (col, row) to moves.
+func pieceMoves(moves []move, t table, b Board, info *pieceInfo, col, row int) []move {
+	first := len(moves)
+	for _, r := range info.rules {
+		if r.initial && !onInitialRank(row, b, info.white) {
+			continue
+		}
+		for step := 1; r.steps == 0 || step <= r.steps; step++ {
+			toCol, toRow, ok := b.wrap(col+step*r.dx, row+step*r.dy)
+			if !ok || (toCol == col && toRow == row) {
+				break
+			}
+			if (r.lame || r.leapsLine()) && !r.reaches(t, b, col, row, toCol, toRow) {
+				break
+			}
+
+			target := getCellValue(toCol, toRow, t)
+			if target == HC {
+				break
+			}
+			if isEmptySquare(target) {
+				if !r.captureOnly {
+					moves = append(moves, move{col, row, toCol, toRow, 0})
+				}
+				continue
+			}
+			if !r.moveOnly && !info.owns(target) {
+				moves = append(moves, move{col, row, toCol, toRow, 0})
+			}
+			break
+		}
+	}
+
+	// going round a wrapping board, two rules can reach the same square
+	if b.wraps() {
+		seen := make(map[move]bool)
+		own := slices.DeleteFunc(moves[first:], func(mv move) bool {
+			dup := seen[mv]
+			seen[mv] = true
+			return dup
+		})
+		moves = moves[:first+len(own)]
+	}
+
+	return moves
+}
+
+// pieceByLetter finds a piece by its letter, upper case for White.
+func pieceByLetter(letter string) (rune, bool) {
+	for piece, l := range glyphSets["letters"] {
+		if string(l) == letter && piece != HC && piece != FC {
+			return piece, true
+		}
+	}
+
+	return 0, false
+}
+
+func isEmptySquare(piece rune) bool {
+	return piece == 0 || piece == EC
+}
+
+// isValidPieceMove checks piece's movement from one square to another on
+// t, including the squares a ride passes and whether the move may capture.
+// known is false for runes that are not pieces of this game.
+func isValidPieceMove(piece rune, t table, b Board, fromCol, fromRow, toCol, toRow int) (valid, known bool) {
+	info, ok := pieces[piece]
+	if !ok {
+		return false, false
+	}
+
+	target := getCellValue(toCol, toRow, t)
+	if target == HC {
+		return false, true
+	}
+
+	empty := isEmptySquare(target)
+	for _, r := range info.rules {
+		if (r.moveOnly && !empty) || (r.captureOnly && empty) || (r.initial && !onInitialRank(fromRow, b, info.white)) {
+			continue
+		}
+		if r.reaches(t, b, fromCol, fromRow, toCol, toRow) {
+			return true, true
+		}
+	}
+
+	return false, true
+}
+
+// onInitialRank reports whether row is the side's second rank.
+func onInitialRank(row int, b Board, white bool) bool {
+	if white {
+		return row == b.Height-2
+	}
+
+	return row == 1
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return a
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// destinations lists the squares rules reach from (3, 3) on an empty board
+// as offsets, sorted.
+func destinations(rules []moveRule) [][2]int {
+	var out [][2]int
+	for dy := -6; dy <= 6; dy++ {
+		for dx := -6; dx <= 6; dx++ {
+			for _, r := range rules {
+				if r.reaches(nil, Board{}, 3, 3, 3+dx, 3+dy) {
+					out = append(out, [2]int{dx, dy})
+					break
+				}
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i][1] < out[j][1] || (out[i][1] == out[j][1] && out[i][0] < out[j][0]) })
+
+	return out
+}
+
+func TestParseBetza(t *testing.T) {
+	tests := []struct {
+		betza string
+		moves int // squares reached from the middle of an empty board
+		valid bool
+	}{
+		{"K", 8, true},
+		{"WF", 8, true},
+		{"N", 8, true},
+		{"WDHFAG", 24, true},
+		{"R3B3", 24, true},
+		{"W3F3", 24, true},
+		{"WW", 24, true}, // limited by the probe window
+		{"Q", 48, true},
+		{"fW", 1, true},
+		{"fmWfcF", 3, true},
+		{"lrW", 2, true},
+		{"", 0, false},
+		{"X", 0, false},
+		{"W0", 0, false},
+		{"fm", 0, false},
+	}
+
+	for _, test := range tests {
+		rules, err := parseBetza(test.betza)
+		if (err == nil) != test.valid {
+			t.Errorf("parseBetza(%q) error = %v; want valid %v", test.betza, err, test.valid)
+			continue
+		}
+		if got := len(destinations(rules)); err == nil && got != test.moves {
+			t.Errorf("parseBetza(%q) reaches %d squares; want %d", test.betza, got, test.moves)
+		}
+	}
+}
+
+func TestRidersAreBlocked(t *testing.T) {
+	rider, _ := parseBetza("R3B3")
+	leaper, _ := parseBetza("WDHFAG")
+	if len(destinations(rider)) != len(destinations(leaper)) {
+		t.Fatalf("R3B3 and WDHFAG should cover the same squares on an empty board")
+	}
+
+	// a piece on (3, 2) stands between (3, 3) and (3, 0)
+	blocked := table{{3, 2}: BlackHorse}
+	reaches := func(rules []moveRule) bool {
+		for _, r := range rules {
+			if r.reaches(blocked, Board{}, 3, 3, 3, 0) {
+				return true
+			}
+		}
+		return false
+	}
+	if reaches(rider) {
+		t.Errorf("R3B3 rode through a piece")
+	}
+	if !reaches(leaper) {
+		t.Errorf("WDHFAG should jump like the Tower")
+	}
+}
+
+func TestPieceDirections(t *testing.T) {
+	registry := make(map[rune]*pieceInfo)
+	def := pieceDef{name: "Soldier", letter: 'S', white: 'S', black: 's', betza: "fmWfcF"}
+	if err := registerPiece(registry, &def); err != nil {
+		t.Fatalf("registerPiece: %v", err)
+	}
+	defer func() {
+		for _, piece := range []rune{'S', 's'} {
+			delete(glyphSets["letters"], piece)
+		}
+	}()
+
+	b := Board{Width: 6, Height: 6}
+	tab := table{{1, 2}: WhiteKing, {3, 1}: WhiteHorse}
+	tests := []struct {
+		piece    rune
+		col, row int
+		want     []move
+	}{
+		// White moves up the board and captures nothing: (1, 2) is its own
+		{'S', 2, 3, []move{{2, 3, 2, 2, 0}}},
+		// Black moves down and captures on (3, 1), not on the empty (1, 1)
+		{'s', 2, 0, []move{{2, 0, 3, 1, 0}, {2, 0, 2, 1, 0}}},
+	}
+	for _, test := range tests {
+		got := pieceMoves(nil, tab, b, registry[test.piece], test.col, test.row)
+		sort.Slice(got, func(i, j int) bool { return got[i].toCol > got[j].toCol })
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%c moves = %v; want %v", test.piece, got, test.want)
+		}
+	}
+
+	if err := registerPiece(registry, &def); err == nil {
+		t.Errorf("registering a piece twice should fail")
+	}
+}
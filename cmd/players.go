@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+var errNoMoves = errors.New("no moves available")
+var errEngineVariant = errors.New("engine players only play the small variant")
+
+const playerSpecHelp = "human, ai, ai:<level> or engine:<command>"
+
+// movePicker chooses the moves of a player slot that is not played from the
+// keyboard.
+type movePicker interface {
+	pickMove(t table, b Board, white bool) (move, error)
+	Close() error
+}
+
+// searchPlayer uses the built-in search. Without rules it plays the small
+// game.
+type searchPlayer struct {
+	limits searchLimits
+	rules  *variant
+}
+
+func (p searchPlayer) pickMove(t table, b Board, white bool) (move, error) {
+	mv, ok := search(context.Background(), p.rules, t, b, white, p.limits, nil)
+	if !ok {
+		return move{}, errNoMoves
+	}
+
+	return mv, nil
+}
+
+func (p searchPlayer) Close() error {
+	return nil
+}
+
+// enginePlayer asks an external engine over the engine protocol.
+type enginePlayer struct {
+	client *engineClient
+	limits searchLimits
+}
+
+func (p *enginePlayer) pickMove(t table, b Board, white bool) (move, error) {
+	text, err := p.client.bestMove(encodeFEN(t, b, white), p.limits)
+	if err != nil {
+		return move{}, err
+	}
+
+	mv, ok := parseMoveText(text, b)
+	if !ok {
+		return move{}, fmt.Errorf("engine %s sent an invalid move %q", p.client.name, text)
+	}
+
+	return mv, nil
+}
+
+func (p *enginePlayer) Close() error {
+	return p.client.Close()
+}
+
+// newPlayer builds the player for a slot from its spec. Human players have
+// no movePicker, so nil is returned for them.
+func newPlayer(spec string, cfg Config) (movePicker, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+
+	switch kind {
+	case "", "human":
+		return nil, nil
+
+	case "ai":
+		level := cfg.AILevel
+		if arg != "" {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < minAILevel || n > maxAILevel {
+				return nil, fmt.Errorf("ai level must be between %d and %d", minAILevel, maxAILevel)
+			}
+			level = n
+		}
+		rules, err := loadVariant(cfg.Variant)
+		if err != nil {
+			return nil, err
+		}
+		return searchPlayer{limits: searchLimits{depth: level}, rules: rules}, nil
+
+	case "engine":
+		// the engine protocol knows nothing of other variants' rules
+		if rules, err := loadVariant(cfg.Variant); err != nil {
+			return nil, err
+		} else if rules.Name != defaultVariant {
+			return nil, errEngineVariant
+		}
+		client, err := startEngine(arg)
+		if err != nil {
+			return nil, err
+		}
+		return &enginePlayer{client: client, limits: searchLimits{depth: cfg.AILevel}}, nil
+	}
+
+	return nil, fmt.Errorf("unknown player %q (use %s)", spec, playerSpecHelp)
+}
+
+// playerNames names the computer players after their specs; humans stay
+// unnamed.
+func playerNames(white, black string) [2]string {
+	var names [2]string
+	for i, spec := range []string{white, black} {
+		if spec != "" && spec != "human" {
+			names[i] = spec
+		}
+	}
+
+	return names
+}
+
+// machineName reports whether a recorded player name is a computer
+// player's spec, as playerNames gives them.
+func machineName(name string) bool {
+	kind, _, _ := strings.Cut(name, ":")
+	return strings.EqualFold(kind, "ai") || strings.EqualFold(kind, "engine")
+}
+
+func closePlayers(players [2]movePicker) {
+	for _, p := range players {
+		if p != nil {
+			p.Close()
+		}
+	}
+}
+
+/*
+ * TUI integration
+ */
+
+// machineMoveMsg carries the move chosen for a computer controlled side.
+// game identifies the game it was computed for, so a result arriving after
+// a restart is dropped.
+type machineMoveMsg struct {
+	mv   move
+	err  error
+	game time.Time
+}
+
+// sidePlayer returns the movePicker of the side to move, or nil for a human.
+func (m Model) sidePlayer() movePicker {
+	if m.isWhiteTurn {
+		return m.players[0]
+	}
+
+	return m.players[1]
+}
+
+// withMachineMove starts thinking for the side to move when it is computer
+// controlled, adding the work to cmd. A computer player that failed is not
+// asked again until the next game, and network games have none.
+func (m Model) withMachineMove(cmd tea.Cmd) (Model, tea.Cmd) {
+	p := m.sidePlayer()
+	if p == nil || m.thinking || m.engineFailed || m.net != nil || m.phase != phasePlaying {
+		return m, cmd
+	}
+
+	m.thinking = true
+	t, b, white, game := m.Table.clone(), m.Board, m.isWhiteTurn, m.startTime
+
+	return m, tea.Batch(cmd, func() tea.Msg {
+		mv, err := p.pickMove(t, b, white)
+		return machineMoveMsg{mv: mv, err: err, game: game}
+	})
+}
+
+// playMachineMove applies a move chosen by a movePicker through movePiece.
+// A move movePiece rejects is an error: asking the player again would only
+// bring the same move.
+func playMachineMove(m Model, mv move) (Model, error) {
+	from, to := moveArgs(mv, m.Board.Height)
+
+	m, msg := movePiece(from, to, m)
+	if msg != "" {
+		return m, fmt.Errorf("illegal move %s: %s", moveText(mv, m.Board.Height), strings.TrimSpace(msg))
+	}
+
+	return m, nil
+}
+
+// moveCommand writes mv as the prompt command that plays it.
+func moveCommand(mv move, height int) string {
+	if mv.isDrop() {
+		return "drop " + moveText(mv, height)
+	}
+
+	return fmt.Sprintf("move %s %s", squareName(mv.fromCol, mv.fromRow, height), destination(mv, height))
+}
+
+// moveArgs returns the squares movePiece takes for mv. A drop comes from
+// the hand, written as the piece's letter and "@".
+func moveArgs(mv move, height int) (from, to string) {
+	if mv.isDrop() {
+		return strings.ToLower(string(mv.promotion)) + "@", squareName(mv.toCol, mv.toRow, height)
+	}
+
+	return squareName(mv.fromCol, mv.fromRow, height), destination(mv, height)
+}
+
+// destination names the square mv goes to, with its promotion, e.g. "a6=H".
+func destination(mv move, height int) string {
+	to := squareName(mv.toCol, mv.toRow, height)
+	if mv.promotion != 0 {
+		to += "=" + string(mv.promotion)
+	}
+
+	return to
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+ * Player profiles live in a JSON file next to the game database. Ratings
+ * are Elo, updated whenever a game between two named players is recorded;
+ * the remaining statistics are computed from the database on demand.
+ */
+
+const profilesFileName = "profiles.json"
+const initialRating = 1500
+const ratingK = 32
+const maxNameLength = 20
+
+const leaderboardUsage = "usage: small-chess leaderboard [-n count]"
+const statsUsage = "usage: small-chess stats <player>"
+const promptWhiteNameMsg = "White player: "
+const promptBlackNameMsg = "Black player: "
+const pickPlayersMsg = "\nWho is playing? Type a name to play rated games, or leave it empty to play anonymously.\n"
+const knownPlayersMsg = "Known players: %s\n"
+const invalidNameMsg = "\n\nNames are up to 20 letters, digits, '-', '_' or '.', and not ai or engine.\n"
+const noPlayersMsg = "No rated players yet.\n"
+
+var profilesMu sync.Mutex
+
+type profile struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Rating  float64   `json:"rating"`
+	Games   int       `json:"games"`
+	Wins    int       `json:"wins"`
+	Draws   int       `json:"draws"`
+	Losses  int       `json:"losses"`
+}
+
+// profiles maps lower-cased names to profiles, so names are matched
+// without regard to case.
+type profiles map[string]*profile
+
+func profilesPath(cfg Config) string {
+	return filepath.Join(cfg.historyDir(), profilesFileName)
+}
+
+func validPlayerName(name string) bool {
+	if name == "" || utf8.RuneCountInString(name) > maxNameLength || machineName(name) {
+		return false
+	}
+
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-_.", r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func loadProfiles(path string) (profiles, error) {
+	p := make(profiles)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*profile
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, pr := range list {
+		p[strings.ToLower(pr.Name)] = pr
+	}
+
+	return p, nil
+}
+
+func (p profiles) save(path string) error {
+	list := p.ranked()
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// get returns the profile for name, creating it when it is new.
+func (p profiles) get(name string, now time.Time) *profile {
+	key := strings.ToLower(name)
+	if pr, ok := p[key]; ok {
+		return pr
+	}
+
+	pr := &profile{Name: name, Created: now, Rating: initialRating}
+	p[key] = pr
+
+	return pr
+}
+
+// ranked lists the profiles from the highest rating down.
+func (p profiles) ranked() []*profile {
+	list := make([]*profile, 0, len(p))
+	for _, pr := range p {
+		list = append(list, pr)
+	}
+
+	slices.SortFunc(list, func(a, b *profile) int {
+		if c := cmp.Compare(b.Rating, a.Rating); c != 0 {
+			return c
+		}
+		return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+
+	return list
+}
+
+// ensureProfile makes sure a player has a profile.
+func ensureProfile(cfg Config, name string) error {
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+
+	path := profilesPath(cfg)
+	p, err := loadProfiles(path)
+	if err != nil {
+		return err
+	}
+	if _, ok := p[strings.ToLower(name)]; ok {
+		return nil
+	}
+
+	p.get(name, time.Now())
+	return p.save(path)
+}
+
+// rateGame applies the Elo update of a finished game between two named
+// players. Computer players are not rated.
+func rateGame(cfg Config, rec gameRecord) error {
+	if rec.White == "" || rec.Black == "" || strings.EqualFold(rec.White, rec.Black) {
+		return nil
+	}
+	if machineName(rec.White) || machineName(rec.Black) {
+		return nil
+	}
+	if v, ok := knownVariant(rec.Variant); ok && v.Players == fourPlayers {
+		// ratings are for one player against another
+		return nil
+	}
+
+	score := 0.5
+	switch parseGameResult(rec.Result) {
+	case resultWhiteWins:
+		score = 1
+	case resultBlackWins:
+		score = 0
+	case resultNone:
+		return nil
+	}
+
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+
+	path := profilesPath(cfg)
+	p, err := loadProfiles(path)
+	if err != nil {
+		return err
+	}
+
+	white, black := p.get(rec.White, rec.Ended), p.get(rec.Black, rec.Ended)
+	white.Rating, black.Rating = eloUpdate(white.Rating, black.Rating, score)
+
+	for _, side := range []struct {
+		pr    *profile
+		score float64
+	}{{white, score}, {black, 1 - score}} {
+		side.pr.Games++
+		switch side.score {
+		case 1:
+			side.pr.Wins++
+		case 0:
+			side.pr.Losses++
+		default:
+			side.pr.Draws++
+		}
+	}
+
+	return p.save(path)
+}
+
+// eloUpdate returns the new ratings after a game where the first player
+// scored score (1, 0.5 or 0).
+func eloUpdate(a, b, score float64) (float64, float64) {
+	expected := scoreFromElo(a - b)
+	delta := ratingK * (score - expected)
+
+	return a + delta, b - delta
+}
+
+/*
+ * statistics
+ */
+
+// playerStats summarizes a player's recorded games.
+type playerStats struct {
+	games       int
+	winsAsWhite int
+	winsAsBlack int
+	draws       int
+	losses      int
+	totalMoves  int // full moves, one turn of every player
+	firstMoves  map[string]int
+}
+
+func collectStats(name string, records []gameRecord) playerStats {
+	s := playerStats{firstMoves: make(map[string]int)}
+
+	for _, rec := range records {
+		white := strings.EqualFold(rec.White, name)
+		if !white && !strings.EqualFold(rec.Black, name) {
+			continue
+		}
+
+		s.games++
+		players := 2
+		if fourPlayerRecord(rec) {
+			players = fourPlayers
+		}
+		s.totalMoves += (len(rec.Moves) + players - 1) / players
+
+		switch {
+		case rec.Result == "draw":
+			s.draws++
+		case rec.Result == "white" && white:
+			s.winsAsWhite++
+		case rec.Result == "black" && !white:
+			s.winsAsBlack++
+		default:
+			s.losses++
+		}
+
+		// the player's own first move
+		first := 0
+		if !white {
+			first = 1
+		}
+		if first < len(rec.Moves) {
+			s.firstMoves[rec.Moves[first]]++
+		}
+	}
+
+	return s
+}
+
+// favoriteMoves returns the most played first moves, most frequent first.
+func (s playerStats) favoriteMoves(n int) []string {
+	moves := sortedKeys(s.firstMoves)
+	slices.SortStableFunc(moves, func(a, b string) int {
+		return cmp.Compare(s.firstMoves[b], s.firstMoves[a])
+	})
+
+	return moves[:min(n, len(moves))]
+}
+
+/*
+ * commands
+ */
+
+// runLeaderboardCommand implements `small-chess leaderboard`.
+func runLeaderboardCommand(args []string, cfg Config, out io.Writer) error {
+	fs := flag.NewFlagSet("leaderboard", flag.ContinueOnError)
+	fs.SetOutput(out)
+	n := fs.Int("n", 20, "number of players to show")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New(leaderboardUsage)
+	}
+
+	p, err := loadProfiles(profilesPath(cfg))
+	if err != nil {
+		return err
+	}
+
+	var list []*profile
+	for _, pr := range p.ranked() {
+		if pr.Games > 0 && !machineName(pr.Name) {
+			list = append(list, pr)
+		}
+	}
+	if len(list) == 0 {
+		_, err := io.WriteString(out, noPlayersMsg)
+		return err
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tPLAYER\tRATING\tGAMES\tW\tD\tL")
+	for i, pr := range list[:min(*n, len(list))] {
+		fmt.Fprintf(tw, "%d\t%s\t%.0f\t%d\t%d\t%d\t%d\n", i+1, pr.Name, pr.Rating, pr.Games, pr.Wins, pr.Draws, pr.Losses)
+	}
+
+	return tw.Flush()
+}
+
+// runStatsCommand implements `small-chess stats <player>`.
+func runStatsCommand(args []string, cfg Config, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New(statsUsage)
+	}
+	name := args[0]
+
+	p, err := loadProfiles(profilesPath(cfg))
+	if err != nil {
+		return err
+	}
+	pr, ok := p[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("no player named %q", name)
+	}
+
+	records, err := loadGameRecords(gameDBPath(cfg))
+	if err != nil {
+		return err
+	}
+	s := collectStats(name, records)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s (rating %.0f, playing since %s)\n\n", pr.Name, pr.Rating, pr.Created.Format(dateLayout)))
+	sb.WriteString(fmt.Sprintf("Games:           %d\n", s.games))
+	sb.WriteString(fmt.Sprintf("Wins as White:   %d\n", s.winsAsWhite))
+	sb.WriteString(fmt.Sprintf("Wins as Black:   %d\n", s.winsAsBlack))
+	sb.WriteString(fmt.Sprintf("Draws:           %d\n", s.draws))
+	sb.WriteString(fmt.Sprintf("Losses:          %d\n", s.losses))
+	if s.games > 0 {
+		sb.WriteString(fmt.Sprintf("Average length:  %.1f moves\n", float64(s.totalMoves)/float64(s.games)))
+	}
+	if favorites := s.favoriteMoves(3); len(favorites) > 0 {
+		var list []string
+		for _, mv := range favorites {
+			list = append(list, fmt.Sprintf("%s (%d)", mv, s.firstMoves[mv]))
+		}
+		sb.WriteString(fmt.Sprintf("Favorite opening moves: %s\n", strings.Join(list, ", ")))
+	}
+
+	_, err = io.WriteString(out, sb.String())
+	return err
+}
+
+/*
+ * TUI
+ */
+
+// nextPickSide returns the side (1 for White, 2 for Black) after the given
+// one whose name is still to be asked, or 0 when every name is known.
+// Computer players are named after their specs and network games are not
+// rated, so neither is asked.
+func (m Model) nextPickSide(after int) int {
+	if m.net != nil {
+		return 0
+	}
+
+	for side := after + 1; side <= 2; side++ {
+		if m.players[side-1] == nil {
+			return side
+		}
+	}
+
+	return 0
+}
+
+// pickPlayer takes the name typed for m.pickSide and moves on to the next
+// side, starting the game after the last one. It reports false when the
+// name is invalid.
+func pickPlayer(m Model) (Model, bool) {
+	name := strings.TrimSpace(m.prompt.Value())
+	if name != "" && !validPlayerName(name) {
+		if !strings.Contains(m.Body.String(), invalidNameMsg) {
+			m.Body.WriteString(invalidNameMsg)
+		}
+		m.prompt.SetValue("")
+		return m, false
+	}
+
+	m.prompt.SetValue("")
+	m.names[m.pickSide-1] = name
+	if name != "" {
+		ensureProfile(m.config, name)
+	}
+
+	if m.pickSide = m.nextPickSide(m.pickSide); m.pickSide == 0 {
+		m = startGame(m)
+	}
+
+	return m, true
+}
+
+// renderPickPlayer draws the player name prompt.
+func renderPickPlayer(m Model) Model {
+	m.Body.Reset()
+	m.Body.WriteString(drawBoxMessage(welcomeMessage))
+	m.Body.WriteString(pickPlayersMsg)
+
+	if p, err := loadProfiles(profilesPath(m.config)); err == nil && len(p) > 0 {
+		var known []string
+		for _, pr := range p.ranked() {
+			known = append(known, fmt.Sprintf("%s (%.0f)", pr.Name, pr.Rating))
+		}
+		m.Body.WriteString(fmt.Sprintf(knownPlayersMsg, strings.Join(known, ", ")))
+	}
+	m.Body.WriteString("\n")
+
+	m.prompt.Prompt = promptWhiteNameMsg
+	if m.pickSide == 2 {
+		m.prompt.Prompt = promptBlackNameMsg
+	}
+	m.prompt.Placeholder = ""
+	m.Body.WriteString(m.prompt.View())
+	m.prompt.Focus()
+
+	return m
+}
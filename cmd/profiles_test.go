@@ -0,0 +1,153 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestEloUpdate(t *testing.T) {
+	tests := []struct {
+		a, b, score float64
+		newA, newB  float64
+	}{
+		{1500, 1500, 1, 1516, 1484},
+		{1500, 1500, 0.5, 1500, 1500},
+		{1700, 1500, 0, 1675.69, 1524.31},
+	}
+
+	for _, test := range tests {
+		a, b := eloUpdate(test.a, test.b, test.score)
+		if math.Abs(a-test.newA) > 0.01 || math.Abs(b-test.newB) > 0.01 {
+			t.Errorf("eloUpdate(%v, %v, %v) = %.2f, %.2f; want %.2f, %.2f", test.a, test.b, test.score, a, b, test.newA, test.newB)
+		}
+	}
+}
+
+func TestLeaderboardAndStats(t *testing.T) {
+	cfg := headlessTestConfig(t)
+
+	for _, rec := range []gameRecord{
+		{White: "alice", Black: "bob", Result: "white", Moves: []string{"b1e4", "d6b5", "e4e6"}},
+		{White: "Bob", Black: "alice", Result: "white", Moves: []string{"c1d3", "d6b5"}},
+		{White: "alice", Black: "carol", Result: "draw", Moves: []string{"b1e4", "f6e5", "a1b2", "e5f6"}},
+		{White: "alice", Result: "white", Moves: []string{"c1d3"}}, // unrated
+	} {
+		rec.Width, rec.Height, rec.Variant = 6, 6, defaultVariant
+		if err := addGameRecord(gameDBPath(cfg), rec); err != nil {
+			t.Fatal(err)
+		}
+		if err := rateGame(cfg, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// games against computer players are not rated
+	for _, machine := range []string{"ai", "ai:3", "engine:./uci"} {
+		rec := gameRecord{White: "alice", Black: machine, Result: "black", Width: 6, Height: 6, Variant: defaultVariant}
+		if err := rateGame(cfg, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out strings.Builder
+	if err := runLeaderboardCommand(nil, cfg, &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[1], "bob") || !strings.Contains(lines[3], "alice") {
+		t.Errorf("leaderboard:\n%s", out.String())
+	}
+	if fields := strings.Fields(lines[3]); fields[3] != "3" || fields[4] != "1" || fields[5] != "1" || fields[6] != "1" {
+		t.Errorf("alice's line = %q; want 3 games, 1 win, 1 draw, 1 loss", lines[3])
+	}
+
+	out.Reset()
+	if err := runStatsCommand([]string{"ALICE"}, cfg, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Games:           4", "Wins as White:   2", "Wins as Black:   0", "Losses:          1", "Average length:  1.5 moves", "Favorite opening moves: b1e4 (2), c1d3 (1), d6b5 (1)"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("stats are missing %q:\n%s", want, out.String())
+		}
+	}
+
+	if err := runStatsCommand([]string{"dave"}, cfg, &out); err == nil {
+		t.Errorf("stats for an unknown player should fail")
+	}
+}
+
+func TestValidPlayerName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"alice", true},
+		{"J.R_Smith-2", true},
+		{"Zoë", true},
+		{strings.Repeat("Å", 20), true}, // 40 bytes
+		{strings.Repeat("Å", 21), false},
+		{"", false},
+		{"not a name!", false},
+		{"ai", false},
+		{"AI:3", false},
+		{"engine", false},
+		{"aida", true},
+	}
+
+	for _, test := range tests {
+		if got := validPlayerName(test.name); got != test.want {
+			t.Errorf("validPlayerName(%q) = %v; want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// typeLine sends the keys of line followed by enter.
+func typeLine(m tea.Model, line string) tea.Model {
+	if line != "" {
+		m, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(line)})
+	}
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+
+	return m
+}
+
+func TestPickPlayers(t *testing.T) {
+	cfg := headlessTestConfig(t)
+	cfg.Width, cfg.Height = 0, 0
+
+	var m tea.Model = newModel(cfg)
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 80, Height: 40})
+	m = typeLine(m, "6")
+	m = typeLine(m, "6")
+	m = typeLine(m, "") // standard start
+
+	if got := m.(Model); got.pickSide != 1 || got.Table != nil || !strings.Contains(got.View(), promptWhiteNameMsg) {
+		t.Fatalf("after the board size: pickSide %d\n%s", got.pickSide, got.View())
+	}
+
+	m = typeLine(m, "not a name!")
+	if !strings.Contains(m.View(), strings.TrimSpace(invalidNameMsg)) {
+		t.Errorf("invalid name accepted:\n%s", m.View())
+	}
+
+	m = typeLine(m, "alice")
+	if !strings.Contains(m.View(), promptBlackNameMsg) || !strings.Contains(m.View(), "alice (1500)") {
+		t.Errorf("black prompt:\n%s", m.View())
+	}
+
+	m = typeLine(m, "")
+	got := m.(Model)
+	if got.Table == nil || got.names != [2]string{"alice", ""} {
+		t.Errorf("game not started with the names: %q", got.names)
+	}
+
+	// a computer side is not asked for a name
+	computer := newModel(cfg)
+	computer.players[0] = searchPlayer{limits: searchLimits{depth: 1}}
+	if side := computer.nextPickSide(0); side != 2 {
+		t.Errorf("nextPickSide with a computer White = %d; want 2", side)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+/*
+ * Promotion choices. A move that promotes can name the piece it turns into
+ * after its destination, as in "move a5 a6=H" or "a5a6h"; without one the
+ * variant's first choice is taken. In the TUI a move that could promote to
+ * more than one piece asks which before it is played.
+ */
+
+const promptPromotionMsg = "\nPromote to which piece (%s, Enter for %s)? \n> "
+const invalidPromotionMsg = "\n\nInvalid promotion for this move.\n"
+
+// splitPromotion separates the promotion letter from a destination such
+// as "a6=H" or "a6h". The letter is 0 when there is none.
+func splitPromotion(square string) (string, rune) {
+	n := len(square)
+	if n < 3 || !unicode.IsLetter(rune(square[n-1])) {
+		return square, 0
+	}
+
+	return strings.TrimSuffix(square[:n-1], "="), unicode.ToUpper(rune(square[n-1]))
+}
+
+// needsPromotionChoice reports whether input is a legal move of the side to
+// move that can promote to more than one piece and names none.
+func needsPromotionChoice(m Model, input string) (from, to string, ok bool) {
+	fields := strings.Fields(strings.ToLower(input))
+	if len(fields) != 3 || (fields[0] != "move" && fields[0] != "mv") || m.phase != phasePlaying || m.sidePlayer() != nil {
+		return "", "", false
+	}
+	from, to = fields[1], fields[2]
+
+	mv, valid := parseMoveText(from+to, m.Board)
+	if !valid || mv.promotion != 0 {
+		return "", "", false
+	}
+	piece := getCellValue(mv.fromCol, mv.fromRow, m.Table)
+	if !isOwnPiece(piece, m.isWhiteTurn) || len(m.rules().promotions(piece, mv.toRow, m.Board)) < 2 {
+		return "", "", false
+	}
+
+	legal := slices.ContainsFunc(m.rules().legalMoves(m.Table, m.Board, m.isWhiteTurn, m.moves), func(l move) bool {
+		l.promotion = 0
+		return l == mv
+	})
+
+	return from, to, legal
+}
+
+// promotionChoices lists the pieces the pending move can promote to.
+func promotionChoices(m Model) []string {
+	mv, _ := parseMoveText(m.promoting[0]+m.promoting[1], m.Board)
+	piece := getCellValue(mv.fromCol, mv.fromRow, m.Table)
+
+	return m.rules().promotions(piece, mv.toRow, m.Board)
+}
+
+func promotionPrompt(m Model) string {
+	choices := promotionChoices(m)
+
+	return fmt.Sprintf(promptPromotionMsg, strings.Join(choices, ", "), choices[0])
+}
+
+// pickPromotion turns the letter typed for the pending move into the move
+// command that plays it, the first choice when nothing was typed. It
+// reports false when the letter is not one of the choices.
+func pickPromotion(m Model, input string) (string, bool) {
+	choices := promotionChoices(m)
+	letter := strings.ToUpper(strings.TrimSpace(input))
+	if letter == "" {
+		letter = choices[0]
+	}
+	if !slices.Contains(choices, letter) {
+		if !strings.Contains(m.Body.String(), invalidPromotionMsg) {
+			m.Body.WriteString(invalidPromotionMsg)
+		}
+		return "", false
+	}
+
+	return fmt.Sprintf("move %s %s=%s", m.promoting[0], m.promoting[1], letter), true
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestSplitPromotion(t *testing.T) {
+	tests := []struct {
+		text   string
+		square string
+		letter rune
+	}{
+		{"a6", "a6", 0},
+		{"a6=h", "a6", 'H'},
+		{"A6T", "A6", 'T'},
+		{"b10", "b10", 0},
+		{"b10=q", "b10", 'Q'},
+	}
+
+	for _, test := range tests {
+		if square, letter := splitPromotion(test.text); square != test.square || letter != test.letter {
+			t.Errorf("splitPromotion(%q) = %q, %q; want %q, %q", test.text, square, letter, test.square, test.letter)
+		}
+	}
+}
+
+func TestPawnsVariant(t *testing.T) {
+	if got := variantGame(t, "pawns", Board{Width: 6, Height: 6}, "").fen(); got != "3htk/pppppp/6/6/PPPPPP/KTH3 w" {
+		t.Errorf("start = %s", got)
+	}
+
+	tests := []struct {
+		to       string
+		msg      string
+		promoted rune
+		notation string
+	}{
+		{"a6", "", WhiteTower, "a5a6t"},
+		{"a6=H", "", WhiteHorse, "a5a6h"},
+		{"a6h", "", WhiteHorse, "a5a6h"},
+		{"a6=K", invalidPromotionMsg, WhitePawn, ""},
+	}
+
+	for _, test := range tests {
+		m := variantGame(t, "pawns", Board{Width: 6, Height: 6}, "5k/P5/6/6/6/K5 w")
+		m.config.Notation = "coordinate"
+		m, msg := movePiece("a5", test.to, m)
+		if msg != test.msg || getCellValue(0, 0, m.Table) != test.promoted && getCellValue(0, 1, m.Table) != test.promoted {
+			t.Errorf("%s: message %q, position %s", test.to, msg, m.fen())
+		}
+		if test.notation != "" && !strings.Contains(m.Body.String(), test.notation) {
+			t.Errorf("%s: move not written as %s:\n%s", test.to, test.notation, m.Body.String())
+		}
+		if test.notation != "" && m.gameRecord().Moves[0] != test.notation {
+			t.Errorf("%s: recorded as %s", test.to, m.gameRecord().Moves[0])
+		}
+	}
+
+	// a pawn that cannot promote takes no suffix
+	if _, msg := movePiece("a2", "a3=T", variantGame(t, "pawns", Board{Width: 6, Height: 6}, "")); msg != invalidPromotionMsg {
+		t.Errorf("promotion off the last rank: %q", msg)
+	}
+}
+
+func TestPromotionPrompt(t *testing.T) {
+	var m tea.Model = redrawGame(variantGame(t, "pawns", Board{Width: 6, Height: 6}, "5k/P5/6/6/6/K5 w"))
+
+	m = typeLine(m, "move a5 a6")
+	if view := m.View(); !strings.Contains(view, "Promote to which piece (T, H, Enter for T)?") {
+		t.Fatalf("no promotion prompt:\n%s", view)
+	}
+	if got := m.(Model).fen(); got != "5k/P5/6/6/6/K5 w" {
+		t.Errorf("the move was played before the choice: %s", got)
+	}
+
+	m = typeLine(m, "q")
+	if !strings.Contains(m.View(), strings.TrimSpace(invalidPromotionMsg)) {
+		t.Errorf("an invalid choice is not reported:\n%s", m.View())
+	}
+
+	m = typeLine(m, "h")
+	if got := m.(Model).fen(); got != "H4k/6/6/6/6/K5 b" {
+		t.Errorf("after choosing a Horse: %s", got)
+	}
+	if strings.Contains(m.View(), "Promote to") {
+		t.Errorf("the promotion prompt stayed:\n%s", m.View())
+	}
+}
+
+func TestSearchPromotes(t *testing.T) {
+	pawns, _ := knownVariant("pawns")
+	b := Board{Width: 6, Height: 6}
+	tb, _, _, err := decodeFEN("k5/4P1/6/6/6/5K w")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moves := pawns.generateMoves(tb, b, true)
+	var promotions []string
+	for _, mv := range moves {
+		if mv.promotion != 0 {
+			promotions = append(promotions, moveText(mv, b.Height))
+		}
+	}
+	if strings.Join(promotions, " ") != "e5e6t e5e6h" {
+		t.Errorf("promotions = %v", promotions)
+	}
+
+	// the Tower promotion gives check along the back rank and wins material
+	best, ok := search(context.Background(), pawns, tb, b, true, searchLimits{depth: 2}, nil)
+	if !ok || best.promotion != 'T' {
+		t.Errorf("best move = %s; want a promotion to a Tower", moveText(best, b.Height))
+	}
+}
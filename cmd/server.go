@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/activeterm"
+	bm "github.com/charmbracelet/wish/bubbletea"
+	"github.com/charmbracelet/wish/logging"
+)
+
+/*
+ * The SSH server gives every connection its own Model. Players meet in a
+ * lobby where they create games or join the open ones; the two players of
+ * a game are connected like a network game, through an in-memory pipe.
+ */
+
+const hostKeyFileName = "ssh_host_ed25519"
+const lobbyRefreshInterval = time.Second
+
+const serveUsage = "usage: small-chess serve [-addr :2222] [-host-key path]"
+const serverListeningMsg = "Serving small-chess over SSH on %s\n"
+const lobbyTitleMsg = "Lobby"
+const lobbyNoGamesMsg = "\nNo open games. Create one!\n"
+const lobbyGamesMsg = "\nOpen games:\n"
+const lobbyGameLineMsg = "  #%d  %dx%d  by %s\n"
+const lobbyPromptMsg = "\n> "
+const lobbyCreatedMsg = "\n\nGame #%d created. Waiting for an opponent...\n"
+const lobbyUnknownGameMsg = "\n\nThere is no open game #%s.\n"
+const lobbyCreateUsageMsg = "\n\nUsage: create <width>x<height> (e.g. create 8x8)\n"
+
+const lobbyHelpMessage = `
+
+Lobby commands:
+  create <w>x<h>         Open a game on a board of that size and play White
+  join <number>          Join an open game and play Black
+  exit                   Leave the server
+  help                   Show this list`
+
+var errGameNotOpen = errors.New("the game is no longer open")
+
+// lobby holds the games waiting for a second player.
+type lobby struct {
+	mu     sync.Mutex
+	nextID int
+	games  map[int]lobbyGame
+}
+
+type lobbyGame struct {
+	id    int
+	owner string
+	board Board
+	host  *netSession
+}
+
+func newLobby() *lobby {
+	return &lobby{nextID: 1, games: make(map[int]lobbyGame)}
+}
+
+func (l *lobby) create(owner string, b Board, host *netSession) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	id := l.nextID
+	l.nextID++
+	l.games[id] = lobbyGame{id: id, owner: owner, board: b, host: host}
+
+	return id
+}
+
+// join takes a game out of the lobby and connects a guest to it.
+func (l *lobby) join(id int) (*netSession, error) {
+	l.mu.Lock()
+	g, ok := l.games[id]
+	delete(l.games, id)
+	l.mu.Unlock()
+
+	if !ok {
+		return nil, errGameNotOpen
+	}
+
+	return g.host.joinLocal(), nil
+}
+
+func (l *lobby) cancel(id int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.games, id)
+}
+
+// open lists the waiting games, oldest first.
+func (l *lobby) open() []lobbyGame {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	games := make([]lobbyGame, 0, len(l.games))
+	for _, id := range sortedKeys(l.games) {
+		games = append(games, l.games[id])
+	}
+
+	return games
+}
+
+/*
+ * sessions
+ */
+
+// lobbySeat tracks what an SSH session has to release when it ends. It is
+// shared by the copies of the session's model.
+type lobbySeat struct {
+	mu     sync.Mutex
+	net    *netSession
+	gameID int
+}
+
+func (s *lobbySeat) take(session *netSession, gameID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.net = session
+	s.gameID = gameID
+}
+
+func (s *lobbySeat) release(l *lobby) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.gameID != 0 {
+		l.cancel(s.gameID)
+	}
+	if s.net != nil {
+		s.net.Close()
+	}
+}
+
+// lobbyModel is the Bubble Tea model of one SSH session: the lobby until
+// the player creates or joins a game, then that game's Model.
+type lobbyModel struct {
+	lobby   *lobby
+	seat    *lobbySeat
+	config  Config
+	user    string
+	prompt  textinput.Model
+	message string
+	game    *Model
+}
+
+type lobbyRefreshMsg struct{}
+
+func newLobbyModel(l *lobby, seat *lobbySeat, cfg Config, user string) lobbyModel {
+	ti := textinput.New()
+	ti.Prompt = lobbyPromptMsg
+	ti.CharLimit = 40
+	ti.Width = 40
+	ti.Focus()
+
+	return lobbyModel{lobby: l, seat: seat, config: cfg, user: user, prompt: ti}
+}
+
+func refreshLobby() tea.Cmd {
+	return tea.Tick(lobbyRefreshInterval, func(time.Time) tea.Msg { return lobbyRefreshMsg{} })
+}
+
+func (s lobbyModel) Init() tea.Cmd {
+	return tea.Batch(textinput.Blink, refreshLobby())
+}
+
+func (s lobbyModel) View() string {
+	if s.game != nil {
+		return s.game.View()
+	}
+
+	var sb strings.Builder
+	sb.WriteString(drawBoxMessage(welcomeMessage))
+	sb.WriteString("\n\n")
+	sb.WriteString(lobbyTitleMsg)
+	sb.WriteString("\n")
+
+	games := s.lobby.open()
+	if len(games) == 0 {
+		sb.WriteString(lobbyNoGamesMsg)
+	} else {
+		sb.WriteString(lobbyGamesMsg)
+		for _, g := range games {
+			sb.WriteString(fmt.Sprintf(lobbyGameLineMsg, g.id, g.board.Width, g.board.Height, g.owner))
+		}
+	}
+
+	sb.WriteString(s.prompt.View())
+	sb.WriteString(s.message)
+
+	return sb.String()
+}
+
+func (s lobbyModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if s.game != nil {
+		if _, ok := msg.(lobbyRefreshMsg); ok {
+			return s, nil
+		}
+
+		next, cmd := s.game.Update(msg)
+		game := next.(Model)
+		s.game = &game
+		return s, cmd
+	}
+
+	switch msg := msg.(type) {
+	case lobbyRefreshMsg:
+		return s, refreshLobby()
+
+	case tea.KeyMsg:
+		switch s.config.keyAction(msg.String()) {
+		case actionQuit:
+			return s, tea.Quit
+		case actionSubmit:
+			input := s.prompt.Value()
+			s.prompt.SetValue("")
+			return s.runLobbyCommand(input)
+		}
+	}
+
+	var cmd tea.Cmd
+	s.prompt, cmd = s.prompt.Update(msg)
+
+	return s, cmd
+}
+
+// runLobbyCommand handles a line typed in the lobby.
+func (s lobbyModel) runLobbyCommand(input string) (tea.Model, tea.Cmd) {
+	fields := strings.Fields(strings.ToLower(input))
+	if len(fields) == 0 {
+		return s, nil
+	}
+
+	s.message = ""
+	switch fields[0] {
+	case "create":
+		m := newModel(s.config)
+		rules := m.rules()
+		b := Board{Width: s.config.Width, Height: s.config.Height}
+		if len(fields) > 1 {
+			sizes, err := parseBoardSizes(fields[1], rules.MinSize, rules.MaxSize)
+			if err != nil || len(sizes) != 1 {
+				s.message = lobbyCreateUsageMsg
+				return s, nil
+			}
+			b = sizes[0]
+		}
+		if !rules.validSize(b.Width) || !rules.validSize(b.Height) {
+			s.message = lobbyCreateUsageMsg
+			return s, nil
+		}
+
+		host := newLocalHost()
+		id := s.lobby.create(s.user, b, host)
+		s.seat.take(host, id)
+
+		m.Board = b
+		m.net = host
+		m = renderBody(startGame(m))
+		m.Body.WriteString(fmt.Sprintf(lobbyCreatedMsg, id))
+		s.game = &m
+		return s, m.Init()
+
+	case "join":
+		id, err := strconv.Atoi(strings.TrimPrefix(strings.Join(fields[1:], ""), "#"))
+		var guest *netSession
+		if err == nil {
+			guest, err = s.lobby.join(id)
+		}
+		if err != nil {
+			s.message = fmt.Sprintf(lobbyUnknownGameMsg, strings.Join(fields[1:], " "))
+			return s, nil
+		}
+		s.seat.take(guest, 0)
+
+		m := newModel(s.config)
+		m.net = guest
+		m = renderBody(m)
+		s.game = &m
+		return s, m.Init()
+
+	case "help", "h":
+		s.message = lobbyHelpMessage
+
+	case "exit":
+		return s, tea.Quit
+
+	default:
+		s.message = invalidCommandMsg
+	}
+
+	return s, nil
+}
+
+/*
+ * server
+ */
+
+func defaultHostKeyPath() string {
+	return filepath.Join(filepath.Dir(defaultConfigPath()), hostKeyFileName)
+}
+
+// newGameServer returns an SSH server for the lobby. The host key is
+// generated at hostKeyPath if it does not exist yet.
+func newGameServer(cfg Config, hostKeyPath string) (*ssh.Server, error) {
+	if err := os.MkdirAll(filepath.Dir(hostKeyPath), 0o700); err != nil {
+		return nil, err
+	}
+
+	l := newLobby()
+	handler := func(sess ssh.Session) (tea.Model, []tea.ProgramOption) {
+		seat := &lobbySeat{}
+		go func() {
+			<-sess.Context().Done()
+			seat.release(l)
+		}()
+
+		return newLobbyModel(l, seat, cfg, sess.User()), nil
+	}
+
+	return wish.NewServer(
+		wish.WithHostKeyPath(hostKeyPath),
+		wish.WithMiddleware(
+			bm.Middleware(handler),
+			activeterm.Middleware(),
+			logging.Middleware(),
+		),
+	)
+}
+
+// runServeCommand implements `small-chess serve`.
+func runServeCommand(args []string, cfg Config, out io.Writer) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(out)
+	addr := fs.String("addr", ":2222", "address to listen on")
+	hostKey := fs.String("host-key", defaultHostKeyPath(), "SSH host key, generated if missing")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New(serveUsage)
+	}
+	if newModel(cfg).rules().Players == fourPlayers {
+		return errFourPlayersLocal
+	}
+
+	srv, err := newGameServer(cfg, *hostKey)
+	if err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, serverListeningMsg, ln.Addr())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, ssh.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// sshTestClient is a player connected to the test server with a terminal.
+type sshTestClient struct {
+	t     *testing.T
+	stdin io.Writer
+	close func()
+
+	mu   sync.Mutex
+	out  bytes.Buffer
+	seen int
+}
+
+func (c *sshTestClient) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.out.Write(p)
+}
+
+func dialTestServer(t *testing.T, addr, user string) *sshTestClient {
+	t.Helper()
+
+	client, err := gossh.Dial("tcp", addr, &gossh.ClientConfig{
+		User:            user,
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+
+	sess, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("session: %v", err)
+	}
+
+	c := &sshTestClient{t: t}
+	sess.Stdout = c
+	if c.stdin, err = sess.StdinPipe(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.RequestPty("xterm", 60, 120, gossh.TerminalModes{}); err != nil {
+		t.Fatalf("pty: %v", err)
+	}
+	if err := sess.Shell(); err != nil {
+		t.Fatalf("shell: %v", err)
+	}
+
+	c.close = func() {
+		sess.Close()
+		client.Close()
+	}
+	t.Cleanup(c.close)
+
+	return c
+}
+
+// waitFor waits until text shows up in output not matched before.
+func (c *sshTestClient) waitFor(text string) {
+	c.t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		out := c.out.String()[c.seen:]
+		if i := strings.Index(out, text); i >= 0 {
+			c.seen += i + len(text)
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c.t.Fatalf("timed out waiting for %q in %q", text, c.out.String()[c.seen:])
+}
+
+func (c *sshTestClient) typeLine(line string) {
+	io.WriteString(c.stdin, line)
+	time.Sleep(20 * time.Millisecond)
+	io.WriteString(c.stdin, "\r")
+}
+
+func TestGameServer(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "keys", hostKeyFileName)
+
+	srv, err := newGameServer(headlessTestConfig(t), keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatalf("host key was not generated: %v", err)
+	}
+	if _, err := newGameServer(headlessTestConfig(t), keyPath); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := os.ReadFile(keyPath); !bytes.Equal(again, key) {
+		t.Errorf("host key changed on the second start")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	addr := ln.Addr().String()
+
+	alice := dialTestServer(t, addr, "alice")
+	alice.waitFor("No open games")
+	alice.typeLine("create 6x6")
+	alice.waitFor("Game #1 created")
+
+	bob := dialTestServer(t, addr, "bob")
+	bob.waitFor("#1  6x6  by alice")
+	bob.typeLine("join 1")
+	bob.waitFor("Turn: White")
+	alice.waitFor("Opponent connected")
+
+	alice.typeLine("move b1 e4")
+	bob.waitFor("Opponent moved b1 to e4")
+
+	// the game is taken, and a third player starts in their own lobby
+	carol := dialTestServer(t, addr, "carol")
+	carol.waitFor("No open games")
+	carol.typeLine("join 1")
+	carol.waitFor("There is no open game #1")
+
+	bob.close()
+	alice.waitFor("Your opponent left the game")
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+ * Shuffled starts deal the King, Tower and Horse, and optionally a few
+ * extra Towers or Horses, in random order onto each side's back corner.
+ * Black's arrangement mirrors White's through the centre of the board, as
+ * in the standard layout. The seed numbers the position, so the same seed
+ * and extras always give the same start. Only variants laid out like the
+ * small game can be shuffled; the others always start from their layout.
+ */
+
+const maxShuffleExtra = 3
+
+const startUsage = "standard, shuffle, shuffle <seed> or shuffle <seed> +<extra pieces>"
+const promptStartMsg = "Starting position: "
+const pickStartMsg = "\nChoose the starting position: press enter for the standard one, or type shuffle, optionally with a seed number and +1 to +3 extra pieces (e.g. shuffle 42 +2).\n\n"
+const invalidStartMsg = "\n\nInvalid starting position. Use " + startUsage + ".\n"
+const shuffledStartMsg = "Shuffled start #%d"
+
+var errNoShuffle = errors.New("only variants with the small game's layout can start shuffled")
+
+// startSpec is a parsed starting position choice.
+type startSpec struct {
+	shuffle bool
+	seed    int64 // 0 picks a new seed
+	extra   int
+}
+
+func parseStartSpec(text string) (startSpec, error) {
+	fields := strings.Fields(strings.ToLower(text))
+	if len(fields) == 0 || (len(fields) == 1 && fields[0] == "standard") {
+		return startSpec{}, nil
+	}
+	if fields[0] != "shuffle" || len(fields) > 3 {
+		return startSpec{}, fmt.Errorf("starting position must be %s", startUsage)
+	}
+
+	spec := startSpec{shuffle: true}
+	for _, f := range fields[1:] {
+		if n, ok := strings.CutPrefix(f, "+"); ok {
+			extra, err := strconv.Atoi(n)
+			if err != nil || extra < 0 || extra > maxShuffleExtra {
+				return startSpec{}, fmt.Errorf("extra pieces must be between 0 and %d", maxShuffleExtra)
+			}
+			spec.extra = extra
+			continue
+		}
+
+		seed, err := strconv.ParseInt(f, 10, 64)
+		if err != nil || seed <= 0 {
+			return startSpec{}, fmt.Errorf("the seed must be a positive number")
+		}
+		spec.seed = seed
+	}
+
+	return spec, nil
+}
+
+// shuffles reports whether v starts like the small game, with nothing on
+// the board a shuffled start would leave out.
+func (v *variant) shuffles() bool {
+	return slices.Equal(v.Layout, []string{"KTH"}) && v.Symmetry == "rotate" && len(v.Holes) == 0 && v.Players != fourPlayers
+}
+
+// checkStart reports a shuffled start configured for a variant that cannot
+// be shuffled.
+func (c Config) checkStart() error {
+	spec, err := parseStartSpec(c.Start)
+	if err != nil || !spec.shuffle {
+		return err
+	}
+	if v, err := loadVariant(c.Variant); err == nil && !v.shuffles() {
+		return errNoShuffle
+	}
+
+	return nil
+}
+
+// shuffleTable deals the back corners for seed. extra Towers or Horses
+// join the King, Tower and Horse, so 3+extra squares are filled per side.
+func shuffleTable(width, height int, seed int64, extra int) table {
+	rng := rand.New(rand.NewSource(seed))
+
+	pieces := []rune{WhiteKing, WhiteTower, WhiteHorse}
+	for i := 0; i < extra; i++ {
+		pieces = append(pieces, []rune{WhiteTower, WhiteHorse}[rng.Intn(2)])
+	}
+	rng.Shuffle(len(pieces), func(i, j int) { pieces[i], pieces[j] = pieces[j], pieces[i] })
+
+	black := map[rune]rune{WhiteKing: BlackKing, WhiteTower: BlackTower, WhiteHorse: BlackHorse}
+	t := make(table)
+	for col, piece := range pieces {
+		t[[2]int{col, height - 1}] = piece
+		t[[2]int{width - 1 - col, 0}] = black[piece]
+	}
+
+	return t
+}
+
+// applyStartSpec sets the position the next games start from, and the note
+// logged with them.
+func applyStartSpec(m Model, spec startSpec) Model {
+	if !spec.shuffle {
+		m.startFEN, m.startNote = "", ""
+		return m
+	}
+
+	seed := spec.seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()%1_000_000 + 1
+	}
+
+	t := shuffleTable(m.Board.Width, m.Board.Height, seed, spec.extra)
+	m.startFEN = encodeFEN(t, m.Board, true)
+	m.startNote = fmt.Sprintf(shuffledStartMsg, seed)
+	if spec.extra > 0 {
+		m.startNote += fmt.Sprintf(" +%d", spec.extra)
+	}
+
+	return m
+}
+
+/*
+ * TUI
+ */
+
+// chooseStart follows the board size in setup: the configured start is
+// used when there is one, otherwise the players are asked. Variants that
+// cannot be shuffled start from their layout without asking.
+func chooseStart(m Model) Model {
+	if !m.rules().shuffles() {
+		return afterStart(applyStartSpec(m, startSpec{}))
+	}
+	if m.config.Start == "" {
+		m.startPending = true
+		return m
+	}
+
+	spec, _ := parseStartSpec(m.config.Start) // validated with the config
+	return afterStart(applyStartSpec(m, spec))
+}
+
+// pickStart takes the starting position typed at the setup prompt. It
+// reports false when the answer is invalid.
+func pickStart(m Model) (Model, bool) {
+	spec, err := parseStartSpec(m.prompt.Value())
+	m.prompt.SetValue("")
+	if err != nil {
+		if !strings.Contains(m.Body.String(), invalidStartMsg) {
+			m.Body.WriteString(invalidStartMsg)
+		}
+		return m, false
+	}
+
+	m.startPending = false
+	return afterStart(applyStartSpec(m, spec)), true
+}
+
+// afterStart moves on to the player names, or starts the game when there
+// are none to ask.
+func afterStart(m Model) Model {
+	if m.pickSide = m.nextPickSide(0); m.pickSide == 0 {
+		m = startGame(m)
+		sendGameState(m)
+	}
+
+	return m
+}
+
+// renderPickStart draws the starting position prompt.
+func renderPickStart(m Model) Model {
+	m.Body.Reset()
+	m.Body.WriteString(drawBoxMessage(welcomeMessage))
+	m.Body.WriteString(pickStartMsg)
+
+	m.prompt.Prompt = promptStartMsg
+	m.prompt.Placeholder = "standard"
+	m.Body.WriteString(m.prompt.View())
+	m.prompt.Focus()
+
+	return m
+}
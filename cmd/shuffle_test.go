@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestParseStartSpec(t *testing.T) {
+	tests := []struct {
+		text  string
+		spec  startSpec
+		valid bool
+	}{
+		{"", startSpec{}, true},
+		{"standard", startSpec{}, true},
+		{"shuffle", startSpec{shuffle: true}, true},
+		{"Shuffle 42", startSpec{shuffle: true, seed: 42}, true},
+		{"shuffle 42 +2", startSpec{shuffle: true, seed: 42, extra: 2}, true},
+		{"shuffle +1", startSpec{shuffle: true, extra: 1}, true},
+		{"shuffle 0", startSpec{}, false},
+		{"shuffle 42 +4", startSpec{}, false},
+		{"shuffle 1 2 3", startSpec{}, false},
+		{"random", startSpec{}, false},
+	}
+
+	for _, test := range tests {
+		spec, err := parseStartSpec(test.text)
+		if (err == nil) != test.valid || (err == nil && spec != test.spec) {
+			t.Errorf("parseStartSpec(%q) = %+v, %v; want %+v, valid %v", test.text, spec, err, test.spec, test.valid)
+		}
+	}
+}
+
+func TestShuffleTable(t *testing.T) {
+	b := Board{Width: 6, Height: 6}
+	for seed := int64(1); seed <= 20; seed++ {
+		for extra := 0; extra <= maxShuffleExtra; extra++ {
+			tab := shuffleTable(b.Width, b.Height, seed, extra)
+			if encodeFEN(tab, b, true) != encodeFEN(shuffleTable(b.Width, b.Height, seed, extra), b, true) {
+				t.Fatalf("seed %d +%d is not reproducible", seed, extra)
+			}
+			if len(tab) != 2*(3+extra) {
+				t.Fatalf("seed %d +%d: %d pieces; want %d", seed, extra, len(tab), 2*(3+extra))
+			}
+			for col := 0; col < 3+extra; col++ {
+				white, black := tab[[2]int{col, b.Height - 1}], tab[[2]int{b.Width - 1 - col, 0}]
+				if !isWhitePiece(white) || !strings.EqualFold(pieceLetter(black), pieceLetter(white)) {
+					t.Fatalf("seed %d +%d: %c on %d does not mirror %c", seed, extra, black, col, white)
+				}
+			}
+			if err := validatePosition(tab, b, true); err != nil {
+				t.Fatalf("seed %d +%d: %v", seed, extra, err)
+			}
+		}
+	}
+}
+
+func TestShuffledStart(t *testing.T) {
+	var m tea.Model = newModel(headlessTestConfig(t))
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 80, Height: 40})
+	for _, line := range []string{"", ""} {
+		m = typeLine(m, line)
+	}
+	if !strings.Contains(m.View(), promptStartMsg) {
+		t.Fatalf("no starting position prompt:\n%s", m.View())
+	}
+
+	m = typeLine(m, "shuffle 42 +9")
+	if got := m.(Model); !got.startPending || !strings.Contains(m.View(), strings.TrimSpace(invalidStartMsg)) {
+		t.Fatalf("invalid start accepted:\n%s", m.View())
+	}
+
+	m = typeLine(m, "shuffle 42 +2")
+	for _, line := range []string{"", ""} {
+		m = typeLine(m, line)
+	}
+	got := m.(Model)
+	want := encodeFEN(shuffleTable(6, 6, 42, 2), Board{Width: 6, Height: 6}, true)
+	if got.phase != phasePlaying || got.startFEN != want || got.fen() != want {
+		t.Fatalf("shuffled game: phase %v, start %q, fen %q; want %q", got.phase, got.startFEN, got.fen(), want)
+	}
+
+	data, err := os.ReadFile(got.logFile)
+	if err != nil || !strings.Contains(string(data), "Shuffled start #42 +2") {
+		t.Errorf("history does not record the seed: %v\n%s", err, data)
+	}
+}
+
+func TestRunHeadlessShuffled(t *testing.T) {
+	cfg := headlessTestConfig(t)
+	cfg.Start = "shuffle 7"
+
+	var out strings.Builder
+	if _, err := runHeadless(cfg, [2]movePicker{}, strings.NewReader(""), &out, "json"); err != nil {
+		t.Fatalf("runHeadless: %v", err)
+	}
+
+	var state headlessState
+	if err := json.Unmarshal([]byte(strings.SplitN(out.String(), "\n", 2)[0]), &state); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out.String(), err)
+	}
+	want := boardRows(Model{Board: Board{Width: 6, Height: 6}, Table: shuffleTable(6, 6, 7, 0)})
+	if strings.Join(state.Board, "/") != strings.Join(want, "/") {
+		t.Errorf("headless board = %q; want shuffle 7 %q", state.Board, want)
+	}
+}
+
+func TestShuffleNeedsSmallLayout(t *testing.T) {
+	tests := []struct {
+		variant string
+		err     error
+	}{
+		{"small", nil},
+		{"mate", nil},
+		{"walls", errNoShuffle},
+		{"pawns", errNoShuffle},
+		{"chess", errNoShuffle},
+		{"four", errNoShuffle},
+	}
+
+	for _, test := range tests {
+		cfg := headlessTestConfig(t)
+		cfg.Variant, cfg.Start = test.variant, "shuffle 7"
+		if err := cfg.validate(); err != test.err {
+			t.Errorf("%s: %v; want %v", test.variant, err, test.err)
+		}
+	}
+
+	// variants that cannot be shuffled do not ask for a start
+	cfg := headlessTestConfig(t)
+	cfg.Variant = "walls"
+	var m tea.Model = newModel(cfg)
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 80, Height: 40})
+	// the size, then the players' names
+	for _, line := range []string{"", "", "", ""} {
+		m = typeLine(m, line)
+	}
+	if got := m.(Model); got.phase != phasePlaying || got.startFEN != "" {
+		t.Errorf("walls game: phase %v, start %q", got.phase, got.startFEN)
+	}
+}
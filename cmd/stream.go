@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/*
+ * Spectators follow API games as server-sent events. Every change to a
+ * game is sent as a "state" event holding the whole apiGameState, so a
+ * slow spectator can skip old events as long as it gets the newest one;
+ * while a clock runs, a "clock" event with the remaining times follows
+ * every second.
+ */
+
+const streamClockInterval = time.Second
+const streamBuffer = 8
+
+const (
+	streamState = "state"
+	streamClock = "clock"
+)
+
+type streamEvent struct {
+	name string
+	data any
+}
+
+// subscribe adds a spectator; the caller holds g.mu.
+func (g *storedGame) subscribe() chan streamEvent {
+	if g.streams == nil {
+		g.streams = make(map[chan streamEvent]bool)
+	}
+
+	ch := make(chan streamEvent, streamBuffer)
+	g.streams[ch] = true
+
+	return ch
+}
+
+// unsubscribe removes a spectator; the caller holds g.mu.
+func (g *storedGame) unsubscribe(ch chan streamEvent) {
+	delete(g.streams, ch)
+}
+
+// publish sends the game's state to every spectator. A spectator whose
+// buffer is full loses its oldest event instead, so the last state, such
+// as the result, always arrives. The caller holds g.mu.
+func (g *storedGame) publish(now time.Time) {
+	if len(g.streams) == 0 {
+		return
+	}
+
+	ev := streamEvent{name: streamState, data: g.state(now)}
+	for ch := range g.streams {
+		select {
+		case ch <- ev:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			// only publish sends, under g.mu, so there is room now
+			ch <- ev
+		}
+	}
+}
+
+func (s *apiServer) streamGame(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.store.get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errGameNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// the new spectator count is news for everybody, including the
+	// spectator that just arrived
+	g.mu.Lock()
+	ch := g.subscribe()
+	g.checkClock(s.now())
+	g.publish(s.now())
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		g.unsubscribe(ch)
+		g.publish(s.now())
+		g.mu.Unlock()
+	}()
+
+	ticker := time.NewTicker(streamClockInterval)
+	defer ticker.Stop()
+
+	for {
+		var ev streamEvent
+
+		select {
+		case <-r.Context().Done():
+			return
+		case ev = <-ch:
+		case <-ticker.C:
+			g.mu.Lock()
+			now := s.now()
+			g.checkClock(now)
+			running := g.clock != nil && !g.clock.stopped
+			if running {
+				ev = streamEvent{name: streamClock, data: g.clockState(now)}
+			}
+			g.mu.Unlock()
+
+			if !running {
+				continue
+			}
+		}
+
+		if err := writeEvent(w, ev); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w io.Writer, ev streamEvent) error {
+	data, err := json.Marshal(ev.data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.name, data)
+	return err
+}
+
+// readEvents parses a server-sent event stream, calling fn for each event
+// until the stream ends.
+func readEvents(r io.Reader, fn func(name string, data []byte)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	name := ""
+	var data strings.Builder
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			if data.Len() > 0 {
+				fn(name, []byte(data.String()))
+			}
+			name = ""
+			data.Reset()
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+
+	return scanner.Err()
+}
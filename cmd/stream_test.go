@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// nextState waits for the next state event of a stream.
+func nextState(t *testing.T, events <-chan streamMsg) apiGameState {
+	t.Helper()
+
+	for {
+		select {
+		case msg := <-events:
+			if msg.err != nil {
+				t.Fatalf("stream ended: %v", msg.err)
+			}
+			if msg.name != streamState {
+				continue
+			}
+			var st apiGameState
+			if err := json.Unmarshal(msg.data, &st); err != nil {
+				t.Fatal(err)
+			}
+			return st
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a state event")
+		}
+	}
+}
+
+func TestStreamGame(t *testing.T) {
+	ts := httptest.NewServer(newAPIServer(headlessTestConfig(t)))
+	defer ts.Close()
+
+	if _, err := http.Post(ts.URL+"/games", "application/json", strings.NewReader(`{"width": 6, "height": 6}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := openStream(ctx, ts.URL, "9"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("stream of a missing game: %v", err)
+	}
+
+	first, err := openStream(ctx, ts.URL, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := nextState(t, first); st.Spectators != 1 || st.Moves != 0 {
+		t.Errorf("initial state = %+v", st)
+	}
+
+	secondCtx, leave := context.WithCancel(ctx)
+	second, err := openStream(secondCtx, ts.URL, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := nextState(t, second); st.Spectators != 2 {
+		t.Errorf("second spectator sees %d spectators", st.Spectators)
+	}
+	if st := nextState(t, first); st.Spectators != 2 {
+		t.Errorf("first spectator sees %d spectators after the second joined", st.Spectators)
+	}
+
+	if _, err := http.Post(ts.URL+"/games/1/moves", "application/json", strings.NewReader(`{"move": "b1e4"}`)); err != nil {
+		t.Fatal(err)
+	}
+	for _, events := range []<-chan streamMsg{first, second} {
+		if st := nextState(t, events); st.Moves != 1 || st.Turn != "black" {
+			t.Errorf("state after the move = %+v", st)
+		}
+	}
+
+	leave()
+	if st := nextState(t, first); st.Spectators != 1 {
+		t.Errorf("spectators after one left = %d", st.Spectators)
+	}
+}
+
+func TestWatchModel(t *testing.T) {
+	s := newAPIServer(headlessTestConfig(t))
+	apiCall(t, s, "POST", "/games", `{"width": 6, "height": 6, "clock": 5}`, nil)
+
+	g, _ := s.store.get("1")
+	g.streams = map[chan streamEvent]bool{make(chan streamEvent): true}
+	data, _ := json.Marshal(g.state(time.Now()))
+
+	var m tea.Model = watchModel{config: defaultConfig(), id: "1"}
+	if view := m.View(); !strings.Contains(view, "Connecting to game 1") {
+		t.Errorf("view before the first event:\n%s", view)
+	}
+
+	m, _ = m.Update(streamMsg{name: streamState, data: data})
+	m, _ = m.Update(streamMsg{name: streamClock, data: []byte(`{"white_ms": 299000, "black_ms": 300000, "running": "white"}`)})
+
+	view := m.View()
+	board := drawTableWithMap(6, 6, createInitialTableMap(6, 6))
+	for _, want := range []string{board, "Turn: White", "White 4:59", "Black 5:00", "Spectators: 1"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("view is missing %q:\n%s", want, view)
+		}
+	}
+
+	m, _ = m.Update(streamMsg{err: errStreamClosed})
+	if view := m.View(); !strings.Contains(view, errStreamClosed.Error()) {
+		t.Errorf("view after the stream closed:\n%s", view)
+	}
+}
+
+func TestSlowSpectatorGetsResult(t *testing.T) {
+	s := newAPIServer(headlessTestConfig(t))
+	apiCall(t, s, "POST", "/games", `{"width": 6, "height": 6}`, nil)
+	g, _ := s.store.get("1")
+
+	g.mu.Lock()
+	ch := g.subscribe()
+	for range streamBuffer + 3 {
+		g.publish(time.Now())
+	}
+	g.m, _ = runCommand(g.m, "resign")
+	g.publish(time.Now())
+	g.mu.Unlock()
+
+	var last streamEvent
+	for len(ch) > 0 {
+		last = <-ch
+	}
+	if st, ok := last.data.(apiGameState); !ok || st.Result != "black" {
+		t.Errorf("last event of a full buffer = %+v; want the result", last)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+/*
+ * Board topologies. On a flat board every edge is a wall. A cylinder joins
+ * the left and right edges, so a piece leaving the a-file comes back on
+ * the last file, and a torus joins the top and bottom edges as well.
+ * Coordinates are written the same on every board; only the ways pieces
+ * move and attack change. The drawn board marks wrapping edges with dashed
+ * lines.
+ */
+
+const topologyFlat = "flat"
+const topologyCylinder = "cylinder"
+const topologyTorus = "torus"
+
+var topologies = []string{topologyFlat, topologyCylinder, topologyTorus}
+
+// wrapsSides reports whether the left and right edges of b are joined.
+func (b Board) wrapsSides() bool {
+	return b.Topology == topologyCylinder || b.Topology == topologyTorus
+}
+
+// wrapsEnds reports whether the top and bottom edges of b are joined.
+func (b Board) wrapsEnds() bool {
+	return b.Topology == topologyTorus
+}
+
+func (b Board) wraps() bool {
+	return b.wrapsSides() || b.wrapsEnds()
+}
+
+// sameSize reports whether two boards have the same dimensions, whatever
+// their topology.
+func (b Board) sameSize(other Board) bool {
+	return b.Width == other.Width && b.Height == other.Height
+}
+
+// wrap brings a square that went past a wrapping edge back onto the board.
+// ok is false when the square is off the board across an edge that does
+// not wrap.
+func (b Board) wrap(col, row int) (wrappedCol, wrappedRow int, ok bool) {
+	if b.wrapsSides() {
+		col = (col%b.Width + b.Width) % b.Width
+	}
+	if b.wrapsEnds() {
+		row = (row%b.Height + b.Height) % b.Height
+	}
+
+	return col, row, col >= 0 && col < b.Width && row >= 0 && row < b.Height
+}
+
+// distance counts the King steps between two squares, the short way round
+// on a wrapping board.
+func (b Board) distance(from, to [2]int) int {
+	cols, rows := abs(from[0]-to[0]), abs(from[1]-to[1])
+	if b.wrapsSides() {
+		cols = min(cols, b.Width-cols)
+	}
+	if b.wrapsEnds() {
+		rows = min(rows, b.Height-rows)
+	}
+
+	return max(cols, rows)
+}
+
+// reachesAround is reaches for a wrapping board: it follows the rule step
+// by step across the edges until it meets the target, is blocked, leaves
+// the board or comes back to where it started.
+func (r moveRule) reachesAround(t table, b Board, fromCol, fromRow, toCol, toRow int) bool {
+	unitX, unitY, per := r.dx, r.dy, 1
+	if r.lame || r.leapsLine() {
+		per = gcd(abs(r.dx), abs(r.dy))
+		unitX, unitY = r.dx/per, r.dy/per
+	}
+
+	col, row := fromCol, fromRow
+	for step := 1; r.steps == 0 || step <= r.steps*per; step++ {
+		var ok bool
+		if col, row, ok = b.wrap(col+unitX, row+unitY); !ok || (col == fromCol && row == fromRow) {
+			return false
+		}
+		if step%per == 0 && col == toCol && row == toRow {
+			return true
+		}
+		if cell := getCellValue(col, row, t); cell == HC || (!isEmptySquare(cell) && (r.lame || step%per == 0)) {
+			return false
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBoardWrap(t *testing.T) {
+	tests := []struct {
+		topology string
+		col, row int
+		want     [2]int
+		ok       bool
+	}{
+		{topologyFlat, -1, 2, [2]int{-1, 2}, false},
+		{topologyFlat, 5, 5, [2]int{5, 5}, true},
+		{topologyCylinder, -1, 2, [2]int{5, 2}, true},
+		{topologyCylinder, 7, 2, [2]int{1, 2}, true},
+		{topologyCylinder, 2, 6, [2]int{2, 6}, false},
+		{topologyTorus, -2, 6, [2]int{4, 0}, true},
+	}
+
+	for _, test := range tests {
+		b := Board{Width: 6, Height: 6, Topology: test.topology}
+		col, row, ok := b.wrap(test.col, test.row)
+		if [2]int{col, row} != test.want || ok != test.ok {
+			t.Errorf("%s wrap(%d, %d) = %d, %d, %v", test.topology, test.col, test.row, col, row, ok)
+		}
+	}
+
+	torus := Board{Width: 6, Height: 6, Topology: topologyTorus}
+	if d := torus.distance([2]int{0, 0}, [2]int{5, 5}); d != 1 {
+		t.Errorf("corner to corner on a torus = %d", d)
+	}
+}
+
+func TestWrappingMoves(t *testing.T) {
+	cylinder := Board{Width: 6, Height: 6, Topology: topologyCylinder}
+	torus := Board{Width: 6, Height: 6, Topology: topologyTorus}
+	tests := []struct {
+		name     string
+		b        Board
+		fen      string
+		piece    rune
+		from, to [2]int
+		want     bool
+	}{
+		{"King across the side", cylinder, "5k/6/6/6/6/K5 w", WhiteKing, [2]int{0, 5}, [2]int{5, 4}, true},
+		{"King across the end", cylinder, "5k/6/6/6/6/K5 w", WhiteKing, [2]int{0, 5}, [2]int{0, 0}, false},
+		{"King across the end of a torus", torus, "5k/6/6/6/6/K5 w", WhiteKing, [2]int{0, 5}, [2]int{0, 0}, true},
+		{"Rook round the back", cylinder, "5k/6/6/6/6/R1K3 w", WhiteRook, [2]int{0, 5}, [2]int{4, 5}, true},
+		{"Rook blocked both ways", cylinder, "5k/6/6/6/6/RK3K w", WhiteRook, [2]int{0, 5}, [2]int{3, 5}, false},
+		{"Horse over the side", cylinder, "5k/6/6/6/6/H5 w", WhiteHorse, [2]int{0, 5}, [2]int{4, 4}, true},
+		{"Horse on a flat board", Board{Width: 6, Height: 6}, "5k/6/6/6/6/H5 w", WhiteHorse, [2]int{0, 5}, [2]int{4, 4}, false},
+	}
+
+	for _, test := range tests {
+		tb, _, _, err := decodeFEN(test.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		valid, _ := isValidPieceMove(test.piece, tb, test.b, test.from[0], test.from[1], test.to[0], test.to[1])
+		generated := false
+		for _, mv := range generateMoves(tb, test.b, true) {
+			generated = generated || mv == move{test.from[0], test.from[1], test.to[0], test.to[1], 0}
+		}
+		if valid != test.want || generated != test.want {
+			t.Errorf("%s: valid %v, generated %v; want %v", test.name, valid, generated, test.want)
+		}
+	}
+
+	// a Rook riding all the way round lists each square once
+	tb, _, _, _ := decodeFEN("5k/6/6/6/6/R5 w")
+	moves := pieceMoves(nil, tb, cylinder, pieces[WhiteRook], 0, 5)
+	if len(moves) != 10 {
+		t.Errorf("Rook on a cylinder has %d moves; want 10", len(moves))
+	}
+}
+
+func TestCylinderVariant(t *testing.T) {
+	cfg := headlessTestConfig(t)
+	cfg.Variant = "cylinder"
+
+	m := newModel(cfg)
+	m.Board, m.startFEN = Board{Width: 6, Height: 6}, "5k/6/6/6/6/K4t w"
+	m = startGame(m)
+	if !m.Board.wrapsSides() || m.Board.wrapsEnds() {
+		t.Fatalf("board = %+v", m.Board)
+	}
+
+	// the Tower next to the King across the edge can be taken
+	m, msg := movePiece("a1", "f1", m)
+	if msg != "" || getCellValue(5, 5, m.Table) != WhiteKing {
+		t.Errorf("message %q, position %s", msg, m.fen())
+	}
+
+	board := drawBoard(m.Board, m.Table, nil)
+	if !strings.Contains(board, "│ ♔ ┆") || !strings.Contains(board, "┌───┬") {
+		t.Errorf("the wrapping sides are not drawn:\n%s", board)
+	}
+	if torus := drawBoard(Board{Width: 6, Height: 6, Topology: topologyTorus}, m.Table, nil); !strings.Contains(torus, "┌┄┄┄┬") {
+		t.Errorf("the wrapping ends are not drawn:\n%s", torus)
+	}
+}
+
+func TestTopologyCheck(t *testing.T) {
+	_, err := parseVariant([]byte(`name = "knot"
+layout = ["KTH"]
+topology = "knot"`), "test")
+	if err == nil || !strings.Contains(err.Error(), "unknown topology") {
+		t.Errorf("unknown topology: %v", err)
+	}
+
+	// on a torus the back ranks touch, so the Kings start next to each other
+	_, err = parseVariant([]byte(`name = "donut"
+layout = ["KTH"]
+topology = "torus"`), "test")
+	if err == nil || !strings.Contains(err.Error(), "not playable") {
+		t.Errorf("torus with touching Kings: %v", err)
+	}
+}
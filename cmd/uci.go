@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * The engine protocol is modeled on UCI. Positions are sent as
+ *
+ *   position startpos [moves b1c3 ...]
+ *   position fen <ranks> <side> [moves ...]
+ *
+ * where the fen ranks use the letters K, T and H for King, Tower and Horse
+ * (upper case for White) and may describe any board size the game allows.
+ * "position startpos" uses the BoardWidth and BoardHeight options, which
+ * are this protocol's extension for variable board sizes.
+ */
+
+const engineAuthor = "the small-chess authors"
+const defaultEngineSize = 8
+
+const engineTimeout = 30 * time.Second
+
+// engineSession is one conversation on the engine side of the protocol.
+type engineSession struct {
+	mu     sync.Mutex
+	out    io.Writer
+	board  Board
+	t      table
+	white  bool
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// runEngineProtocol answers protocol commands read from in until "quit" or
+// the end of the input.
+func runEngineProtocol(in io.Reader, out io.Writer) error {
+	s := &engineSession{out: out, board: Board{Width: defaultEngineSize, Height: defaultEngineSize}}
+	s.newGame()
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "uci":
+			s.send("id name %s", appName)
+			s.send("id author %s", engineAuthor)
+			s.send("option name BoardWidth type spin default %d min %d max %d", defaultEngineSize, smallVariant().MinSize, smallVariant().MaxSize)
+			s.send("option name BoardHeight type spin default %d min %d max %d", defaultEngineSize, smallVariant().MinSize, smallVariant().MaxSize)
+			s.send("uciok")
+		case "isready":
+			s.send("readyok")
+		case "setoption":
+			s.setOption(fields[1:])
+		case "ucinewgame":
+			s.stop()
+			s.newGame()
+		case "position":
+			s.stop()
+			if err := s.setPosition(fields[1:]); err != nil {
+				s.send("info string %v", err)
+			}
+		case "go":
+			s.stop()
+			s.start(parseGoLimits(fields[1:]))
+		case "stop":
+			s.stop()
+		case "quit":
+			s.stop()
+			return nil
+		default:
+			s.send("info string unknown command %s", fields[0])
+		}
+	}
+
+	s.stop()
+	return scanner.Err()
+}
+
+func (s *engineSession) send(format string, args ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Fprintf(s.out, format+"\n", args...)
+}
+
+func (s *engineSession) newGame() {
+	s.t = createInitialTableMap(s.board.Width, s.board.Height)
+	s.white = true
+}
+
+func (s *engineSession) setOption(args []string) {
+	// setoption name <id> value <x>
+	if len(args) != 4 || args[0] != "name" || args[2] != "value" {
+		s.send("info string usage: setoption name <id> value <x>")
+		return
+	}
+
+	n, err := strconv.Atoi(args[3])
+	if err != nil || !smallVariant().validSize(n) {
+		s.send("info string %s must be between %d and %d", args[1], smallVariant().MinSize, smallVariant().MaxSize)
+		return
+	}
+
+	switch strings.ToLower(args[1]) {
+	case "boardwidth":
+		s.board.Width = n
+	case "boardheight":
+		s.board.Height = n
+	default:
+		s.send("info string unknown option %s", args[1])
+	}
+}
+
+func (s *engineSession) setPosition(args []string) error {
+	var rest []string
+
+	switch {
+	case len(args) > 0 && args[0] == "startpos":
+		s.newGame()
+		rest = args[1:]
+	case len(args) > 2 && args[0] == "fen":
+		t, b, white, err := decodeFEN(args[1] + " " + args[2])
+		if err != nil {
+			return err
+		}
+		s.t, s.board, s.white = t, b, white
+		rest = args[3:]
+	default:
+		return fmt.Errorf("usage: position startpos|fen <fen> [moves ...]")
+	}
+
+	if len(rest) == 0 {
+		return nil
+	}
+	if rest[0] != "moves" {
+		return fmt.Errorf("expected moves, got %s", rest[0])
+	}
+
+	for _, text := range rest[1:] {
+		mv, ok := parseMoveText(text, s.board)
+		if !ok || !slices.Contains(generateMoves(s.t, s.board, s.white), mv) {
+			return fmt.Errorf("illegal move %s", text)
+		}
+		s.t.apply(mv)
+		s.white = !s.white
+	}
+
+	return nil
+}
+
+func parseGoLimits(args []string) searchLimits {
+	var limits searchLimits
+
+	for i := 0; i+1 < len(args); i++ {
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			continue
+		}
+		switch args[i] {
+		case "depth":
+			limits.depth = n
+		case "movetime":
+			limits.movetime = time.Duration(n) * time.Millisecond
+		}
+	}
+
+	return limits
+}
+
+// start runs the search in the background so "stop" can interrupt it.
+func (s *engineSession) start(limits searchLimits) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	t, b, white := s.t.clone(), s.board, s.white
+	go func() {
+		defer close(s.done)
+
+		best, ok := search(ctx, smallVariant(), t, b, white, limits, func(info searchInfo) {
+			s.send("info depth %d score %s nodes %d time %d pv %s",
+				info.depth, scoreText(info.score), info.nodes, info.elapsed.Milliseconds(), pvText(info.pv, b.Height))
+		})
+
+		if !ok {
+			s.send("bestmove 0000")
+			return
+		}
+		s.send("bestmove %s", moveText(best, b.Height))
+	}()
+}
+
+func (s *engineSession) stop() {
+	if s.cancel == nil {
+		return
+	}
+
+	s.cancel()
+	<-s.done
+	s.cancel = nil
+}
+
+// scoreText reports forced King captures as "mate" in moves, like UCI.
+func scoreText(score int) string {
+	if abs(score) >= winScore-maxSearchDepth {
+		plies := winScore - abs(score) + 1
+		moves := (plies + 1) / 2
+		if score < 0 {
+			moves = -moves
+		}
+		return fmt.Sprintf("mate %d", moves)
+	}
+
+	return fmt.Sprintf("cp %d", score)
+}
+
+func pvText(pv []move, height int) string {
+	texts := make([]string, len(pv))
+	for i, mv := range pv {
+		texts[i] = moveText(mv, height)
+	}
+
+	return strings.Join(texts, " ")
+}
+
+/*
+ * client side
+ */
+
+// engineClient talks to an external engine subprocess.
+type engineClient struct {
+	name  string
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan string
+}
+
+// startEngine launches command and waits for the protocol handshake.
+func startEngine(command string) (*engineClient, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty engine command")
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	c := &engineClient{name: args[0], cmd: cmd, stdin: stdin, lines: make(chan string, 64)}
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			c.lines <- scanner.Text()
+		}
+		close(c.lines)
+	}()
+
+	if err := c.send("uci"); err != nil {
+		c.Close()
+		return nil, err
+	}
+	for {
+		line, err := c.waitFor("id name", "uciok")
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		if name, ok := strings.CutPrefix(line, "id name "); ok {
+			c.name = name
+			continue
+		}
+		break
+	}
+
+	if err := c.send("isready"); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if _, err := c.waitFor("readyok"); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *engineClient) send(line string) error {
+	_, err := io.WriteString(c.stdin, line+"\n")
+	return err
+}
+
+// waitFor returns the next line starting with one of prefixes, skipping
+// everything else the engine prints.
+func (c *engineClient) waitFor(prefixes ...string) (string, error) {
+	timeout := time.After(engineTimeout)
+
+	for {
+		select {
+		case line, ok := <-c.lines:
+			if !ok {
+				return "", fmt.Errorf("engine %s exited", c.name)
+			}
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(line, prefix) {
+					return line, nil
+				}
+			}
+		case <-timeout:
+			return "", fmt.Errorf("engine %s did not answer in %v", c.name, engineTimeout)
+		}
+	}
+}
+
+// bestMove asks the engine for its move in the given position and returns
+// it in coordinate notation.
+func (c *engineClient) bestMove(fen string, limits searchLimits) (string, error) {
+	goCmd := "go"
+	if limits.depth > 0 {
+		goCmd += fmt.Sprintf(" depth %d", limits.depth)
+	}
+	if limits.movetime > 0 {
+		goCmd += fmt.Sprintf(" movetime %d", limits.movetime.Milliseconds())
+	}
+
+	if err := c.send("position fen " + fen); err != nil {
+		return "", err
+	}
+	if err := c.send(goCmd); err != nil {
+		return "", err
+	}
+
+	line, err := c.waitFor("bestmove")
+	if err != nil {
+		return "", err
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[1] == "0000" {
+		return "", errNoMoves
+	}
+
+	return fields[1], nil
+}
+
+func (c *engineClient) Close() error {
+	c.send("quit")
+	c.stdin.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- c.cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(time.Second):
+		c.cmd.Process.Kill()
+		return <-done
+	}
+}
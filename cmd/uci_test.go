@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+const engineHelperEnv = "SMALL_CHESS_TEST_ENGINE"
+
+// TestMain lets the test binary stand in for an external engine, so the
+// client side can be tested against a real subprocess.
+func TestMain(m *testing.M) {
+	if os.Getenv(engineHelperEnv) == "1" {
+		runEngineProtocol(os.Stdin, os.Stdout)
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestEngineProtocol(t *testing.T) {
+	script := strings.Join([]string{
+		"uci",
+		"isready",
+		"setoption name BoardWidth value 6",
+		"setoption name BoardHeight value 6",
+		"position startpos moves b1e4",
+		"go depth 3",
+		"isready",
+		"position fen 5k/6/4H1/6/6/K5 w",
+		"go depth 2",
+		"isready",
+		"position startpos moves a1a6",
+		"bogus",
+		"quit",
+	}, "\n")
+
+	var out strings.Builder
+	if err := runEngineProtocol(strings.NewReader(script), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	text := out.String()
+	for _, want := range []string{"id name small-chess", "uciok", "readyok", "info depth 3", "bestmove e6e4", "bestmove e4f6", "score mate 1", "info string illegal move a1a6", "info string unknown command bogus"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("output is missing %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestEnginePlayer(t *testing.T) {
+	t.Setenv(engineHelperEnv, "1")
+
+	cfg := defaultConfig()
+	p, err := newPlayer("engine:"+os.Args[0], cfg)
+	if err != nil {
+		t.Fatalf("newPlayer: %v", err)
+	}
+	defer p.Close()
+
+	if name := p.(*enginePlayer).client.name; name != appName {
+		t.Errorf("engine name = %q; want %q", name, appName)
+	}
+
+	tb, b, white, _ := decodeFEN("5k/6/4H1/6/6/K5 w")
+	mv, err := p.pickMove(tb, b, white)
+	if err != nil {
+		t.Fatalf("pickMove: %v", err)
+	}
+	if moveText(mv, b.Height) != "e4f6" {
+		t.Errorf("engine played %s; want e4f6", moveText(mv, b.Height))
+	}
+}
+
+func TestNewPlayerSpecs(t *testing.T) {
+	cfg := defaultConfig()
+
+	for _, spec := range []string{"", "human"} {
+		if p, err := newPlayer(spec, cfg); p != nil || err != nil {
+			t.Errorf("newPlayer(%q) = %v, %v; want a human", spec, p, err)
+		}
+	}
+
+	p, err := newPlayer("ai:4", cfg)
+	if err != nil || p.(searchPlayer).limits.depth != 4 {
+		t.Errorf("newPlayer(ai:4) = %v, %v", p, err)
+	}
+
+	for _, spec := range []string{"ai:9", "robot", "engine:"} {
+		if _, err := newPlayer(spec, cfg); err == nil {
+			t.Errorf("newPlayer(%q) should fail", spec)
+		}
+	}
+
+	cfg.Variant = "chess"
+	if _, err := newPlayer("engine:"+os.Args[0], cfg); err != errEngineVariant {
+		t.Errorf("engine for chess: %v; want %v", err, errEngineVariant)
+	}
+}
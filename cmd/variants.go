@@ -0,0 +1,755 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+)
+
+/*
+ * A variant bundles the rules of a game: the board sizes it is played on,
+ * its extra pieces and starting layout, how pieces promote, how the game is
+ * won and which draw rules apply. The built-in variants are embedded from
+ * the variants directory; more are read from TOML files given with
+ * --variant or kept in the variants directory next to the config file.
+ *
+ * The layout lists White's ranks from its back rank up, each read from
+ * White's left, with '.' for an empty square and '*' for a hole, a square
+ * no piece can use. A rank of one letter and '*', such as "P*", fills the
+ * board's width. Black gets the same ranks turned around the centre of the
+ * board ("rotate", as in the small game) or reflected across it ("mirror",
+ * as in chess). Holes further up the board are listed as squares seen from
+ * White, such as "c3", and get their counterpart on Black's side too.
+ * The board is flat unless the topology joins its sides ("cylinder") or
+ * its sides and ends ("torus").
+ * A capture replaces the captured piece unless capture gives it an effect:
+ * an explosion ("atomic"), a change of sides ("convert") or a piece for
+ * the capturer's hand ("drops").
+ * With players = 4 the layout is set up in all four corners, and teams
+ * pairs the armies in opposite corners.
+ */
+
+const defaultVariant = "small"
+const variantsDirName = "variants"
+
+// minBoardSize and maxBoardSize bound the sizes any variant can use.
+const minBoardSize = 4
+const maxBoardSize = 26
+
+const winKingCapture = "king_capture"
+const winCheckmate = "checkmate"
+const winLastRank = "last_rank"
+
+var winConditions = []string{winKingCapture, winCheckmate, winLastRank}
+
+const symmetryRotate = "rotate"
+const symmetryMirror = "mirror"
+
+const checkmateMsg = "Checkmate. %s wins!"
+const stalemateMsg = "Draw by stalemate"
+const lastRankMsg = "%s's King reached the last rank. %s wins!"
+const kingLeftInCheckMsg = "\n\nThat move would leave your King in check.\n"
+const variantHistoryMsg = "Variant: %s\n"
+const variantsUsage = "usage: small-chess variants [dir...]"
+
+// variant is a set of rules as read from a variant file.
+type variant struct {
+	Name        string           `toml:"name"`
+	Description string           `toml:"description"`
+	MinSize     int              `toml:"min_size"`
+	MaxSize     int              `toml:"max_size"`
+	Layout      []string         `toml:"layout"`
+	Symmetry    string           `toml:"symmetry"`
+	Win         []string         `toml:"win"`
+	Pieces      []variantPiece   `toml:"pieces"`
+	Promotion   variantPromotion `toml:"promotion"`
+	Draw        variantDraw      `toml:"draw"`
+	Holes       []string         `toml:"holes"`
+	Castling    string           `toml:"castling"`   // the letter of the piece the King castles with
+	EnPassant   bool             `toml:"en_passant"` // whether two square steps can be taken en passant
+	Topology    string           `toml:"topology"`   // which edges of the board wrap around
+	Fog         bool             `toml:"fog"`        // whether each side only sees what its pieces reach
+	Capture     string           `toml:"capture"`    // what a capture does besides taking the piece
+	Players     int              `toml:"players"`    // 2, or 4 for an army in each corner
+	Teams       bool             `toml:"teams"`      // whether four players play in pairs
+
+	source string // the file it was read from
+}
+
+// variantPiece declares a piece beyond the King, Tower and Horse.
+type variantPiece struct {
+	Name   string `toml:"name"`
+	Letter string `toml:"letter"`
+	White  string `toml:"white"`
+	Black  string `toml:"black"`
+	Betza  string `toml:"betza"`
+	Value  int    `toml:"value"`
+}
+
+// variantPromotion turns the listed pieces into one of To, the first by
+// default, on reaching the last Zone ranks.
+type variantPromotion struct {
+	Pieces []string `toml:"pieces"`
+	To     []string `toml:"to"`
+	Zone   int      `toml:"zone"`
+}
+
+// variantDraw chooses the draw rules. A move limit set here overrides the
+// config's move_limit.
+type variantDraw struct {
+	Repetition           int  `toml:"repetition"`
+	InsufficientMaterial bool `toml:"insufficient_material"`
+	MoveLimit            *int `toml:"move_limit"`
+}
+
+//go:embed variants/*.toml
+var builtinVariantFiles embed.FS
+
+var (
+	variantsMu     sync.Mutex
+	variantsByName = loadBuiltinVariants()
+	variantsByPath = map[string]*variant{}
+)
+
+func loadBuiltinVariants() map[string]*variant {
+	byName := make(map[string]*variant)
+	files, _ := builtinVariantFiles.ReadDir(variantsDirName)
+	for _, f := range files {
+		path := variantsDirName + "/" + f.Name()
+		data, err := builtinVariantFiles.ReadFile(path)
+		if err != nil {
+			panic(err)
+		}
+		v, err := parseVariant(data, "built-in")
+		if err != nil {
+			panic(fmt.Sprintf("%s: %v", path, err))
+		}
+		byName[v.Name] = v
+	}
+
+	return byName
+}
+
+func variantsDir() string {
+	return filepath.Join(filepath.Dir(defaultConfigPath()), variantsDirName)
+}
+
+// loadVariant finds a variant by name, among the built-in ones and those
+// in the variants directory, or reads it from a .toml file. Variants are
+// read once; their pieces stay registered for the rest of the run.
+func loadVariant(spec string) (*variant, error) {
+	if spec == "" {
+		spec = defaultVariant
+	}
+
+	variantsMu.Lock()
+	defer variantsMu.Unlock()
+
+	if v, ok := variantsByName[spec]; ok {
+		return v, nil
+	}
+
+	path := spec
+	if !strings.HasSuffix(spec, ".toml") {
+		path = filepath.Join(variantsDir(), spec+".toml")
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if v, ok := variantsByPath[path]; ok {
+		return v, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unknown variant %q: %w", spec, err)
+	}
+	v, err := parseVariant(data, path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if other, ok := variantsByName[v.Name]; ok {
+		return nil, fmt.Errorf("%s: variant %q is already defined by %s", path, v.Name, other.source)
+	}
+
+	variantsByName[v.Name] = v
+	variantsByPath[path] = v
+
+	return v, nil
+}
+
+// knownVariant returns a variant that is built in or already loaded.
+func knownVariant(name string) (*variant, bool) {
+	variantsMu.Lock()
+	defer variantsMu.Unlock()
+
+	v, ok := variantsByName[name]
+	return v, ok
+}
+
+// smallVariant returns the default variant, which the engine protocol always
+// plays.
+func smallVariant() *variant {
+	v, _ := knownVariant(defaultVariant)
+	return v
+}
+
+// rules returns the variant the model plays, the small game by default.
+func (m Model) rules() *variant {
+	if m.variant != nil {
+		return m.variant
+	}
+
+	return smallVariant()
+}
+
+/*
+ * parsing
+ */
+
+// parseVariant reads and checks a variant file, registering its pieces.
+func parseVariant(data []byte, source string) (*variant, error) {
+	v := &variant{
+		MinSize:   minBoardSize,
+		MaxSize:   maxBoardSize,
+		Symmetry:  symmetryRotate,
+		Topology:  topologyFlat,
+		Capture:   captureReplace,
+		Players:   2,
+		Win:       []string{winKingCapture},
+		Promotion: variantPromotion{Zone: 1},
+		Draw:      variantDraw{Repetition: repetitionLimit, InsufficientMaterial: true},
+		source:    source,
+	}
+
+	md, err := toml.NewDecoder(bytes.NewReader(data)).Decode(v)
+	if err != nil {
+		return nil, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("unknown key %q", undecoded[0].String())
+	}
+
+	if err := v.check(); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// check validates v. The variant's own pieces are registered for the later
+// checks to use, and taken out again when a check fails.
+func (v *variant) check() (err error) {
+	if v.Name == "" || strings.ContainsFunc(v.Name, unicode.IsSpace) {
+		return fmt.Errorf("the name must be a single word")
+	}
+	if v.MinSize < minBoardSize || v.MaxSize > maxBoardSize || v.MinSize > v.MaxSize {
+		return fmt.Errorf("sizes must be between %d and %d", minBoardSize, maxBoardSize)
+	}
+	if v.Symmetry != symmetryRotate && v.Symmetry != symmetryMirror {
+		return fmt.Errorf("symmetry must be %s or %s", symmetryRotate, symmetryMirror)
+	}
+	if !slices.Contains(topologies, v.Topology) {
+		return fmt.Errorf("unknown topology %q (available: %s)", v.Topology, strings.Join(topologies, ", "))
+	}
+
+	if len(v.Win) == 0 {
+		return fmt.Errorf("at least one win condition is needed (%s)", strings.Join(winConditions, ", "))
+	}
+	for _, w := range v.Win {
+		if !slices.Contains(winConditions, w) {
+			return fmt.Errorf("unknown win condition %q (available: %s)", w, strings.Join(winConditions, ", "))
+		}
+	}
+	if v.wins(winKingCapture) && v.wins(winCheckmate) {
+		return fmt.Errorf("%s and %s cannot be combined", winKingCapture, winCheckmate)
+	}
+	if v.Fog && (len(v.Win) != 1 || !v.wins(winKingCapture)) {
+		return fmt.Errorf("fog of war is only played with %s", winKingCapture)
+	}
+	if _, ok := captureEffectsByName[v.Capture]; !ok {
+		return fmt.Errorf("unknown capture %q (available: %s)", v.Capture, strings.Join(sortedKeys(captureEffectsByName), ", "))
+	}
+	if v.Capture == captureAtomic && !v.wins(winKingCapture) {
+		return fmt.Errorf("atomic captures are only played with %s", winKingCapture)
+	}
+	if err := v.checkPlayers(); err != nil {
+		return err
+	}
+
+	var added []*pieceDef
+	defer func() {
+		if err != nil {
+			for _, def := range added {
+				unregisterPiece(pieces, def)
+			}
+		}
+	}()
+	for _, p := range v.Pieces {
+		def, err := registerVariantPiece(p)
+		if err != nil {
+			return err
+		}
+		if def != nil {
+			added = append(added, def)
+		}
+	}
+
+	if err := v.checkLayout(); err != nil {
+		return err
+	}
+
+	if len(v.Promotion.Pieces) > 0 && len(v.Promotion.To) == 0 {
+		return fmt.Errorf("promotion needs at least one piece to promote to")
+	}
+	if v.Promotion.Zone < 1 || v.Promotion.Zone > v.MinSize/2 {
+		return fmt.Errorf("the promotion zone must be between 1 and %d ranks", v.MinSize/2)
+	}
+	for _, letter := range append(slices.Clone(v.Promotion.Pieces), v.Promotion.To...) {
+		if _, ok := pieceByLetter(letter); !ok || len(letter) != 1 {
+			return fmt.Errorf("unknown piece %q in promotion", letter)
+		}
+	}
+
+	if _, ok := pieceByLetter(v.Castling); v.Castling != "" && (!ok || len(v.Castling) != 1 || v.Castling == "K") {
+		return fmt.Errorf("unknown piece %q to castle with", v.Castling)
+	}
+
+	if v.Draw.Repetition < 0 || v.Draw.Repetition == 1 {
+		return fmt.Errorf("repetition must be 0 (off) or at least 2")
+	}
+	if v.Draw.MoveLimit != nil && *v.Draw.MoveLimit < 0 {
+		return fmt.Errorf("move_limit must be 0 (off) or a number of moves")
+	}
+
+	return nil
+}
+
+// checkPlayers keeps four-player variants to the rules they support: King
+// capture on a flat or wrapping board, with no special moves, effects or
+// fog.
+func (v *variant) checkPlayers() error {
+	if v.Players != 2 && v.Players != fourPlayers {
+		return fmt.Errorf("players must be 2 or %d", fourPlayers)
+	}
+	if v.Players == 2 {
+		if v.Teams {
+			return fmt.Errorf("teams need %d players", fourPlayers)
+		}
+		return nil
+	}
+
+	switch {
+	case len(v.Win) != 1 || !v.wins(winKingCapture):
+		return fmt.Errorf("four players only play %s", winKingCapture)
+	case v.Symmetry != symmetryRotate:
+		return fmt.Errorf("four players need %s symmetry", symmetryRotate)
+	case len(v.Holes) > 0, v.Castling != "", v.EnPassant, v.Fog, len(v.Promotion.Pieces) > 0, v.Capture != captureReplace:
+		return fmt.Errorf("four players cannot have holes, castling, en passant, fog, promotion or capture effects")
+	}
+
+	return nil
+}
+
+// checkLayout makes sure the layout fits the smallest board without the
+// sides overlapping, uses known pieces and has one King per side.
+func (v *variant) checkLayout() error {
+	if len(v.Layout) == 0 || len(v.Layout) > v.MinSize/2 {
+		return fmt.Errorf("the layout must have between 1 and %d ranks", v.MinSize/2)
+	}
+
+	kings := 0
+	for _, rank := range v.Layout {
+		letters := rankLetters(rank, v.MinSize)
+		width := v.MinSize
+		if v.Players == fourPlayers {
+			// the armies on the same edge must not overlap
+			width = v.MinSize / 2
+			letters = []rune(strings.TrimRight(string(letters), "."))
+		}
+		if len(letters) > width {
+			return fmt.Errorf("layout rank %q is wider than %d squares", rank, width)
+		}
+		for _, letter := range letters {
+			if letter == '.' || letter == '*' {
+				continue
+			}
+			piece, ok := pieceByLetter(string(letter))
+			if !ok || !isWhitePiece(piece) {
+				return fmt.Errorf("unknown piece %q in the layout", letter)
+			}
+			if v.Players == fourPlayers && pieces[piece].def.directional() {
+				return fmt.Errorf("piece %q moves one way for each side, which four players cannot share", letter)
+			}
+			if isKing(piece) {
+				kings++
+			}
+		}
+	}
+	if kings != 1 {
+		return fmt.Errorf("the layout needs exactly one King, not %d", kings)
+	}
+
+	layout := v.layoutTable(v.MinSize, v.MinSize)
+	for _, hole := range v.Holes {
+		col, r, ok := holeSquare(hole)
+		if !ok || col >= v.MinSize || r >= v.MinSize {
+			return fmt.Errorf("hole %q is not a square of the %dx%d board", hole, v.MinSize, v.MinSize)
+		}
+		for _, sq := range v.symmetric(col, r, v.MinSize, v.MinSize) {
+			if piece, taken := layout[sq]; taken && piece != HC {
+				return fmt.Errorf("hole %q is on a piece of the layout", hole)
+			}
+		}
+	}
+
+	// where edges wrap the two camps can meet across them
+	b := Board{Width: v.MinSize, Height: v.MinSize, Topology: v.Topology}
+	for _, white := range []bool{true, false} {
+		if err := validatePosition(v.initialTable(b.Width, b.Height), b, white); err != nil {
+			return fmt.Errorf("the starting position is not playable: %w", err)
+		}
+	}
+	for c := colorWhite; v.Players == fourPlayers && c <= colorBlue; c++ {
+		if attacksKing(v.initialTable(b.Width, b.Height), b, c) {
+			return fmt.Errorf("the starting position is not playable: %s can capture a King at once", c)
+		}
+	}
+
+	return nil
+}
+
+// registerVariantPiece adds a variant's piece to the registry and returns
+// its definition. Loading the same definition again is fine and returns
+// nil; a clash with another piece is not.
+func registerVariantPiece(p variantPiece) (*pieceDef, error) {
+	white, wn := utf8.DecodeRuneInString(p.White)
+	black, bn := utf8.DecodeRuneInString(p.Black)
+	letter, ln := utf8.DecodeRuneInString(p.Letter)
+	if p.Name == "" || wn != len(p.White) || bn != len(p.Black) || ln != len(p.Letter) || !unicode.IsUpper(letter) {
+		return nil, fmt.Errorf("piece %q needs a name, an upper case letter and one glyph per colour", p.Name)
+	}
+
+	if info, ok := pieces[white]; ok {
+		def := info.def
+		if def.name == p.Name && def.letter == letter && def.black == black && def.betza == p.Betza && def.value == p.Value {
+			return nil, nil
+		}
+	}
+
+	def := &pieceDef{name: p.Name, letter: letter, white: white, black: black, betza: p.Betza, value: p.Value}
+	if err := registerPiece(pieces, def); err != nil {
+		return nil, err
+	}
+
+	return def, nil
+}
+
+/*
+ * rules
+ */
+
+func (v *variant) validSize(n int) bool {
+	return n >= v.MinSize && n <= v.MaxSize
+}
+
+func (v *variant) wins(condition string) bool {
+	return slices.Contains(v.Win, condition)
+}
+
+// initialTable sets up the layout and the holes on a board of the given
+// size.
+func (v *variant) initialTable(width, height int) table {
+	t := v.layoutTable(width, height)
+	for _, hole := range v.Holes {
+		if col, r, ok := holeSquare(hole); ok && col < width && r < height {
+			for _, sq := range v.symmetric(col, r, width, height) {
+				t[sq] = HC
+			}
+		}
+	}
+
+	return t
+}
+
+// layoutTable sets up the layout ranks alone.
+func (v *variant) layoutTable(width, height int) table {
+	t := make(table)
+	for r, rank := range v.Layout {
+		for col, letter := range rankLetters(rank, width) {
+			if col >= width || r >= height {
+				continue
+			}
+			white, black := HC, HC
+			if letter != '*' {
+				piece, ok := pieceByLetter(string(letter))
+				if !ok {
+					continue
+				}
+				white, black = piece, pieces[piece].def.black
+			}
+			if v.Players == fourPlayers {
+				for c, sq := range cornerSquares(col, r, width, height) {
+					t[sq] = white
+					if white != HC {
+						t[sq] = inArmy(white, pieceColor(c))
+					}
+				}
+				continue
+			}
+			sq := v.symmetric(col, r, width, height)
+			t[sq[0]], t[sq[1]] = white, black
+		}
+	}
+
+	return t
+}
+
+// symmetric returns the table squares of White's col on its r-th rank from
+// the back and of Black's counterpart.
+func (v *variant) symmetric(col, r, width, height int) [2][2]int {
+	blackCol := width - 1 - col
+	if v.Symmetry == symmetryMirror {
+		blackCol = col
+	}
+
+	return [2][2]int{{col, height - 1 - r}, {blackCol, r}}
+}
+
+// holeSquare reads a hole such as "c3" as a column and a rank counted from
+// White's back rank, both from 0.
+func holeSquare(square string) (col, r int, ok bool) {
+	col, rank, ok := parseSquare(square)
+
+	return col, rank - 1, ok
+}
+
+// rankLetters returns the letters of a layout rank on a board width
+// squares wide.
+func rankLetters(rank string, width int) []rune {
+	if letter, ok := strings.CutSuffix(rank, "*"); ok && utf8.RuneCountInString(letter) == 1 {
+		return []rune(strings.Repeat(letter, width))
+	}
+
+	return []rune(rank)
+}
+
+// moveLimit returns the move limit in force: the variant's when it sets
+// one, else the configured one.
+func (v *variant) moveLimit(configured int) int {
+	if v.Draw.MoveLimit != nil {
+		return *v.Draw.MoveLimit
+	}
+
+	return configured
+}
+
+// promotions lists the letters of the pieces piece can turn into on
+// reaching row, none when it does not promote there.
+func (v *variant) promotions(piece rune, row int, b Board) []string {
+	info, ok := pieces[piece]
+	if !ok || !slices.Contains(v.Promotion.Pieces, string(info.def.letter)) {
+		return nil
+	}
+
+	inZone := row < v.Promotion.Zone
+	if !info.white {
+		inZone = row >= b.Height-v.Promotion.Zone
+	}
+	if !inZone {
+		return nil
+	}
+
+	return v.Promotion.To
+}
+
+// promotion returns what piece turns into on reaching row, or 0 when it
+// does not promote. choice is the letter asked for, 0 for the first one
+// offered; it must be one of promotions.
+func (v *variant) promotion(piece rune, row int, b Board, choice rune) rune {
+	choices := v.promotions(piece, row, b)
+	if len(choices) == 0 {
+		return 0
+	}
+
+	letter := choices[0]
+	if choice != 0 {
+		letter = string(choice)
+	}
+
+	return sidePiece(letter, isWhitePiece(piece))
+}
+
+// sidePiece returns the piece of the given letter for one side.
+func sidePiece(letter string, white bool) rune {
+	piece, _ := pieceByLetter(letter)
+	if !white {
+		piece = pieces[piece].def.black
+	}
+
+	return piece
+}
+
+// generateMoves lists the moves of white's pieces like the package level
+// generateMoves, with one move per piece a promoting move can turn into and
+// without captures whose effect would take white's own King. Castling, en
+// passant and drops are left to legalMoves.
+func (v *variant) generateMoves(t table, b Board, white bool) []move {
+	moves := generateMoves(t, b, white)
+	if captureEffectsByName[v.Capture] != nil {
+		moves = slices.DeleteFunc(moves, func(mv move) bool {
+			return v.plainRecord(t, b, mv).removesKing(white)
+		})
+	}
+	if len(v.Promotion.Pieces) == 0 {
+		return moves
+	}
+
+	expanded := moves[:0:0]
+	for _, mv := range moves {
+		choices := v.promotions(getCellValue(mv.fromCol, mv.fromRow, t), mv.toRow, b)
+		if len(choices) == 0 {
+			expanded = append(expanded, mv)
+			continue
+		}
+		for _, letter := range choices {
+			mv.promotion = []rune(letter)[0]
+			expanded = append(expanded, mv)
+		}
+	}
+
+	return expanded
+}
+
+// outcome checks the win conditions after a move by one side of piece to
+// row, the last of history, returning the result and its banner, or
+// resultNone. King captures are found by movePiece itself.
+func (v *variant) outcome(t table, b Board, moverWhite bool, piece rune, row int, history []moveRecord) (gameResult, string) {
+	winner := resultWhiteWins
+	if !moverWhite {
+		winner = resultBlackWins
+	}
+
+	lastRank := 0
+	if !moverWhite {
+		lastRank = b.Height - 1
+	}
+	if v.wins(winLastRank) && isKing(piece) && row == lastRank {
+		return winner, fmt.Sprintf(lastRankMsg, sideName(moverWhite), sideName(moverWhite))
+	}
+
+	if v.wins(winCheckmate) && !v.hasLegalMove(t, b, !moverWhite, history) {
+		if kingAttacked(t, b, !moverWhite) {
+			return winner, fmt.Sprintf(checkmateMsg, sideName(moverWhite))
+		}
+		return resultDraw, stalemateMsg
+	}
+
+	return resultNone, ""
+}
+
+// kingAttacked reports whether the other side could capture white's King.
+func kingAttacked(t table, b Board, white bool) bool {
+	for _, mv := range generateMoves(t, b, !white) {
+		if captured := getCellValue(mv.toCol, mv.toRow, t); isKing(captured) && isOwnPiece(captured, white) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// leavesKingAttacked plays r on a copy of t and checks the mover's King.
+func leavesKingAttacked(t table, b Board, r moveRecord, white bool) bool {
+	probe := t.clone()
+	probe.play(r)
+
+	return kingAttacked(probe, b, white)
+}
+
+// legalMoves lists the moves the variant allows after history, special
+// moves included: in checkmate games those that leave the mover's King
+// safe, otherwise every move.
+func (v *variant) legalMoves(t table, b Board, white bool, history []moveRecord) []move {
+	checked := v.wins(winCheckmate)
+	moves := v.generateMoves(t, b, white)
+	if checked {
+		moves = slices.DeleteFunc(moves, func(mv move) bool {
+			return leavesKingAttacked(t, b, moveRecord{mv: mv}, white)
+		})
+	}
+	for _, r := range v.specialMoves(t, b, white, history) {
+		if !checked || !leavesKingAttacked(t, b, r, white) {
+			moves = append(moves, r.mv)
+		}
+	}
+
+	return moves
+}
+
+func (v *variant) hasLegalMove(t table, b Board, white bool, history []moveRecord) bool {
+	for _, mv := range generateMoves(t, b, white) {
+		if !leavesKingAttacked(t, b, moveRecord{mv: mv}, white) {
+			return true
+		}
+	}
+	for _, r := range v.specialMoves(t, b, white, history) {
+		if !leavesKingAttacked(t, b, r, white) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+ * variants command
+ */
+
+// runVariantsCommand lists the built-in variants and those found in dirs,
+// by default the variants directory next to the config file.
+func runVariantsCommand(args []string, out io.Writer) error {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			return errors.New(variantsUsage)
+		}
+	}
+	dirs := args
+	if len(dirs) == 0 {
+		dirs = []string{variantsDir()}
+	}
+
+	for _, dir := range dirs {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.toml"))
+		for _, file := range files {
+			if _, err := loadVariant(file); err != nil {
+				fmt.Fprintf(out, "skipping %v\n", err)
+			}
+		}
+	}
+
+	variantsMu.Lock()
+	names := sortedKeys(variantsByName)
+	variantsMu.Unlock()
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSIZES\tWIN\tSOURCE\tDESCRIPTION")
+	for _, name := range names {
+		v, _ := knownVariant(name)
+		fmt.Fprintf(tw, "%s\t%d-%d\t%s\t%s\t%s\n", v.Name, v.MinSize, v.MaxSize, strings.Join(v.Win, ","), v.source, v.Description)
+	}
+
+	return tw.Flush()
+}
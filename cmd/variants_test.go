@@ -0,0 +1,255 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeVariant saves a variant file in a temporary directory.
+func writeVariant(t *testing.T, dir, name, text string) string {
+	t.Helper()
+	path := filepath.Join(dir, name+".toml")
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+const raceVariant = `
+name = "race"
+description = "Soldiers promote and Kings race to the far side"
+min_size = 6
+max_size = 8
+layout = ["KTH", "S"]
+win = ["king_capture", "last_rank"]
+
+[[pieces]]
+name = "Soldier"
+letter = "S"
+white = "Ⓢ"
+black = "ⓢ"
+betza = "fmWfcF"
+value = 100
+
+[promotion]
+pieces = ["S"]
+to = ["T", "H"]
+
+[draw]
+repetition = 0
+move_limit = 5
+`
+
+func TestParseVariant(t *testing.T) {
+	tests := []struct {
+		name, text, err string
+	}{
+		{"unknown key", `name = "x"` + "\nlayout = [\"K\"]\ncolour = 1", "unknown key"},
+		{"no name", `layout = ["K"]`, "name"},
+		{"sizes", "name = \"x\"\nlayout = [\"K\"]\nmax_size = 27", "sizes"},
+		{"win", "name = \"x\"\nlayout = [\"K\"]\nwin = [\"points\"]", "unknown win condition"},
+		{"win combination", "name = \"x\"\nlayout = [\"K\"]\nwin = [\"king_capture\", \"checkmate\"]", "cannot be combined"},
+		{"two Kings", "name = \"x\"\nlayout = [\"KK\"]", "exactly one King"},
+		{"wide layout", "name = \"x\"\nmin_size = 6\nlayout = [\"KTHTHTH\"]", "wider"},
+		{"tall layout", "name = \"x\"\nmin_size = 6\nlayout = [\"K\", \"T\", \"H\", \"T\"]", "ranks"},
+		{"unknown piece", "name = \"x\"\nlayout = [\"KZ\"]", "unknown piece"},
+		{"hole off the board", "name = \"x\"\nmin_size = 6\nlayout = [\"K\"]\nholes = [\"g1\"]", "not a square"},
+		{"hole on a piece", "name = \"x\"\nlayout = [\"K\"]\nholes = [\"a1\"]", "on a piece"},
+		{"fog with checkmate", "name = \"x\"\nlayout = [\"K\"]\nfog = true\nwin = [\"checkmate\"]", "fog of war"},
+		{"promotion", "name = \"x\"\nlayout = [\"KH\"]\n[promotion]\npieces = [\"H\"]", "promote to"},
+		{"bad betza", "name = \"x\"\nlayout = [\"K\"]\n[[pieces]]\nname = \"Y\"\nletter = \"Y\"\nwhite = \"Y\"\nblack = \"y\"\nbetza = \"fm\"", "ends with modifiers"},
+		{"letter clash", "name = \"x\"\nlayout = [\"K\"]\n[[pieces]]\nname = \"Tank\"\nletter = \"T\"\nwhite = \"⛟\"\nblack = \"⛍\"\nbetza = \"W\"", "already used"},
+	}
+
+	for _, test := range tests {
+		if _, err := parseVariant([]byte(test.text), "test"); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: error = %v; want one about %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestFailedVariantLeavesNoPieces(t *testing.T) {
+	const wizard = "\n[[pieces]]\nname = \"Wizard\"\nletter = \"W\"\nwhite = \"Ⓦ\"\nblack = \"ⓦ\"\nbetza = \"WD\""
+
+	// the layout fails after the Wizard was registered for it
+	if _, err := parseVariant([]byte("name = \"x\"\nlayout = [\"KKW\"]"+wizard), "test"); err == nil {
+		t.Fatal("two Kings accepted")
+	}
+	if piece, ok := pieceByLetter("W"); ok {
+		t.Errorf("the Wizard %q stayed registered", piece)
+	}
+	if _, ok := pieces['Ⓦ']; ok {
+		t.Error("the Wizard's glyph stayed registered")
+	}
+
+	// and the letter is free for a valid variant
+	if _, err := parseVariant([]byte("name = \"x\"\nlayout = [\"KW\"]"+strings.Replace(wizard, "WD", "W", 1)), "test"); err != nil {
+		t.Errorf("valid variant: %v", err)
+	}
+}
+
+func TestVariantLayouts(t *testing.T) {
+	small := smallVariant()
+	want := table{
+		{0, 5}: WhiteKing, {1, 5}: WhiteTower, {2, 5}: WhiteHorse,
+		{5, 0}: BlackKing, {4, 0}: BlackTower, {3, 0}: BlackHorse,
+	}
+	if got := small.initialTable(6, 6); encodeFEN(got, Board{Width: 6, Height: 6}, true) != encodeFEN(want, Board{Width: 6, Height: 6}, true) {
+		t.Errorf("small layout = %s", encodeFEN(got, Board{Width: 6, Height: 6}, true))
+	}
+
+	mirrored := *small
+	mirrored.Symmetry = symmetryMirror
+	if got := encodeFEN(mirrored.initialTable(6, 6), Board{Width: 6, Height: 6}, true); got != "kth3/6/6/6/6/KTH3 w" {
+		t.Errorf("mirrored layout = %s", got)
+	}
+}
+
+func TestVariantFile(t *testing.T) {
+	dir := t.TempDir()
+	path := writeVariant(t, dir, "race", raceVariant)
+
+	cfg := headlessTestConfig(t)
+	if err := cfg.set("variant", path); err != nil {
+		t.Fatalf("set variant: %v", err)
+	}
+	if v, err := loadVariant(path); err != nil || v.Name != "race" {
+		t.Fatalf("loading again = %v, %v", v, err)
+	}
+
+	m := newModel(cfg)
+	m.Board = Board{Width: 6, Height: 6}
+	if m.rules().validSize(9) || !m.rules().validSize(8) {
+		t.Errorf("race sizes are 6 to 8")
+	}
+	if got := encodeFEN(m.rules().initialTable(6, 6), m.Board, true); got != "3htk/5s/6/6/S5/KTH3 w" {
+		t.Errorf("race layout = %s", got)
+	}
+
+	// a Soldier promotes to the first choice, and undo brings it back
+	m.startFEN = "5k/S5/6/6/6/K5 w"
+	m = startGame(m)
+	if m, _ = movePiece("a5", "a6", m); getCellValue(0, 0, m.Table) != WhiteTower {
+		t.Fatalf("no promotion: %s", m.fen())
+	}
+	if m, _ = undoMove(m); m.fen() != "5k/S5/6/6/6/K5 w" {
+		t.Errorf("after undo: %s", m.fen())
+	}
+
+	// the variant's move limit replaces the configured one
+	if got := m.rules().moveLimit(m.config.MoveLimit); got != 5 {
+		t.Errorf("move limit = %d; want 5", got)
+	}
+
+	// a King on the last rank wins
+	m.startFEN = "5k/K5/6/6/6/6 w"
+	m = startGame(m)
+	m, _ = movePiece("a5", "b6", m)
+	if m.result != resultWhiteWins || m.endReason != "White's King reached the last rank. White wins!" {
+		t.Errorf("last rank: result %v, reason %q", m.result, m.endReason)
+	}
+	if rec := m.gameRecord(); rec.Variant != "race" {
+		t.Errorf("recorded variant = %q", rec.Variant)
+	}
+
+	var out strings.Builder
+	if err := runVariantsCommand([]string{dir}, &out); err != nil {
+		t.Fatalf("variants: %v", err)
+	}
+	for _, want := range []string{"NAME", "mate", "race", "6-8", "small", "built-in"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("variants output is missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestCheckmateVariant(t *testing.T) {
+	cfg := headlessTestConfig(t)
+	cfg.Variant = "mate"
+
+	tests := []struct {
+		name     string
+		fen      string
+		from, to string
+		msg      string
+		result   gameResult
+		reason   string
+	}{
+		{"self check", "5k/6/6/6/3t2/K5 w", "a1", "a2", kingLeftInCheckMsg, resultNone, ""},
+		{"checkmate", "5k/2T3/6/2T3/6/K5 w", "c3", "c6", "", resultWhiteWins, "Checkmate. White wins!"},
+		{"stalemate", "5k/6/6/6/3T2/K5 w", "d2", "d5", "", resultDraw, stalemateMsg},
+	}
+
+	for _, test := range tests {
+		m := newModel(cfg)
+		m.Board, m.startFEN = Board{Width: 6, Height: 6}, test.fen
+		m = startGame(m)
+
+		m, msg := movePiece(test.from, test.to, m)
+		if msg != test.msg || m.result != test.result || m.endReason != test.reason {
+			t.Errorf("%s: message %q, result %v, reason %q; want %q, %v, %q", test.name, msg, m.result, m.endReason, test.msg, test.result, test.reason)
+		}
+	}
+
+	m := newModel(cfg)
+	m.Board, m.startFEN = Board{Width: 6, Height: 6}, "5k/6/6/6/3t2/K5 w"
+	m = startGame(m)
+	if moves := m.rules().legalMoves(m.Table, m.Board, true, m.moves); len(moves) != 1 || moveText(moves[0], 6) != "a1b1" {
+		t.Errorf("legal moves = %v; want only a1b1", moves)
+	}
+}
+
+func TestHoles(t *testing.T) {
+	walls, ok := knownVariant("walls")
+	if !ok {
+		t.Fatalf("no walls variant")
+	}
+	if got := encodeFEN(walls.initialTable(6, 6), Board{Width: 6, Height: 6}, true); got != "3htk/6/2**2/2**2/6/KTH3 w" {
+		t.Errorf("walls on 6x6 = %s", got)
+	}
+	if got := encodeFEN(walls.initialTable(8, 7), Board{Width: 8, Height: 7}, true); got != "5htk/8/4**2/8/2**4/8/KTH5 w" {
+		t.Errorf("walls on 8x7 = %s", got)
+	}
+
+	cfg := headlessTestConfig(t)
+	cfg.Variant = "walls"
+	tests := []struct {
+		name     string
+		fen      string
+		from, to string
+		msg      string
+	}{
+		{"onto a hole", "", "b1", "c2", ""},
+		{"into the wall", "5k/6/2**2/2**2/2T3/K5 w", "c2", "c3", invalidMoveMsg},
+		{"a Tower cannot leap the wall", "5k/6/2**2/2**2/2T3/K5 w", "c2", "c5", invalidMoveMsg},
+		{"nor leap across it", "5k/6/2**2/2**2/4T1/K5 w", "e2", "b5", invalidMoveMsg},
+		{"a Tower still leaps pieces", "5k/6/6/2h3/2T3/K5 w", "c2", "c4", ""},
+		{"a Rook rides into it", "5k/6/2**2/2**2/2R3/K5 w", "c2", "c5", invalidMoveMsg},
+		{"jumping the wall", "5k/6/2**2/2**2/2H3/K5 w", "c2", "d4", invalidMoveMsg},
+		{"a Horse jumps", "5k/6/2**2/2**2/2H3/K5 w", "c2", "b4", ""},
+		{"from a hole", "5k/6/2**2/2**2/2H3/K5 w", "c3", "c2", noPieceMsg},
+	}
+	for _, test := range tests {
+		m := newModel(cfg)
+		m.Board, m.startFEN = Board{Width: 6, Height: 6}, test.fen
+		m = startGame(m)
+		if _, msg := movePiece(test.from, test.to, m); msg != test.msg {
+			t.Errorf("%s: message %q; want %q", test.name, msg, test.msg)
+		}
+	}
+
+	m := newModel(cfg)
+	m.Board = Board{Width: 6, Height: 6}
+	m = startGame(m)
+	for _, mv := range generateMoves(m.Table, m.Board, true) {
+		if getCellValue(mv.toCol, mv.toRow, m.Table) == HC {
+			t.Errorf("generated a move onto a hole: %s", moveText(mv, 6))
+		}
+	}
+	if board := drawTableWithMap(6, 6, m.Table); !strings.Contains(board, "│▒▒▒│▒▒▒│") {
+		t.Errorf("holes are not drawn:\n%s", board)
+	}
+}
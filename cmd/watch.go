@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const watchUsage = "usage: small-chess watch [-server http://localhost:8080] <game-id>"
+const watchConnectingMsg = "\n\nConnecting to game %s...\n"
+const watchLostMsg = "\n\nNo more updates: %v\n"
+const watchSpectatorsMsg = "\n👀 Spectators: %d\n"
+const watchFooterMsg = "\nWatching game %s. Press esc to stop.\n"
+const watchClockMsg = "\n⬜ White %s    ⬛ Black %s\n"
+
+var errStreamClosed = errors.New("the server closed the stream")
+
+// streamMsg carries one event of the game stream to the watch UI.
+type streamMsg struct {
+	name string
+	data []byte
+	err  error
+}
+
+// watchModel shows an API game read-only, as its events arrive.
+type watchModel struct {
+	config Config
+	id     string
+	events <-chan streamMsg
+	state  *apiGameState
+	err    error
+}
+
+// openStream subscribes to a game's events on the API server.
+func openStream(ctx context.Context, server, id string) (<-chan streamMsg, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(server, "/")+"/games/"+id+"/events", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var apiErr apiError
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return nil, fmt.Errorf("game %s: %s", id, apiErr.Error)
+	}
+
+	events := make(chan streamMsg)
+	go func() {
+		defer resp.Body.Close()
+
+		err := readEvents(resp.Body, func(name string, data []byte) {
+			select {
+			case events <- streamMsg{name: name, data: data}:
+			case <-ctx.Done():
+			}
+		})
+		if err == nil {
+			err = errStreamClosed
+		}
+
+		select {
+		case events <- streamMsg{err: err}:
+		case <-ctx.Done():
+		}
+	}()
+
+	return events, nil
+}
+
+func (m watchModel) waitForStream() tea.Cmd {
+	return func() tea.Msg {
+		return <-m.events
+	}
+}
+
+func (m watchModel) Init() tea.Cmd {
+	return m.waitForStream()
+}
+
+func (m watchModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if m.config.keyAction(msg.String()) == actionQuit || msg.String() == "q" {
+			return m, tea.Quit
+		}
+
+	case streamMsg:
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+
+		switch msg.name {
+		case streamState:
+			var st apiGameState
+			if err := json.Unmarshal(msg.data, &st); err == nil {
+				m.state = &st
+			}
+		case streamClock:
+			var c apiClock
+			if err := json.Unmarshal(msg.data, &c); err == nil && m.state != nil {
+				m.state.Clock = &c
+			}
+		}
+
+		return m, m.waitForStream()
+	}
+
+	return m, nil
+}
+
+func (m watchModel) View() string {
+	var sb strings.Builder
+
+	if m.state == nil {
+		sb.WriteString(fmt.Sprintf(watchConnectingMsg, m.id))
+	} else if t, b, white, err := decodeFEN(m.state.FEN); err == nil {
+		sb.WriteString("\n\n")
+		if v, ok := knownVariant(m.state.Variant); ok {
+			b.Topology = v.Topology
+		}
+		sb.WriteString(drawBoard(b, t, nil))
+
+		if result := parseGameResult(m.state.Result); result != resultNone {
+			sb.WriteString("\n\n")
+			sb.WriteString(drawBoxMessage(result.message()))
+			sb.WriteString("\n")
+		} else if white {
+			sb.WriteString(whiteTurnIndicator)
+		} else {
+			sb.WriteString(blackTurnIndicator)
+		}
+
+		if c := m.state.Clock; c != nil {
+			sb.WriteString(fmt.Sprintf(watchClockMsg, formatClock(c.WhiteMS), formatClock(c.BlackMS)))
+		}
+		sb.WriteString(fmt.Sprintf(watchSpectatorsMsg, m.state.Spectators))
+	}
+
+	if m.err != nil {
+		sb.WriteString(fmt.Sprintf(watchLostMsg, m.err))
+	}
+	sb.WriteString(fmt.Sprintf(watchFooterMsg, m.id))
+
+	return sb.String()
+}
+
+// formatClock shows milliseconds as m:ss.
+func formatClock(ms int64) string {
+	d := time.Duration(ms) * time.Millisecond
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+// runWatchCommand implements `small-chess watch`.
+func runWatchCommand(args []string, cfg Config, out io.Writer) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.SetOutput(out)
+	server := fs.String("server", "http://localhost:8080", "address of the small-chess API server")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New(watchUsage)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := openStream(ctx, *server, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	_, err = tea.NewProgram(watchModel{config: cfg, id: fs.Arg(0), events: events}).Run()
+	return err
+}